@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"fshubhook/fswebhook"
+)
+
+func serveCommand(fs *flag.FlagSet) runFunc {
+	return func(ctx context.Context, cfg fswebhook.Config, args []string) error {
+		return runServe(ctx, cfg)
+	}
+}
+
+func migrateCommand(fs *flag.FlagSet) runFunc {
+	return func(ctx context.Context, cfg fswebhook.Config, args []string) error {
+		applied, err := fswebhook.MigrateDB()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Applied %d migrations to %s, the schema is up to date\n", applied, cfg.Database)
+		return nil
+	}
+}
+
+func syncCommand(fs *flag.FlagSet) runFunc {
+	return func(ctx context.Context, cfg fswebhook.Config, args []string) error {
+		token := os.Getenv("FSHUB_API_TOKEN")
+		if token == "" {
+			return errors.New("FSHUB_API_TOKEN is not set")
+		}
+		result, err := fswebhook.SyncFlights(ctx, fswebhook.NewFSHubClient(token), cfg.AirlineID)
+		printImportResult(result)
+		return err
+	}
+}
+
+func backfillCommand(fs *flag.FlagSet) runFunc {
+	since := fs.String("since", "", "Only recompute flights arriving from this date (YYYY-MM-DD); every flight by default")
+	return func(ctx context.Context, cfg fswebhook.Config, args []string) error {
+		from := time.Time{}
+		if *since != "" {
+			var err error
+			if from, err = time.Parse(time.DateOnly, *since); err != nil {
+				return fmt.Errorf("invalid -since date %q", *since)
+			}
+		}
+		if err := loadAchievements(cfg); err != nil {
+			return err
+		}
+		result, err := fswebhook.Backfill(ctx, from)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Detected %d new group flights, evaluated achievements for %d flights\n",
+			result.GroupFlights, result.FlightsEvaluated)
+		return nil
+	}
+}
+
+func replayCommand(fs *flag.FlagSet) runFunc {
+	return func(ctx context.Context, cfg fswebhook.Config, args []string) error {
+		if err := loadAchievements(cfg); err != nil {
+			return err
+		}
+		outcomes := make(map[string]int)
+		err := eachInput(args, func(r io.Reader) error {
+			counts, err := fswebhook.ReplayFlightCompleted(ctx, r)
+			for outcome, n := range counts {
+				outcomes[outcome] += n
+			}
+			return err
+		})
+		names := make([]string, 0, len(outcomes))
+		for outcome := range outcomes {
+			names = append(names, outcome)
+		}
+		sort.Strings(names)
+		for _, outcome := range names {
+			fmt.Printf("%-16s %d\n", outcome, outcomes[outcome])
+		}
+		return err
+	}
+}
+
+// periodNames are the report headings' adjectives for each period.
+var periodNames = map[string]string{"week": "Weekly", "month": "Monthly", "all": "All-Time"}
+
+func reportCommand(fs *flag.FlagSet) runFunc {
+	period := fs.String("period", "week", "Period to rank: week (the last completed one), month or all")
+	start := fs.String("start", "", "Start date (YYYY-MM-DD), overriding the period")
+	end := fs.String("end", "", "End date (YYYY-MM-DD), overriding the period")
+	metric := fs.String("metric", "all", "Leaderboard to print: all, landing, distance, flights, hours or efficiency")
+	format := fs.String("format", fswebhook.ReportText, "Output format: text, markdown (for Discord) or json")
+	return func(ctx context.Context, cfg fswebhook.Config, args []string) error {
+		opts := fswebhook.ReportOptions{Metric: *metric, Format: *format, Period: periodNames[*period]}
+		if *start != "" || *end != "" {
+			opts.Period = ""
+		}
+		if err := opts.Validate(); err != nil {
+			return err
+		}
+		from, to, err := fswebhook.ParsePeriod(*period, *start, *end)
+		if err != nil {
+			return err
+		}
+		report, err := fswebhook.GetWeeklyReport(ctx, from, to)
+		if err != nil {
+			return err
+		}
+		return fswebhook.WriteReport(os.Stdout, report, opts)
+	}
+}
+
+func exportCommand(fs *flag.FlagSet) runFunc {
+	period := fs.String("period", "all", "Arrival period to export: week (the last completed one), month or all")
+	start := fs.String("start", "", "Start date (YYYY-MM-DD), overriding the period")
+	end := fs.String("end", "", "End date (YYYY-MM-DD), overriding the period")
+	pilot := fs.Int("pilot", 0, "Only export this pilot's flights")
+	aircraft := fs.String("aircraft", "", "Only export flights in this aircraft type (ICAO code)")
+	airport := fs.String("airport", "", "Only export flights departing from or arriving at this airport (ICAO code)")
+	format := fs.String("format", "csv", "Output format: csv or xlsx")
+	output := fs.String("o", "", "File to write, standard output by default")
+	return func(ctx context.Context, cfg fswebhook.Config, args []string) error {
+		export := fswebhook.ExportFlightsCSV
+		switch *format {
+		case "csv":
+		case "xlsx":
+			export = fswebhook.ExportFlightsXLSX
+		default:
+			return fmt.Errorf("unknown format %q, expected csv or xlsx", *format)
+		}
+		filter := fswebhook.FlightFilter{
+			PilotID:      *pilot,
+			AircraftICAO: strings.ToUpper(*aircraft),
+			AirportICAO:  strings.ToUpper(*airport),
+		}
+		var err error
+		if filter.Start, filter.End, err = fswebhook.ParsePeriod(*period, *start, *end); err != nil {
+			return err
+		}
+
+		var w io.Writer = os.Stdout
+		if *output != "" {
+			f, err := os.Create(*output)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		n, err := export(ctx, w, filter)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Exported %d flights\n", n)
+		return nil
+	}
+}
+
+func importCommand(fs *flag.FlagSet) runFunc {
+	format := fs.String("format", "auto", "Input format: auto, json (FSHub API flights or webhook events) or csv")
+	return func(ctx context.Context, cfg fswebhook.Config, args []string) error {
+		importFlights := fswebhook.ImportFlights
+		switch *format {
+		case "auto":
+		case "json":
+			importFlights = fswebhook.ImportFlightsJSON
+		case "csv":
+			importFlights = fswebhook.ImportFlightsCSV
+		default:
+			return fmt.Errorf("unknown format %q, expected auto, json or csv", *format)
+		}
+		var total fswebhook.ImportResult
+		err := eachInput(args, func(r io.Reader) error {
+			result, err := importFlights(ctx, r)
+			total.Inserted += result.Inserted
+			total.Skipped += result.Skipped
+			total.Invalid += result.Invalid
+			return err
+		})
+		printImportResult(total)
+		return err
+	}
+}
+
+func doctorCommand(fs *flag.FlagSet) runFunc {
+	return func(ctx context.Context, cfg fswebhook.Config, args []string) error {
+		report := fswebhook.Diagnose(ctx)
+
+		// Problems the server would only run into later.
+		if err := fswebhook.LoadAchievementRules(cfg.Achievements); err != nil && !os.IsNotExist(err) {
+			report.Checks["achievements"] = fswebhook.CheckResult{Status: "fail", Error: err.Error()}
+		} else {
+			report.Checks["achievements"] = fswebhook.CheckResult{Status: "ok"}
+		}
+		if cfg.Webhook && os.Getenv("WEBHOOK_SECRET") == "" {
+			report.Checks["webhook_secret"] = fswebhook.CheckResult{Status: "fail", Error: "the webhook is enabled but WEBHOOK_SECRET is not set"}
+		}
+
+		names := make([]string, 0, len(report.Checks))
+		for name := range report.Checks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		failed := 0
+		for _, name := range names {
+			check := report.Checks[name]
+			if check.Status == "ok" {
+				fmt.Printf("ok    %s\n", name)
+				continue
+			}
+			failed++
+			fmt.Printf("FAIL  %s: %s\n", name, check.Error)
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d checks failed", failed, len(names))
+		}
+		return nil
+	}
+}
+
+// eachInput calls fn with each named file in turn, or with standard input when there are none
+// or the name is "-".
+func eachInput(names []string, fn func(r io.Reader) error) error {
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+	for _, name := range names {
+		if name == "-" {
+			if err := fn(os.Stdin); err != nil {
+				return fmt.Errorf("standard input: %w", err)
+			}
+			continue
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		err = fn(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func printImportResult(result fswebhook.ImportResult) {
+	fmt.Printf("Inserted %d flights, skipped %d already on record, %d invalid\n",
+		result.Inserted, result.Skipped, result.Invalid)
+}
@@ -0,0 +1,287 @@
+package fswebhook
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// AchievementRule declares a badge and the condition under which it is awarded.
+// A rule matches when its metric lies within [Min, Max]; either bound may be omitted.
+type AchievementRule struct {
+	ID          string   `yaml:"id" json:"id"`
+	Name        string   `yaml:"name" json:"name"`
+	Description string   `yaml:"description" json:"description"`
+	Metric      string   `yaml:"metric" json:"metric"`
+	Min         *float64 `yaml:"min,omitempty" json:"min,omitempty"`
+	Max         *float64 `yaml:"max,omitempty" json:"max,omitempty"`
+}
+
+// Achievement struct to hold a badge awarded to a pilot
+type Achievement struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	FlightID    int       `json:"flightid"`
+	AwardedAt   time.Time `json:"awarded_at"`
+}
+
+// achievementMetrics maps the metric names usable in rules to the function computing them.
+// Career metrics cover every flight the pilot has stored, flight metrics only the flight
+// that was just ingested.
+var achievementMetrics = map[string]func(ctx context.Context, pilotID int, flight FlightData) (float64, error){
+	"total_flights": func(ctx context.Context, pilotID int, _ FlightData) (float64, error) {
+		return queryPilotMetric(ctx, `SELECT COUNT(*) FROM flights WHERE pilotid = ?`, pilotID)
+	},
+	"total_hours": func(ctx context.Context, pilotID int, _ FlightData) (float64, error) {
+		return queryPilotMetric(ctx, `SELECT COALESCE(SUM(time), 0) / 3600.0 FROM flights WHERE pilotid = ?`, pilotID)
+	},
+	"total_distance": func(ctx context.Context, pilotID int, _ FlightData) (float64, error) {
+		return queryPilotMetric(ctx, `SELECT COALESCE(SUM(distance), 0) FROM flights WHERE pilotid = ?`, pilotID)
+	},
+	"airports_visited": func(ctx context.Context, pilotID int, _ FlightData) (float64, error) {
+		return queryPilotMetric(ctx, `
+			SELECT COUNT(DISTINCT icao) FROM (
+				SELECT departure_icao AS icao FROM flights WHERE pilotid = ?1
+				UNION
+				SELECT arrival_icao FROM flights WHERE pilotid = ?1
+			) WHERE icao != ''`, pilotID)
+	},
+	"aircraft_types": func(ctx context.Context, pilotID int, _ FlightData) (float64, error) {
+		return queryPilotMetric(ctx, `SELECT COUNT(DISTINCT aircraft_icao) FROM flights WHERE pilotid = ? AND aircraft_icao != ''`, pilotID)
+	},
+	"daily_streak": func(ctx context.Context, pilotID int, flight FlightData) (float64, error) {
+		arrival, err := time.Parse(time.RFC3339, flight.Arrival.DateTime)
+		if err != nil {
+			return 0, err
+		}
+		streak, err := dailyStreakEndingAt(ctx, pilotID, arrival)
+		return float64(streak), err
+	},
+	"landing_rate": func(_ context.Context, _ int, flight FlightData) (float64, error) {
+		return float64(flight.Arrival.LandingRate), nil
+	},
+	"flight_distance": func(_ context.Context, _ int, flight FlightData) (float64, error) {
+		return float64(flight.Distance.NM), nil
+	},
+	"flight_hours": func(_ context.Context, _ int, flight FlightData) (float64, error) {
+		departure, err := time.Parse(time.RFC3339, flight.Departure.DateTime)
+		if err != nil {
+			return 0, err
+		}
+		arrival, err := time.Parse(time.RFC3339, flight.Arrival.DateTime)
+		if err != nil {
+			return 0, err
+		}
+		return arrival.Sub(departure).Hours(), nil
+	},
+}
+
+var (
+	achievementRulesMu sync.RWMutex
+	achievementRules   []AchievementRule
+)
+
+// LoadAchievementRules reads the achievement rules from a YAML (or JSON) file and makes
+// them the active rule set. New badges can be added by editing the file and restarting.
+func LoadAchievementRules(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var rules []AchievementRule
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	seen := make(map[string]bool)
+	for _, rule := range rules {
+		if rule.ID == "" {
+			return fmt.Errorf("%s: achievement without an id", path)
+		}
+		if seen[rule.ID] {
+			return fmt.Errorf("%s: duplicate achievement id %q", path, rule.ID)
+		}
+		seen[rule.ID] = true
+		if _, ok := achievementMetrics[rule.Metric]; !ok {
+			return fmt.Errorf("%s: achievement %q uses unknown metric %q", path, rule.ID, rule.Metric)
+		}
+		if rule.Min == nil && rule.Max == nil {
+			return fmt.Errorf("%s: achievement %q needs a min or max", path, rule.ID)
+		}
+	}
+
+	achievementRulesMu.Lock()
+	achievementRules = rules
+	achievementRulesMu.Unlock()
+
+	slog.Info("Loaded achievement rules", "count", len(rules), "path", path)
+	return nil
+}
+
+// matches reports whether value satisfies the rule's bounds.
+func (rule AchievementRule) matches(value float64) bool {
+	if rule.Min != nil && value < *rule.Min {
+		return false
+	}
+	if rule.Max != nil && value > *rule.Max {
+		return false
+	}
+	return true
+}
+
+// queryPilotMetric runs a single-value query for one pilot.
+func queryPilotMetric(ctx context.Context, query string, pilotID int) (float64, error) {
+	var value float64
+	err := db.QueryRowContext(ctx, query, pilotID).Scan(&value)
+	return value, err
+}
+
+// evaluateAchievements checks every rule the pilot has not earned yet against the flight
+// that was just stored and records any newly earned badges.
+func evaluateAchievements(ctx context.Context, flight FlightData) error {
+	achievementRulesMu.RLock()
+	rules := achievementRules
+	achievementRulesMu.RUnlock()
+	if len(rules) == 0 {
+		return nil
+	}
+
+	pilotID := flight.User.ID
+	earned, err := earnedAchievementIDs(ctx, pilotID)
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string]float64)
+	for _, rule := range rules {
+		if earned[rule.ID] {
+			continue
+		}
+
+		value, ok := values[rule.Metric]
+		if !ok {
+			value, err = achievementMetrics[rule.Metric](ctx, pilotID, flight)
+			if err != nil {
+				return fmt.Errorf("computing %s: %w", rule.Metric, err)
+			}
+			values[rule.Metric] = value
+		}
+		if !rule.matches(value) {
+			continue
+		}
+
+		_, err := db.ExecContext(ctx, `
+			INSERT OR IGNORE INTO pilot_achievements (pilotid, achievement_id, flightid, awarded_at)
+			VALUES (?, ?, ?, ?)`,
+			pilotID, rule.ID, flight.ID, time.Now().UTC().Format(time.RFC3339))
+		if err != nil {
+			return err
+		}
+		slog.InfoContext(ctx, "Awarded achievement", "achievement", rule.ID, "pilot_id", pilotID, "pilot_name", flight.User.Name)
+	}
+	return nil
+}
+
+// earnedAchievementIDs returns the set of achievement IDs already awarded to a pilot.
+func earnedAchievementIDs(ctx context.Context, pilotID int) (map[string]bool, error) {
+	rows, err := db.QueryContext(ctx, `SELECT achievement_id FROM pilot_achievements WHERE pilotid = ?`, pilotID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	earned := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		earned[id] = true
+	}
+	return earned, rows.Err()
+}
+
+// getPilotAchievements returns the badges awarded to a pilot, most recent first.
+func getPilotAchievements(ctx context.Context, pilotID int) ([]Achievement, error) {
+	achievementRulesMu.RLock()
+	rulesByID := make(map[string]AchievementRule, len(achievementRules))
+	for _, rule := range achievementRules {
+		rulesByID[rule.ID] = rule
+	}
+	achievementRulesMu.RUnlock()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT achievement_id, flightid, awarded_at
+		FROM pilot_achievements
+		WHERE pilotid = ?
+		ORDER BY awarded_at DESC`, pilotID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	achievements := []Achievement{}
+	for rows.Next() {
+		var a Achievement
+		var flightID sql.NullInt64
+		var awardedAt string
+		if err := rows.Scan(&a.ID, &flightID, &awardedAt); err != nil {
+			return nil, err
+		}
+		a.FlightID = int(flightID.Int64)
+		if a.AwardedAt, err = parseFlightTime(awardedAt); err != nil {
+			slog.WarnContext(ctx, "Error parsing award time", "achievement", a.ID, "err", err)
+		}
+		// Badges whose rule has since been removed are still listed, under their ID.
+		a.Name = a.ID
+		if rule, ok := rulesByID[a.ID]; ok {
+			a.Name = rule.Name
+			a.Description = rule.Description
+		}
+		achievements = append(achievements, a)
+	}
+	return achievements, rows.Err()
+}
+
+// PilotAchievementsHandler returns the badges earned by the pilot in the {id} path segment.
+func PilotAchievementsHandler(w http.ResponseWriter, r *http.Request) {
+	pilotID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid pilot ID", http.StatusBadRequest)
+		return
+	}
+
+	achievements, err := getPilotAchievements(r.Context(), pilotID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error querying achievements", "pilot_id", pilotID, "err", err)
+		http.Error(w, "Error querying achievements", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(achievements)
+}
+
+// AchievementRulesHandler lists every badge that can currently be earned.
+func AchievementRulesHandler(w http.ResponseWriter, r *http.Request) {
+	achievementRulesMu.RLock()
+	rules := achievementRules
+	achievementRulesMu.RUnlock()
+	if rules == nil {
+		rules = []AchievementRule{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
@@ -0,0 +1,112 @@
+package fswebhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testAchievementRules = `
+- id: first-flight
+  name: Welcome Aboard
+  metric: total_flights
+  min: 1
+- id: butter
+  name: Butter
+  metric: landing_rate
+  min: -60
+  max: -1
+- id: streak-3
+  name: Three In A Row
+  metric: daily_streak
+  min: 3
+`
+
+func TestAchievements(t *testing.T) {
+	setupTestDB(t)
+	if _, err := db.Exec(`DELETE FROM pilot_achievements`); err != nil {
+		t.Fatalf("Failed to clear pilot_achievements table: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM pilot_achievements`)
+		achievementRules = nil
+	})
+
+	rulesFile := filepath.Join(t.TempDir(), "achievements.yaml")
+	if err := os.WriteFile(rulesFile, []byte(testAchievementRules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadAchievementRules(rulesFile); err != nil {
+		t.Fatalf("LoadAchievementRules returned error: %v", err)
+	}
+
+	// The example flight arrives on 2025-07-24; the pilot also flew the two days before.
+	arrival := time.Date(2025, 7, 24, 12, 0, 0, 0, time.UTC)
+	insertTestFlights(t,
+		testFlight{FlightID: 1, PilotID: 25104, PilotName: "Inode", Duration: time.Hour, Arrival: arrival.AddDate(0, 0, -2)},
+		testFlight{FlightID: 2, PilotID: 25104, PilotName: "Inode", Duration: time.Hour, Arrival: arrival.AddDate(0, 0, -1)},
+	)
+
+	jsonData, err := os.ReadFile(filepath.Join("testdata", "flight.completed.example.json"))
+	if err != nil {
+		t.Fatalf("Failed to read example JSON file: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/webhook/flight-completed", bytes.NewBuffer(jsonData))
+	rr := httptest.NewRecorder()
+	FlightCompletedHandler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/pilots/25104/achievements", nil)
+	req.SetPathValue("id", "25104")
+	rr = httptest.NewRecorder()
+	PilotAchievementsHandler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var achievements []Achievement
+	if err := json.NewDecoder(rr.Body).Decode(&achievements); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	got := make(map[string]Achievement)
+	for _, a := range achievements {
+		got[a.ID] = a
+	}
+	if len(got) != 2 {
+		t.Errorf("expected 2 achievements, got %+v", achievements)
+	}
+	if a, ok := got["first-flight"]; !ok || a.Name != "Welcome Aboard" || a.FlightID != 3901328 {
+		t.Errorf("expected first-flight to be awarded for flight 3901328, got %+v", a)
+	}
+	if _, ok := got["streak-3"]; !ok {
+		t.Errorf("expected streak-3 to be awarded")
+	}
+	if _, ok := got["butter"]; ok {
+		t.Errorf("did not expect butter to be awarded for a -196 fpm landing")
+	}
+}
+
+func TestLoadAchievementRulesRejectsUnknownMetric(t *testing.T) {
+	rulesFile := filepath.Join(t.TempDir(), "achievements.yaml")
+	rules := "- id: bogus\n  metric: moon_landings\n  min: 1\n"
+	if err := os.WriteFile(rulesFile, []byte(rules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadAchievementRules(rulesFile); err == nil {
+		t.Errorf("expected an error for an unknown metric")
+	}
+}
+
+func TestDefaultAchievementRules(t *testing.T) {
+	t.Cleanup(func() { achievementRules = nil })
+	if err := LoadAchievementRules(filepath.Join("..", "achievements.yaml")); err != nil {
+		t.Fatalf("default achievements.yaml is invalid: %v", err)
+	}
+}
@@ -0,0 +1,234 @@
+package fswebhook
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// AirlineLocation is the airline's configured timezone. Daily activity and streaks are
+// bucketed by calendar day in this location.
+var AirlineLocation = time.UTC
+
+// SetTimezone sets AirlineLocation from an IANA timezone name such as "America/New_York".
+func SetTimezone(name string) error {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return err
+	}
+	AirlineLocation = loc
+	return nil
+}
+
+// DailyActivity struct to hold a pilot's flying on one calendar day
+type DailyActivity struct {
+	Date    string  `json:"date"`
+	Flights int     `json:"flights"`
+	Hours   float64 `json:"hours"`
+	Level   int     `json:"level"` // 0-4 heatmap intensity, relative to the pilot's busiest day
+}
+
+// PilotActivity struct to hold a pilot's activity calendar and streaks
+type PilotActivity struct {
+	PilotID             int             `json:"pilotid"`
+	Timezone            string          `json:"timezone"`
+	CurrentDailyStreak  int             `json:"current_daily_streak"`
+	LongestDailyStreak  int             `json:"longest_daily_streak"`
+	CurrentWeeklyStreak int             `json:"current_weekly_streak"`
+	LongestWeeklyStreak int             `json:"longest_weekly_streak"`
+	MaxFlights          int             `json:"max_flights"`
+	Days                []DailyActivity `json:"days"`
+}
+
+// pilotDays aggregates a pilot's flights per local calendar day, keyed by YYYY-MM-DD.
+func pilotDays(ctx context.Context, pilotID int) (map[string]*DailyActivity, error) {
+	rows, err := db.QueryContext(ctx, `SELECT arrival_time, time FROM flights WHERE pilotid = ?`, pilotID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := make(map[string]*DailyActivity)
+	for rows.Next() {
+		var arrivalTime string
+		var seconds float64
+		if err := rows.Scan(&arrivalTime, &seconds); err != nil {
+			return nil, err
+		}
+		arrival, err := parseFlightTime(arrivalTime)
+		if err != nil {
+			slog.WarnContext(ctx, "Error parsing arrival time", "pilot_id", pilotID, "err", err)
+			continue
+		}
+		date := arrival.In(AirlineLocation).Format(time.DateOnly)
+		day, ok := days[date]
+		if !ok {
+			day = &DailyActivity{Date: date}
+			days[date] = day
+		}
+		day.Flights++
+		day.Hours += seconds / 3600
+	}
+	return days, rows.Err()
+}
+
+// localDay returns midnight of t's calendar day in AirlineLocation.
+func localDay(t time.Time) time.Time {
+	t = t.In(AirlineLocation)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, AirlineLocation)
+}
+
+// localWeek returns the start of t's reporting week. Weeks run Saturday to Saturday,
+// the same as the weekly reports.
+func localWeek(t time.Time) time.Time {
+	day := localDay(t)
+	offset := (int(day.Weekday()) - int(time.Saturday) + 7) % 7
+	return day.AddDate(0, 0, -offset)
+}
+
+// streakEndingAt counts consecutive periods with activity, stepping back from start.
+func streakEndingAt(active map[string]bool, start time.Time, step func(time.Time) time.Time) int {
+	streak := 0
+	for d := start; active[d.Format(time.DateOnly)]; d = step(d) {
+		streak++
+	}
+	return streak
+}
+
+// longestStreak returns the longest run of consecutive periods with activity.
+func longestStreak(active map[string]bool, next, prev func(time.Time) time.Time) int {
+	longest := 0
+	for key := range active {
+		d, err := time.ParseInLocation(time.DateOnly, key, AirlineLocation)
+		if err != nil {
+			continue
+		}
+		// Only count back from the last period of each run.
+		if active[next(d).Format(time.DateOnly)] {
+			continue
+		}
+		if n := streakEndingAt(active, d, prev); n > longest {
+			longest = n
+		}
+	}
+	return longest
+}
+
+func nextDay(t time.Time) time.Time  { return t.AddDate(0, 0, 1) }
+func nextWeek(t time.Time) time.Time { return t.AddDate(0, 0, 7) }
+func prevDay(t time.Time) time.Time  { return t.AddDate(0, 0, -1) }
+func prevWeek(t time.Time) time.Time { return t.AddDate(0, 0, -7) }
+
+// activeWeeks returns the set of week starts (YYYY-MM-DD) containing an active day.
+func activeWeeks(days map[string]*DailyActivity) map[string]bool {
+	weeks := make(map[string]bool)
+	for key := range days {
+		d, err := time.ParseInLocation(time.DateOnly, key, AirlineLocation)
+		if err != nil {
+			continue
+		}
+		weeks[localWeek(d).Format(time.DateOnly)] = true
+	}
+	return weeks
+}
+
+// activeDays returns the set of days (YYYY-MM-DD) with at least one flight.
+func activeDays(days map[string]*DailyActivity) map[string]bool {
+	active := make(map[string]bool, len(days))
+	for key := range days {
+		active[key] = true
+	}
+	return active
+}
+
+// currentStreak counts the streak ending in the current period, or in the previous one
+// when the pilot has not flown yet in the current period.
+func currentStreak(active map[string]bool, current time.Time, prev func(time.Time) time.Time) int {
+	if n := streakEndingAt(active, current, prev); n > 0 {
+		return n
+	}
+	return streakEndingAt(active, prev(current), prev)
+}
+
+// dailyStreakEndingAt counts the consecutive local days with at least one flight, ending on the day of t.
+func dailyStreakEndingAt(ctx context.Context, pilotID int, t time.Time) (int, error) {
+	days, err := pilotDays(ctx, pilotID)
+	if err != nil {
+		return 0, err
+	}
+	return streakEndingAt(activeDays(days), localDay(t), prevDay), nil
+}
+
+// getPilotActivity builds the activity calendar for the last numDays days along with
+// the pilot's daily and weekly streaks.
+func getPilotActivity(ctx context.Context, pilotID, numDays int, now time.Time) (PilotActivity, error) {
+	days, err := pilotDays(ctx, pilotID)
+	if err != nil {
+		return PilotActivity{}, err
+	}
+
+	daily := activeDays(days)
+	weekly := activeWeeks(days)
+	activity := PilotActivity{
+		PilotID:             pilotID,
+		Timezone:            AirlineLocation.String(),
+		CurrentDailyStreak:  currentStreak(daily, localDay(now), prevDay),
+		LongestDailyStreak:  longestStreak(daily, nextDay, prevDay),
+		CurrentWeeklyStreak: currentStreak(weekly, localWeek(now), prevWeek),
+		LongestWeeklyStreak: longestStreak(weekly, nextWeek, prevWeek),
+		Days:                make([]DailyActivity, 0, numDays),
+	}
+
+	today := localDay(now)
+	for d := today.AddDate(0, 0, 1-numDays); !d.After(today); d = nextDay(d) {
+		key := d.Format(time.DateOnly)
+		day := DailyActivity{Date: key}
+		if a, ok := days[key]; ok {
+			day = *a
+		}
+		if day.Flights > activity.MaxFlights {
+			activity.MaxFlights = day.Flights
+		}
+		activity.Days = append(activity.Days, day)
+	}
+
+	for i, day := range activity.Days {
+		if day.Flights > 0 {
+			// Spread 1..MaxFlights over levels 1-4, rounding up so the busiest day is 4.
+			activity.Days[i].Level = (day.Flights*4 + activity.MaxFlights - 1) / activity.MaxFlights
+		}
+	}
+	return activity, nil
+}
+
+// PilotActivityHandler returns a heatmap-ready activity calendar and the streaks for the
+// pilot in the {id} path segment. The optional "days" parameter sets the calendar length.
+func PilotActivityHandler(w http.ResponseWriter, r *http.Request) {
+	pilotID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid pilot ID", http.StatusBadRequest)
+		return
+	}
+
+	numDays := 365
+	if s := r.URL.Query().Get("days"); s != "" {
+		numDays, err = strconv.Atoi(s)
+		if err != nil || numDays < 1 || numDays > 3660 {
+			http.Error(w, "days must be between 1 and 3660", http.StatusBadRequest)
+			return
+		}
+	}
+
+	activity, err := getPilotActivity(r.Context(), pilotID, numDays, time.Now())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error querying pilot activity", "pilot_id", pilotID, "err", err)
+		http.Error(w, "Error querying pilot activity", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(activity)
+}
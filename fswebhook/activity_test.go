@@ -0,0 +1,73 @@
+package fswebhook
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPilotActivity(t *testing.T) {
+	setupTestDB(t)
+	if err := SetTimezone("America/New_York"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { AirlineLocation = time.UTC })
+
+	// Wednesday 2025-07-23, 20:00 in New York.
+	now := time.Date(2025, 7, 23, 20, 0, 0, 0, AirlineLocation)
+	flight := func(id int, arrival time.Time) testFlight {
+		return testFlight{FlightID: id, PilotID: 7, PilotName: "Eve", Duration: 90 * time.Minute, Arrival: arrival}
+	}
+	insertTestFlights(t,
+		// Three days in a row up to yesterday. The first lands at 23:30 local time, which
+		// is already the next day in UTC and must still count for 2025-07-20.
+		flight(1, time.Date(2025, 7, 20, 23, 30, 0, 0, AirlineLocation)),
+		flight(2, time.Date(2025, 7, 21, 10, 0, 0, 0, AirlineLocation)),
+		flight(3, time.Date(2025, 7, 22, 10, 0, 0, 0, AirlineLocation)),
+		flight(4, time.Date(2025, 7, 22, 14, 0, 0, 0, AirlineLocation)),
+		// An older four-day run, two weeks earlier.
+		flight(5, time.Date(2025, 7, 1, 10, 0, 0, 0, AirlineLocation)),
+		flight(6, time.Date(2025, 7, 2, 10, 0, 0, 0, AirlineLocation)),
+		flight(7, time.Date(2025, 7, 3, 10, 0, 0, 0, AirlineLocation)),
+		flight(8, time.Date(2025, 7, 4, 10, 0, 0, 0, AirlineLocation)),
+	)
+
+	activity, err := getPilotActivity(context.Background(), 7, 30, now)
+	if err != nil {
+		t.Fatalf("getPilotActivity returned error: %v", err)
+	}
+
+	if activity.CurrentDailyStreak != 3 {
+		t.Errorf("expected current daily streak 3, got %d", activity.CurrentDailyStreak)
+	}
+	if activity.LongestDailyStreak != 4 {
+		t.Errorf("expected longest daily streak 4, got %d", activity.LongestDailyStreak)
+	}
+	// Weeks start on Saturday: 06-28 active, 07-05 and 07-12 empty, 07-19 active.
+	if activity.CurrentWeeklyStreak != 1 {
+		t.Errorf("expected current weekly streak 1, got %d", activity.CurrentWeeklyStreak)
+	}
+	if activity.LongestWeeklyStreak != 1 {
+		t.Errorf("expected longest weekly streak 1, got %d", activity.LongestWeeklyStreak)
+	}
+	if len(activity.Days) != 30 {
+		t.Fatalf("expected 30 days, got %d", len(activity.Days))
+	}
+	if activity.MaxFlights != 2 {
+		t.Errorf("expected max flights 2, got %d", activity.MaxFlights)
+	}
+
+	days := make(map[string]DailyActivity)
+	for _, d := range activity.Days {
+		days[d.Date] = d
+	}
+	if d := days["2025-07-20"]; d.Flights != 1 || d.Hours != 1.5 || d.Level != 2 {
+		t.Errorf("unexpected activity for 2025-07-20: %+v", d)
+	}
+	if d := days["2025-07-22"]; d.Flights != 2 || d.Level != 4 {
+		t.Errorf("unexpected activity for 2025-07-22: %+v", d)
+	}
+	if d := days["2025-07-23"]; d.Flights != 0 || d.Level != 0 {
+		t.Errorf("unexpected activity for 2025-07-23: %+v", d)
+	}
+}
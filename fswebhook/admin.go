@@ -0,0 +1,52 @@
+package fswebhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// requireAdmin checks the request carries the ADMIN_TOKEN as a bearer token and writes an
+// error response if it does not. The admin API is disabled when ADMIN_TOKEN is unset.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		http.Error(w, "Admin API is disabled", http.StatusForbidden)
+		return false
+	}
+
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// pilotToken returns the bearer token that lets a pilot act for themselves, derived from the
+// ADMIN_TOKEN so that nothing has to be stored; changing the admin token revokes every one.
+// It returns "" when the admin API is disabled.
+func pilotToken(pilotID int) string {
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte("pilot:" + strconv.Itoa(pilotID)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// requirePilot checks the request carries the pilot's own token or the ADMIN_TOKEN as a bearer
+// token and writes an error response if it does not.
+func requirePilot(w http.ResponseWriter, r *http.Request, pilotID int) bool {
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token := pilotToken(pilotID); ok && token != "" && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1 {
+		return true
+	}
+	return requireAdmin(w, r)
+}
@@ -0,0 +1,164 @@
+package fswebhook
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AircraftStats struct to hold aggregated data for one aircraft type
+type AircraftStats struct {
+	AircraftICAO       string  `json:"aircraft_icao"`
+	AircraftName       string  `json:"aircraft_name"`
+	TotalFlights       int     `json:"total_flights"`
+	TotalHoursFlown    float64 `json:"total_hours_flown"`
+	TotalDistance      int     `json:"total_distance_nm"`
+	AverageLandingRate float64 `json:"average_landing_rate"`
+	FuelPerNM          float64 `json:"fuel_per_nm"`
+}
+
+// AircraftReport struct to hold the stats and leaderboards for a single aircraft type
+type AircraftReport struct {
+	AircraftStats
+	StartDate      time.Time    `json:"start_date"`
+	EndDate        time.Time    `json:"end_date"`
+	TopLandingRate []PilotStats `json:"top_landing_rate"`
+	TopDistance    []PilotStats `json:"top_distance"`
+	TopFlights     []PilotStats `json:"top_flights"`
+	TopHours       []PilotStats `json:"top_hours"`
+	TopEfficiency  []PilotStats `json:"top_fuel_efficiency"`
+}
+
+// aircraftMinFlights is the default number of flights a pilot needs in a type to be ranked for it.
+const aircraftMinFlights = 3
+
+// getAircraftStats aggregates flights per aircraft type. An empty icao returns every type.
+func getAircraftStats(ctx context.Context, start, end time.Time, icao string) ([]AircraftStats, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT
+			aircraft_icao,
+			MAX(aircraft_name),
+			COUNT(flightid) AS total_flights,
+			SUM(time) / 3600.0 AS total_hours,
+			SUM(distance) AS total_distance,
+			AVG(landing_rate) AS avg_landing_rate,
+			SUM(CASE WHEN distance > 0 AND fuel_used > 0 THEN fuel_used END) * 1.0 /
+				SUM(CASE WHEN distance > 0 AND fuel_used > 0 THEN distance END) AS fuel_per_nm
+		FROM flights
+		WHERE datetime(arrival_time) >= datetime(?) AND datetime(arrival_time) < datetime(?)
+			AND aircraft_icao IS NOT NULL AND aircraft_icao != ''
+			AND (? = '' OR aircraft_icao = ?)
+		GROUP BY aircraft_icao
+		ORDER BY total_flights DESC`,
+		sqlTime(start), sqlTime(end), icao, icao)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []AircraftStats
+	for rows.Next() {
+		var as AircraftStats
+		var fuelPerNM sql.NullFloat64
+		if err := rows.Scan(&as.AircraftICAO, &as.AircraftName, &as.TotalFlights, &as.TotalHoursFlown,
+			&as.TotalDistance, &as.AverageLandingRate, &fuelPerNM); err != nil {
+			slog.Error("Error scanning aircraft stats", "err", err)
+			return nil, err
+		}
+		as.FuelPerNM = fuelPerNM.Float64
+		stats = append(stats, as)
+	}
+	return stats, rows.Err()
+}
+
+// AircraftHandler returns flights, hours, distance, landing and fuel stats for every aircraft type flown.
+func AircraftHandler(w http.ResponseWriter, r *http.Request) {
+	start, end, err := periodFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stats, err := getAircraftStats(r.Context(), start, end, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if stats == nil {
+		stats = []AircraftStats{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// AircraftTypeHandler returns the stats for a single aircraft type along with its top pilots,
+// e.g. /aircraft/A320?period=week for the best A320 landers of the week.
+func AircraftTypeHandler(w http.ResponseWriter, r *http.Request) {
+	icao := strings.ToUpper(r.PathValue("icao"))
+
+	start, end, err := periodFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	minFlights := aircraftMinFlights
+	if s := r.URL.Query().Get("min_flights"); s != "" {
+		minFlights, err = strconv.Atoi(s)
+		if err != nil || minFlights < 1 {
+			http.Error(w, "min_flights must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	stats, err := getAircraftStats(r.Context(), start, end, icao)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(stats) == 0 {
+		http.Error(w, "No flights found for aircraft "+icao, http.StatusNotFound)
+		return
+	}
+
+	report := AircraftReport{
+		AircraftStats: stats[0],
+		StartDate:     start,
+		EndDate:       end,
+	}
+
+	categories := []struct {
+		orderBy string
+		dest    *[]PilotStats
+	}{
+		{"avg_landing_rate DESC", &report.TopLandingRate},
+		{"total_distance DESC", &report.TopDistance},
+		{"total_flights DESC", &report.TopFlights},
+		{"total_hours DESC", &report.TopHours},
+		{efficiencyOrder, &report.TopEfficiency},
+	}
+	for _, c := range categories {
+		*c.dest, err = queryTopPilots(r.Context(), topPilotsQuery{
+			Start:        start,
+			End:          end,
+			OrderBy:      c.orderBy,
+			AircraftICAO: icao,
+			RequireFuel:  c.orderBy == efficiencyOrder,
+			MinFlights:   minFlights,
+			Limit:        LeaderboardSettings.Size,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,84 @@
+package fswebhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAircraftHandlers(t *testing.T) {
+	setupTestDB(t)
+
+	arrival := time.Now().UTC().Add(-2 * time.Hour)
+	var flights []testFlight
+	for i := 0; i < 3; i++ {
+		flights = append(flights,
+			testFlight{FlightID: 100 + i, PilotID: 1, PilotName: "Alice", LandingRate: -50, Distance: 400,
+				Duration: time.Hour, AircraftICAO: "A320", AircraftName: "Airbus A320", DepartureICAO: "KJFK",
+				ArrivalICAO: "KBOS", FuelUsed: 4000, Arrival: arrival},
+			testFlight{FlightID: 200 + i, PilotID: 2, PilotName: "Bob", LandingRate: -250, Distance: 600,
+				Duration: 2 * time.Hour, AircraftICAO: "A320", AircraftName: "Airbus A320", DepartureICAO: "KBOS",
+				ArrivalICAO: "KJFK", FuelUsed: 8000, Arrival: arrival},
+		)
+	}
+	flights = append(flights, testFlight{FlightID: 300, PilotID: 1, PilotName: "Alice", LandingRate: -100,
+		Distance: 100, Duration: time.Hour, AircraftICAO: "C172", AircraftName: "Cessna 172",
+		DepartureICAO: "KBOS", ArrivalICAO: "KPVD", FuelUsed: 10, Arrival: arrival})
+	insertTestFlights(t, flights...)
+
+	rr := httptest.NewRecorder()
+	AircraftHandler(rr, httptest.NewRequest(http.MethodGet, "/aircraft", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var stats []AircraftStats
+	if err := json.NewDecoder(rr.Body).Decode(&stats); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 aircraft types, got %d", len(stats))
+	}
+	a320 := stats[0]
+	if a320.AircraftICAO != "A320" || a320.TotalFlights != 6 {
+		t.Errorf("expected A320 with 6 flights first, got %+v", a320)
+	}
+	if a320.TotalDistance != 3000 {
+		t.Errorf("expected total distance 3000, got %d", a320.TotalDistance)
+	}
+	if a320.TotalHoursFlown != 9 {
+		t.Errorf("expected 9 hours flown, got %f", a320.TotalHoursFlown)
+	}
+	if a320.FuelPerNM != 12 {
+		t.Errorf("expected 12 fuel per nm, got %f", a320.FuelPerNM)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/aircraft/a320", nil)
+	req.SetPathValue("icao", "a320")
+	rr = httptest.NewRecorder()
+	AircraftTypeHandler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var report AircraftReport
+	if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(report.TopLandingRate) != 2 || report.TopLandingRate[0].PilotName != "Alice" {
+		t.Errorf("expected Alice to lead the A320 landing rate board, got %+v", report.TopLandingRate)
+	}
+	if report.TopLandingRate[0].TotalFlights != 3 {
+		t.Errorf("expected only A320 flights to be counted, got %d", report.TopLandingRate[0].TotalFlights)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/aircraft/B744", nil)
+	req.SetPathValue("icao", "B744")
+	rr = httptest.NewRecorder()
+	AircraftTypeHandler(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown aircraft, got %v", rr.Code)
+	}
+}
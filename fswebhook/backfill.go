@@ -0,0 +1,93 @@
+package fswebhook
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// BackfillResult struct to hold what a backfill recomputed
+type BackfillResult struct {
+	GroupFlights     int `json:"group_flights"`
+	FlightsEvaluated int `json:"flights_evaluated"`
+}
+
+// storedFlights loads the flights that arrived since the given time, oldest first, in the
+// shape the webhook delivers them.
+func storedFlights(ctx context.Context, since time.Time) ([]FlightData, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT flightid, pilotid, pilotname, landing_rate, distance, aircraft_icao, aircraft_name,
+			departure_icao, arrival_icao, fuel_used, departure_time, arrival_time
+		FROM flights
+		WHERE datetime(arrival_time) >= datetime(?)
+		ORDER BY datetime(arrival_time), flightid`, sqlTime(since))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var flights []FlightData
+	for rows.Next() {
+		var f FlightData
+		var landingRate, distance float64
+		var departure, arrival string
+		if err := rows.Scan(&f.ID, &f.User.ID, &f.User.Name, &landingRate, &distance, &f.Aircraft.ICAO, &f.Aircraft.Name,
+			&f.Departure.Airport.ICAO, &f.Arrival.Airport.ICAO, &f.FuelBurnt, &departure, &arrival); err != nil {
+			return nil, err
+		}
+		f.Arrival.LandingRate = int(landingRate)
+		f.Distance.NM = int(distance)
+		// Achievement metrics read the times as RFC 3339, whichever format they were stored in.
+		for _, t := range []struct {
+			stored string
+			dest   *string
+		}{{departure, &f.Departure.DateTime}, {arrival, &f.Arrival.DateTime}} {
+			parsed, err := parseFlightTime(t.stored)
+			if err != nil {
+				return nil, fmt.Errorf("flight %d: %w", f.ID, err)
+			}
+			*t.dest = parsed.Format(time.RFC3339)
+		}
+		flights = append(flights, f)
+	}
+	return flights, rows.Err()
+}
+
+// Backfill recomputes what is normally derived as each flight arrives through the webhook,
+// for the flights that arrived since the given time: group flights, event attendance and
+// achievements. Flights imported in bulk, or stored before a feature existed, only get these
+// from a backfill. Group flights older than the detector job looks back are marked as
+// announced, so the server does not post the whole history to Discord.
+func Backfill(ctx context.Context, since time.Time) (BackfillResult, error) {
+	var result BackfillResult
+	var err error
+	if result.GroupFlights, err = detectGroupFlights(ctx, since, "", ""); err != nil {
+		return result, fmt.Errorf("detecting group flights: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, `
+		INSERT OR IGNORE INTO sent_notifications (key, sent_at)
+		SELECT 'group_flight:' || id, ? FROM group_flights WHERE datetime(last_arrival) < datetime(?)`,
+		time.Now().UTC().Format(time.RFC3339), sqlTime(time.Now().Add(-groupDetectorLookback))); err != nil {
+		return result, fmt.Errorf("marking group flights announced: %w", err)
+	}
+	if err := matchEventAttendance(ctx, 0, 0, since); err != nil {
+		return result, fmt.Errorf("matching event attendance: %w", err)
+	}
+
+	flights, err := storedFlights(ctx, since)
+	if err != nil {
+		return result, err
+	}
+	for _, flight := range flights {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		if err := evaluateAchievements(ctx, flight); err != nil {
+			slog.WarnContext(ctx, "Error evaluating achievements", "flight_id", flight.ID, "err", err)
+			continue
+		}
+		result.FlightsEvaluated++
+	}
+	return result, nil
+}
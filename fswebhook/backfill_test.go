@@ -0,0 +1,57 @@
+package fswebhook
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBackfill(t *testing.T) {
+	setupTestDB(t)
+	for _, table := range []string{"group_flights", "group_flight_members", "sent_notifications"} {
+		if _, err := db.Exec(`DELETE FROM ` + table); err != nil {
+			t.Fatalf("Failed to clear %s table: %v", table, err)
+		}
+	}
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM group_flights`)
+		db.Exec(`DELETE FROM group_flight_members`)
+		db.Exec(`DELETE FROM sent_notifications`)
+	})
+
+	// One group flight last month, as if imported in bulk, and one that landed an hour ago.
+	now := time.Now().UTC().Truncate(time.Second)
+	insertTestGroupFlight(t, 100, 1, 10, 4, "KJFK", "KBOS", now.AddDate(0, -1, 0))
+	insertTestGroupFlight(t, 200, 1, 10, 4, "EGLL", "EDDF", now.Add(-time.Hour))
+
+	result, err := Backfill(context.Background(), time.Time{})
+	if err != nil {
+		t.Fatalf("Backfill returned error: %v", err)
+	}
+	if result.GroupFlights != 2 || result.FlightsEvaluated != 10 {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	// Only the recent group flight is left for the server to announce.
+	var unannounced []string
+	rows, err := db.Query(`
+		SELECT departure_icao FROM group_flights
+		WHERE 'group_flight:' || id NOT IN (SELECT key FROM sent_notifications)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var dep string
+		rows.Scan(&dep)
+		unannounced = append(unannounced, dep)
+	}
+	if len(unannounced) != 1 || unannounced[0] != "EGLL" {
+		t.Errorf("expected only the recent group flight left to announce, got %v", unannounced)
+	}
+
+	// Running it again finds nothing new.
+	if result, err = Backfill(context.Background(), time.Time{}); err != nil || result.GroupFlights != 0 {
+		t.Errorf("expected no new group flights on a second run, got %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,327 @@
+package fswebhook
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DatabasePath is the SQLite database opened by InitDB.
+var DatabasePath = "./fshub.db"
+
+// IngestOptions sets the thresholds flights are validated against before they are stored.
+type IngestOptions struct {
+	MinFlightDuration time.Duration `yaml:"min_flight_duration"` // shorter flights are rejected
+	MaxGroundSpeed    float64       `yaml:"max_ground_speed"`    // knots averaged over the flight; 0 disables
+	MinDistanceRatio  float64       `yaml:"min_distance_ratio"`  // least distance flown per great-circle nm; 0 disables
+	MaxDistanceRatio  float64       `yaml:"max_distance_ratio"`  // most distance flown per great-circle nm; 0 disables
+}
+
+// IngestSettings are the server-wide ingest options.
+var IngestSettings = IngestOptions{
+	MinFlightDuration: 5 * time.Minute,
+	MaxGroundSpeed:    1200,
+	MinDistanceRatio:  0.9,
+	MaxDistanceRatio:  5,
+}
+
+// Validate checks the options are within sensible bounds.
+func (o IngestOptions) Validate() error {
+	if o.MinFlightDuration < 0 || o.MinFlightDuration > 24*time.Hour {
+		return fmt.Errorf("ingest minimum flight duration must be between 0 and 24h, got %v", o.MinFlightDuration)
+	}
+	if o.MaxGroundSpeed < 0 {
+		return fmt.Errorf("ingest maximum ground speed must not be negative, got %g", o.MaxGroundSpeed)
+	}
+	if o.MinDistanceRatio < 0 || o.MinDistanceRatio > 1 {
+		return fmt.Errorf("ingest minimum distance ratio must be between 0 and 1, got %g", o.MinDistanceRatio)
+	}
+	if o.MaxDistanceRatio != 0 && o.MaxDistanceRatio < 1 {
+		return fmt.Errorf("ingest maximum distance ratio must be at least 1, or 0 to disable it, got %g", o.MaxDistanceRatio)
+	}
+	return nil
+}
+
+// LeaderboardOptions sets the shape of the weekly top pilot boards.
+type LeaderboardOptions struct {
+	MinFlights int `yaml:"min_flights"` // flights a pilot needs in the week to be ranked
+	Size       int `yaml:"size"`        // pilots listed per board
+	Weeks      int `yaml:"weeks"`       // weeks served by /flights
+}
+
+// LeaderboardSettings are the server-wide leaderboard options.
+var LeaderboardSettings = LeaderboardOptions{
+	MinFlights: 10,
+	Size:       10,
+	Weeks:      3,
+}
+
+// Validate checks the options are within sensible bounds.
+func (o LeaderboardOptions) Validate() error {
+	if o.MinFlights < 1 {
+		return fmt.Errorf("leaderboard minimum flights must be at least 1, got %d", o.MinFlights)
+	}
+	if o.Size < 1 || o.Size > 100 {
+		return fmt.Errorf("leaderboard size must be between 1 and 100, got %d", o.Size)
+	}
+	if o.Weeks < 1 || o.Weeks > 52 {
+		return fmt.Errorf("leaderboard weeks must be between 1 and 52, got %d", o.Weeks)
+	}
+	return nil
+}
+
+// defaultConfigFile is read when present and no other file is named.
+const defaultConfigFile = "fshub.yaml"
+
+// envPrefix prefixes the environment variable overriding each setting, named after its flag:
+// -group-window is FSHUB_GROUP_WINDOW.
+const envPrefix = "FSHUB_"
+
+// Config struct to hold the server settings
+type Config struct {
+	Database        string        `yaml:"database"`
+	Listen          string        `yaml:"listen"` // plain HTTP address, used when TLS is off
+	TLS             TLSConfig     `yaml:"tls"`
+	Webhook         bool          `yaml:"webhook"`
+	AirlineID       int           `yaml:"airline_id"`
+	Timezone        string        `yaml:"timezone"`
+	Achievements    string        `yaml:"achievements"`
+	LogLevel        slog.Level    `yaml:"log_level"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+	Ingest       IngestOptions      `yaml:"ingest"`
+	Leaderboard  LeaderboardOptions `yaml:"leaderboard"`
+	GroupFlights GroupFlightConfig  `yaml:"group_flights"`
+
+	// Secrets are only taken from the environment so they stay out of config files.
+	// WEBHOOK_SECRET and ADMIN_TOKEN are read where they are checked.
+	DiscordWebhookURL string `yaml:"-"`
+}
+
+// TLSConfig struct to hold the automatic certificate settings
+type TLSConfig struct {
+	Hostname  string `yaml:"hostname"` // TLS is on when set
+	CertCache string `yaml:"cert_cache"`
+	HTTPAddr  string `yaml:"http_addr"` // ACME challenges and plain HTTP
+	HTTPSAddr string `yaml:"https_addr"`
+}
+
+// GroupFlightConfig struct to hold the group flight settings
+type GroupFlightConfig struct {
+	GroupFlightOptions `yaml:",inline"`
+	Leaders            []int `yaml:"leaders"` // pilot IDs registered as group flight leaders on the first start with any
+}
+
+// DefaultConfig returns the settings the server runs with when nothing is configured.
+func DefaultConfig() Config {
+	return Config{
+		Database: DatabasePath,
+		Listen:   "0.0.0.0:8080",
+		TLS: TLSConfig{
+			CertCache: "/etc/certs",
+			HTTPAddr:  ":80",
+			HTTPSAddr: ":443",
+		},
+		AirlineID:       6076,
+		Timezone:        "UTC",
+		Achievements:    "achievements.yaml",
+		LogLevel:        slog.LevelInfo,
+		ShutdownTimeout: 25 * time.Second,
+		Ingest:          IngestSettings,
+		Leaderboard:     LeaderboardSettings,
+		GroupFlights:    GroupFlightConfig{GroupFlightOptions: GroupFlightSettings},
+	}
+}
+
+// pilotIDList is a flag.Value for a comma-separated list of pilot IDs.
+type pilotIDList []int
+
+func (l *pilotIDList) String() string {
+	ids := make([]string, len(*l))
+	for i, id := range *l {
+		ids[i] = strconv.Itoa(id)
+	}
+	return strings.Join(ids, ",")
+}
+
+func (l *pilotIDList) Set(s string) error {
+	var ids []int
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		id, err := strconv.Atoi(field)
+		if err != nil {
+			return fmt.Errorf("invalid pilot ID %q", field)
+		}
+		ids = append(ids, id)
+	}
+	*l = ids
+	return nil
+}
+
+// RegisterFlags defines a flag for every setting, bound to c. Each can also be set through
+// its FSHUB_ environment variable.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Database, "database", c.Database, "SQLite database file")
+	fs.StringVar(&c.Listen, "listen", c.Listen, "Address to serve HTTP on when TLS is off")
+	fs.StringVar(&c.TLS.Hostname, "hostname", c.TLS.Hostname, "Hostname for TLS certificate; enables TLS")
+	fs.StringVar(&c.TLS.CertCache, "cert-cache", c.TLS.CertCache, "Directory caching TLS certificates")
+	fs.StringVar(&c.TLS.HTTPAddr, "http-addr", c.TLS.HTTPAddr, "Address answering ACME challenges when TLS is on")
+	fs.StringVar(&c.TLS.HTTPSAddr, "https-addr", c.TLS.HTTPSAddr, "Address to serve HTTPS on when TLS is on")
+	fs.BoolVar(&c.Webhook, "webhook", c.Webhook, "Enable the flight completed webhook")
+	fs.IntVar(&c.AirlineID, "airline-id", c.AirlineID, "FSHub airline ID")
+	fs.StringVar(&c.Timezone, "timezone", c.Timezone, "Airline timezone used for daily activity and streaks")
+	fs.StringVar(&c.Achievements, "achievements", c.Achievements, "Achievement rules file")
+	fs.TextVar(&c.LogLevel, "log-level", c.LogLevel, "Minimum level logged: debug, info, warn or error; debug includes redacted webhook payloads")
+	fs.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", c.ShutdownTimeout, "How long to wait for requests and notifications to finish when stopping")
+	fs.DurationVar(&c.Ingest.MinFlightDuration, "min-flight-duration", c.Ingest.MinFlightDuration, "Shortest flight stored")
+	fs.Float64Var(&c.Ingest.MaxGroundSpeed, "max-ground-speed", c.Ingest.MaxGroundSpeed, "Highest average ground speed in knots a stored flight may have; 0 disables the check")
+	fs.Float64Var(&c.Ingest.MinDistanceRatio, "min-distance-ratio", c.Ingest.MinDistanceRatio, "Least distance flown per great-circle mile between the airports; 0 disables the check")
+	fs.Float64Var(&c.Ingest.MaxDistanceRatio, "max-distance-ratio", c.Ingest.MaxDistanceRatio, "Most distance flown per great-circle mile between the airports; 0 disables the check")
+	fs.IntVar(&c.Leaderboard.MinFlights, "leaderboard-min-flights", c.Leaderboard.MinFlights, "Flights a pilot needs in a week to be ranked")
+	fs.IntVar(&c.Leaderboard.Size, "leaderboard-size", c.Leaderboard.Size, "Pilots listed per leaderboard")
+	fs.IntVar(&c.Leaderboard.Weeks, "leaderboard-weeks", c.Leaderboard.Weeks, "Weeks of leaderboards served by /flights")
+	fs.Var((*pilotIDList)(&c.GroupFlights.Leaders), "group-leaders", "Comma-separated pilot IDs of the first group flight leaders, registered once")
+	fs.DurationVar(&c.GroupFlights.Window, "group-window", c.GroupFlights.Window, "Maximum gap between arrivals in the same group flight")
+	fs.IntVar(&c.GroupFlights.MinPilots, "group-min-pilots", c.GroupFlights.MinPilots, "Minimum number of pilots in a group flight")
+	fs.IntVar(&c.GroupFlights.Top, "group-top", c.GroupFlights.Top, "Number of top landings listed per group flight")
+}
+
+// envName is the environment variable overriding the setting behind a flag.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// LoadConfig builds the configuration from, in increasing precedence: the defaults, the YAML
+// file named by -config or FSHUB_CONFIG (fshub.yaml if present), FSHUB_ environment
+// variables and the command-line flags in args. The settings are registered on fs, which may
+// carry flags of its own, and the result is validated.
+func LoadConfig(fs *flag.FlagSet, args []string) (Config, error) {
+	cfg := DefaultConfig()
+	cfg.RegisterFlags(fs)
+	path := fs.String("config", os.Getenv(envName("config")), "YAML configuration file (default "+defaultConfigFile+" if present)")
+
+	// Parse once to find the file, then again after loading it so flags win over it.
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+	cfg = DefaultConfig()
+	if err := cfg.loadFile(*path); err != nil {
+		return cfg, err
+	}
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if value, ok := os.LookupEnv(envName(f.Name)); ok && f.Name != "config" && err == nil {
+			if setErr := f.Value.Set(value); setErr != nil {
+				err = fmt.Errorf("invalid %s: %w", envName(f.Name), setErr)
+			}
+		}
+	})
+	if err != nil {
+		return cfg, err
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+	cfg.DiscordWebhookURL = os.Getenv("DISCORD_WEBHOOK_URL")
+	return cfg, cfg.Validate()
+}
+
+// loadFile reads the YAML file at path over c. Unknown keys are rejected so a typo does not
+// silently leave a default in place. A missing default file is not an error.
+func (c *Config) loadFile(path string) error {
+	explicit := path != ""
+	if !explicit {
+		path = defaultConfigFile
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) && !explicit {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate reports every invalid setting at once.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	checkAddr := func(name, addr string) {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	if c.Database == "" {
+		errs = append(errs, errors.New("database must be set"))
+	}
+	if c.TLS.Hostname == "" {
+		checkAddr("listen", c.Listen)
+	} else {
+		checkAddr("tls.http_addr", c.TLS.HTTPAddr)
+		checkAddr("tls.https_addr", c.TLS.HTTPSAddr)
+		if c.TLS.CertCache == "" {
+			errs = append(errs, errors.New("tls.cert_cache must be set when TLS is on"))
+		}
+	}
+	if c.AirlineID < 1 {
+		errs = append(errs, fmt.Errorf("airline_id must be positive, got %d", c.AirlineID))
+	}
+	if _, err := time.LoadLocation(c.Timezone); err != nil {
+		errs = append(errs, fmt.Errorf("timezone: %w", err))
+	}
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("shutdown_timeout must be positive, got %v", c.ShutdownTimeout))
+	}
+	check(c.Ingest.Validate())
+	check(c.Leaderboard.Validate())
+	check(c.GroupFlights.Validate())
+	for _, id := range c.GroupFlights.Leaders {
+		if id < 1 {
+			errs = append(errs, fmt.Errorf("group_flights.leaders: invalid pilot ID %d", id))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Apply makes c the server-wide settings. It expects a validated configuration.
+func (c Config) Apply() error {
+	if err := SetTimezone(c.Timezone); err != nil {
+		return err
+	}
+	DatabasePath = c.Database
+	IngestSettings = c.Ingest
+	LeaderboardSettings = c.Leaderboard
+	GroupFlightSettings = c.GroupFlights.GroupFlightOptions
+	CertCacheDir = ""
+	FeedAuthority = defaultFeedAuthority
+	if c.TLS.Hostname != "" {
+		CertCacheDir = c.TLS.CertCache
+		FeedAuthority = c.TLS.Hostname
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package fswebhook
+
+import (
+	"flag"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "fshub.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func loadTestConfig(args ...string) (Config, error) {
+	return LoadConfig(flag.NewFlagSet("test", flag.ContinueOnError), args)
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfigFile(t, `
+database: /data/fshub.db
+log_level: debug
+tls:
+  hostname: example.com
+ingest:
+  min_flight_duration: 10m
+leaderboard:
+  size: 25
+group_flights:
+  window: 45m
+  leaders: [1, 2]
+`)
+	t.Setenv("FSHUB_LEADERBOARD_SIZE", "20")
+	t.Setenv("FSHUB_GROUP_LEADERS", "3")
+
+	cfg, err := loadTestConfig("-config", path, "-group-leaders", "4,5")
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	// The file overrides the defaults, the environment the file and flags the environment.
+	if cfg.Database != "/data/fshub.db" || cfg.LogLevel != slog.LevelDebug || cfg.TLS.Hostname != "example.com" {
+		t.Errorf("expected settings from the file, got %+v", cfg)
+	}
+	if cfg.Ingest.MinFlightDuration != 10*time.Minute || cfg.GroupFlights.Window != 45*time.Minute {
+		t.Errorf("expected durations from the file, got %v and %v", cfg.Ingest.MinFlightDuration, cfg.GroupFlights.Window)
+	}
+	if cfg.Leaderboard.Size != 20 {
+		t.Errorf("expected the environment to override the leaderboard size, got %d", cfg.Leaderboard.Size)
+	}
+	if !reflect.DeepEqual(cfg.GroupFlights.Leaders, []int{4, 5}) {
+		t.Errorf("expected the flag to override the group leaders, got %v", cfg.GroupFlights.Leaders)
+	}
+	if cfg.Leaderboard.MinFlights != 10 || cfg.AirlineID != 6076 || cfg.TLS.HTTPSAddr != ":443" {
+		t.Errorf("expected defaults for unset settings, got %+v", cfg)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{name: "unknown key", file: "databse: typo.db", want: "field databse not found"},
+		{name: "bad environment value", env: map[string]string{"FSHUB_GROUP_MIN_PILOTS": "many"}, want: "invalid FSHUB_GROUP_MIN_PILOTS"},
+		{name: "missing named file", args: []string{"-config", "missing.yaml"}, want: "missing.yaml"},
+		{name: "invalid ingest threshold", args: []string{"-min-distance-ratio", "1.5"}, want: "ingest minimum distance ratio must be between 0 and 1, got 1.5"},
+		{
+			name: "invalid settings",
+			file: "listen: nowhere\ntimezone: Mars/Olympus_Mons\nleaderboard:\n  size: 0",
+			want: "listen: address nowhere: missing port in address\ntimezone: unknown time zone Mars/Olympus_Mons\nleaderboard size must be between 1 and 100, got 0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			args := tt.args
+			if tt.file != "" {
+				args = append(args, "-config", writeConfigFile(t, tt.file))
+			}
+			_, err := loadTestConfig(args...)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestConfigApply(t *testing.T) {
+	saved := DefaultConfig()
+	t.Cleanup(func() {
+		saved.Apply()
+		CertCacheDir = ""
+	})
+
+	cfg := DefaultConfig()
+	cfg.TLS.Hostname = "example.com"
+	cfg.Leaderboard.Weeks = 5
+	cfg.GroupFlights.MinPilots = 3
+	cfg.Timezone = "Europe/London"
+	if err := cfg.Apply(); err != nil {
+		t.Fatalf("Failed to apply config: %v", err)
+	}
+	if CertCacheDir != "/etc/certs" || FeedAuthority != "example.com" || LeaderboardSettings.Weeks != 5 || GroupFlightSettings.MinPilots != 3 || AirlineLocation.String() != "Europe/London" {
+		t.Errorf("expected the settings applied, got %q %q %+v %+v %v", CertCacheDir, FeedAuthority, LeaderboardSettings, GroupFlightSettings, AirlineLocation)
+	}
+}
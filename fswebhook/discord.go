@@ -0,0 +1,205 @@
+package fswebhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Embed colours for the Discord notifications.
+const (
+	discordColorAirline  = 0xF1C40F
+	discordColorPersonal = 0x3498DB
+	discordColorGroup    = 0x2ECC71
+	discordColorWeekly   = 0x9B59B6
+)
+
+// DiscordNotifier posts notifications to a Discord channel webhook as embeds.
+type DiscordNotifier struct {
+	URL         string
+	Client      *http.Client
+	MaxAttempts int
+	Backoff     time.Duration // wait before the first retry, doubled after each failure
+}
+
+// NewDiscordNotifier returns a notifier posting to the given Discord webhook URL.
+func NewDiscordNotifier(url string) *DiscordNotifier {
+	return &DiscordNotifier{
+		URL:         url,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts: 5,
+		Backoff:     2 * time.Second,
+	}
+}
+
+type discordMessage struct {
+	Embeds []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields,omitempty"`
+	Timestamp   string         `json:"timestamp,omitempty"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+// Run posts every notification received until the channel is closed or ctx is cancelled.
+func (d *DiscordNotifier) Run(ctx context.Context, notifications <-chan Notification) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n, ok := <-notifications:
+			if !ok {
+				return
+			}
+			if err := d.Send(ctx, n); err != nil {
+				slog.Error("Error posting notification to Discord", "type", n.Type, "notification_id", n.ID, "err", err)
+			}
+		}
+	}
+}
+
+// Send posts a notification, retrying with exponential backoff while Discord is unavailable
+// or rate limiting. Notifications Discord does not show, such as every stored flight, are skipped.
+func (d *DiscordNotifier) Send(ctx context.Context, n Notification) error {
+	embed := discordEmbedFor(n)
+	if embed == nil {
+		return nil
+	}
+	body, err := json.Marshal(discordMessage{Embeds: []discordEmbed{*embed}})
+	if err != nil {
+		return err
+	}
+
+	retry := retryPolicy{MaxAttempts: d.MaxAttempts, Backoff: d.Backoff}
+	return retry.do(ctx, func(int) error {
+		_, err := postJSON(ctx, d.Client, d.URL, body, nil)
+		return err
+	})
+}
+
+// discordEmbedFor renders a notification as a Discord embed, or returns nil for
+// notifications not posted to Discord.
+func discordEmbedFor(n Notification) *discordEmbed {
+	timestamp := n.Time.Format(time.RFC3339)
+	switch data := n.Data.(type) {
+	case RecordBroken:
+		embed := &discordEmbed{
+			Title:     "New personal best",
+			Color:     discordColorPersonal,
+			Timestamp: timestamp,
+			Description: fmt.Sprintf("**%s** set a new %s of **%s** (previously %s)", data.PilotName,
+				recordMetricName(data.Metric), formatRecordValue(data.Metric, data.Value), formatRecordValue(data.Metric, data.Previous)),
+			Fields: []discordField{
+				{Name: "Route", Value: data.DepartureICAO + " → " + data.ArrivalICAO, Inline: true},
+				{Name: "Aircraft", Value: data.AircraftName, Inline: true},
+			},
+		}
+		if data.Scope == RecordAirline {
+			embed.Title = "New airline record!"
+			embed.Color = discordColorAirline
+		}
+		return embed
+
+	case GroupFlightDetail:
+		// Only post groups once they are complete, not as soon as they are detected.
+		if n.Type != NotificationGroupFlightCompleted {
+			return nil
+		}
+		description := fmt.Sprintf("%d pilots flew together", data.TotalPilots)
+		if data.LeaderName != "" {
+			description += ", led by **" + data.LeaderName + "**"
+		}
+		var landings []string
+		for _, p := range data.Pilots {
+			if p.Rank > 5 {
+				break
+			}
+			landings = append(landings, fmt.Sprintf("%d. %s: %.0f fpm (%s)", p.Rank, p.PilotName, p.LandingRate, p.AircraftName))
+		}
+		embed := &discordEmbed{
+			Title:       fmt.Sprintf("Group flight: %s → %s", data.DepartureICAO, data.ArrivalICAO),
+			Description: description,
+			Color:       discordColorGroup,
+			Timestamp:   timestamp,
+			Fields: []discordField{
+				{Name: "Top landings", Value: strings.Join(landings, "\n")},
+				{Name: "Average landing", Value: fmt.Sprintf("%.0f fpm", data.AverageLandingRate), Inline: true},
+			},
+		}
+		if f := data.Formation; f != nil {
+			embed.Fields = append(embed.Fields,
+				discordField{Name: "Arrival spread", Value: fmt.Sprintf("%d min", f.ArrivalSpreadSeconds/60), Inline: true},
+				discordField{Name: "Formation score", Value: fmt.Sprintf("%.1f", f.Score), Inline: true})
+		}
+		return embed
+
+	case WeeklyReport:
+		embed := &discordEmbed{
+			Title: fmt.Sprintf("Weekly leaderboard: %s to %s", data.StartDate.Format("Jan 2"),
+				data.EndDate.AddDate(0, 0, -1).Format("Jan 2")),
+			Color:     discordColorWeekly,
+			Timestamp: timestamp,
+		}
+		for _, board := range []struct {
+			name   string
+			pilots []PilotStats
+			value  func(PilotStats) string
+		}{
+			{"Softest landings", data.TopLandingRate, func(p PilotStats) string { return fmt.Sprintf("%.0f fpm", p.AverageLandingRate) }},
+			{"Most distance", data.TopDistance, func(p PilotStats) string { return fmt.Sprintf("%d nm", p.TotalDistance) }},
+			{"Most flights", data.TopFlights, func(p PilotStats) string { return fmt.Sprintf("%d flights", p.TotalFlights) }},
+			{"Most hours", data.TopHours, func(p PilotStats) string { return fmt.Sprintf("%.1f h", p.TotalHoursFlown) }},
+		} {
+			var lines []string
+			for i, p := range board.pilots {
+				if i == 3 {
+					break
+				}
+				lines = append(lines, fmt.Sprintf("%d. %s: %s", i+1, p.PilotName, board.value(p)))
+			}
+			if len(lines) == 0 {
+				lines = []string{"No qualifying pilots"}
+			}
+			embed.Fields = append(embed.Fields, discordField{Name: board.name, Value: strings.Join(lines, "\n"), Inline: true})
+		}
+		return embed
+	}
+	return nil
+}
+
+func recordMetricName(metric string) string {
+	switch metric {
+	case "landing_rate":
+		return "softest landing"
+	case "distance":
+		return "longest flight"
+	case "flight_hours":
+		return "longest flight time"
+	}
+	return metric
+}
+
+func formatRecordValue(metric string, value float64) string {
+	switch metric {
+	case "landing_rate":
+		return fmt.Sprintf("%.0f fpm", value)
+	case "distance":
+		return fmt.Sprintf("%.0f nm", value)
+	case "flight_hours":
+		return fmt.Sprintf("%.1f h", value)
+	}
+	return fmt.Sprintf("%.1f", value)
+}
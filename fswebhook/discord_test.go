@@ -0,0 +1,124 @@
+package fswebhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// discordStandIn records the messages posted to it, answering with the given statuses in turn
+// and 204 No Content once they run out.
+type discordStandIn struct {
+	mu       sync.Mutex
+	statuses []int
+	messages []discordMessage
+	attempts int
+}
+
+func (s *discordStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts++
+	if len(s.statuses) > 0 {
+		status := s.statuses[0]
+		s.statuses = s.statuses[1:]
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "0.01")
+		}
+		w.WriteHeader(status)
+		return
+	}
+	var msg discordMessage
+	json.NewDecoder(r.Body).Decode(&msg)
+	s.messages = append(s.messages, msg)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newTestDiscordNotifier(t *testing.T, statuses ...int) (*DiscordNotifier, *discordStandIn) {
+	t.Helper()
+	standIn := &discordStandIn{statuses: statuses}
+	server := httptest.NewServer(standIn)
+	t.Cleanup(server.Close)
+	d := NewDiscordNotifier(server.URL)
+	d.Backoff = time.Millisecond
+	d.MaxAttempts = 3
+	return d, standIn
+}
+
+var testRecordNotification = Notification{ID: 1, Type: NotificationRecordBroken, Time: time.Now(), Data: RecordBroken{
+	Scope: RecordAirline, Metric: "landing_rate", Value: -12, Previous: -20, PilotName: "Kip",
+	AircraftName: "A320", DepartureICAO: "KJFK", ArrivalICAO: "KBOS",
+}}
+
+func TestDiscordNotifierRetries(t *testing.T) {
+	d, standIn := newTestDiscordNotifier(t, http.StatusInternalServerError, http.StatusTooManyRequests)
+	if err := d.Send(context.Background(), testRecordNotification); err != nil {
+		t.Fatalf("Send returned error: %v", err)
+	}
+	if standIn.attempts != 3 || len(standIn.messages) != 1 {
+		t.Fatalf("expected delivery on the third attempt, got %d attempts and %d messages", standIn.attempts, len(standIn.messages))
+	}
+	embed := standIn.messages[0].Embeds[0]
+	if embed.Title != "New airline record!" || !strings.Contains(embed.Description, "-12 fpm") {
+		t.Errorf("unexpected embed: %+v", embed)
+	}
+}
+
+func TestDiscordNotifierGivesUp(t *testing.T) {
+	d, standIn := newTestDiscordNotifier(t, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+	if err := d.Send(context.Background(), testRecordNotification); err == nil {
+		t.Error("expected an error once every attempt failed")
+	}
+	if standIn.attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", standIn.attempts)
+	}
+
+	// A rejected message is not retried.
+	d, standIn = newTestDiscordNotifier(t, http.StatusBadRequest)
+	if err := d.Send(context.Background(), testRecordNotification); err == nil {
+		t.Error("expected an error for a rejected message")
+	}
+	if standIn.attempts != 1 {
+		t.Errorf("expected a single attempt for a 400, got %d", standIn.attempts)
+	}
+}
+
+func TestDiscordNotifierRun(t *testing.T) {
+	d, standIn := newTestDiscordNotifier(t)
+	ch := make(chan Notification, 3)
+	ch <- Notification{ID: 1, Type: NotificationFlightStored, Data: FlightData{ID: 1}} // not posted
+	ch <- Notification{ID: 2, Type: NotificationGroupFlightCompleted, Data: GroupFlightDetail{
+		GroupFlight: GroupFlight{DepartureICAO: "KJFK", ArrivalICAO: "KBOS", TotalPilots: 7, LeaderName: "Kip"},
+		Pilots: []GroupFlightPilot{
+			{PilotName: "A", LandingRate: -50, Rank: 1}, {PilotName: "B", LandingRate: -60, Rank: 2},
+			{PilotName: "C", LandingRate: -70, Rank: 3}, {PilotName: "D", LandingRate: -80, Rank: 4},
+			{PilotName: "E", LandingRate: -90, Rank: 5}, {PilotName: "F", LandingRate: -300, Rank: 6},
+		},
+	}}
+	ch <- Notification{ID: 3, Type: NotificationWeekClosed, Data: WeeklyReport{
+		StartDate: time.Date(2025, 7, 19, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2025, 7, 26, 0, 0, 0, 0, time.UTC),
+		TopFlights: []PilotStats{{PilotName: "Kip", TotalFlights: 20}},
+	}}
+	close(ch)
+	d.Run(context.Background(), ch)
+
+	if len(standIn.messages) != 2 {
+		t.Fatalf("expected 2 messages posted, got %d", len(standIn.messages))
+	}
+	group := standIn.messages[0].Embeds[0]
+	if group.Title != "Group flight: KJFK → KBOS" || !strings.Contains(group.Description, "Kip") {
+		t.Errorf("unexpected group flight embed: %+v", group)
+	}
+	if landings := group.Fields[0].Value; !strings.Contains(landings, "5. E") || strings.Contains(landings, "F") {
+		t.Errorf("expected the top 5 landings only, got %q", landings)
+	}
+	weekly := standIn.messages[1].Embeds[0]
+	if weekly.Title != "Weekly leaderboard: Jul 19 to Jul 25" || len(weekly.Fields) != 4 {
+		t.Errorf("unexpected weekly embed: %+v", weekly)
+	}
+}
@@ -0,0 +1,432 @@
+package fswebhook
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultEventWindow is how far from the planned departure a flight may depart and still
+// count as attending an event.
+const defaultEventWindow = 60 * time.Minute
+
+// Event struct to hold a scheduled group flight
+type Event struct {
+	ID               int64     `json:"id"`
+	Title            string    `json:"title"`
+	DepartureICAO    string    `json:"departure_icao"`
+	ArrivalICAO      string    `json:"arrival_icao"`
+	PlannedDeparture time.Time `json:"planned_departure"`
+	HostPilotID      int       `json:"host_pilotid,omitempty"`
+	WindowMinutes    int       `json:"window_minutes"`
+	RSVPCount        int       `json:"rsvp_count"`
+	AttendeeCount    int       `json:"attendee_count"`
+}
+
+// EventRSVP struct to hold a pilot's announced participation in an event
+type EventRSVP struct {
+	PilotID   int       `json:"pilotid"`
+	PilotName string    `json:"pilotname"`
+	CreatedAt time.Time `json:"created_at"`
+	Attended  bool      `json:"attended"`
+}
+
+// EventAttendee struct to hold a flight that attended an event
+type EventAttendee struct {
+	FlightID      int       `json:"flightid"`
+	PilotID       int       `json:"pilotid"`
+	PilotName     string    `json:"pilotname"`
+	AircraftName  string    `json:"aircraft_name"`
+	LandingRate   float64   `json:"landing_rate"`
+	DepartureTime time.Time `json:"departure_time"`
+	ArrivalTime   time.Time `json:"arrival_time"`
+	RSVPd         bool      `json:"rsvpd"`
+}
+
+// EventDetail struct to hold an event's planned and actual attendance
+type EventDetail struct {
+	Event
+	RSVPs     []EventRSVP     `json:"rsvps"`
+	Attendees []EventAttendee `json:"attendees"`
+	NoShows   int             `json:"no_shows"`
+	WalkIns   int             `json:"walk_ins"`
+}
+
+// matchEventAttendance attaches flights flying an event's route within its window to the
+// event. A zero eventID matches every event planned since the given time, and a zero flightID
+// every flight.
+func matchEventAttendance(ctx context.Context, eventID int64, flightID int, since time.Time) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT OR IGNORE INTO event_attendance (event_id, flightid, pilotid)
+		SELECT e.id, f.flightid, f.pilotid
+		FROM events AS e
+		JOIN flights AS f
+			ON f.departure_icao = e.departure_icao
+			AND f.arrival_icao = e.arrival_icao
+		WHERE abs(julianday(f.departure_time) - julianday(e.planned_departure)) * 1440 <= e.window_minutes
+			AND (?1 = 0 OR e.id = ?1)
+			AND (?2 = 0 OR f.flightid = ?2)
+			AND datetime(e.planned_departure) >= datetime(?3)`,
+		eventID, flightID, sqlTime(since))
+	return err
+}
+
+// EventAttendanceJob attaches recently imported flights to the events of the last two days.
+func EventAttendanceJob(ctx context.Context) error {
+	return matchEventAttendance(ctx, 0, 0, time.Now().UTC().Add(-48*time.Hour))
+}
+
+const eventColumns = `
+	e.id, e.title, e.departure_icao, e.arrival_icao, e.planned_departure, e.host_pilotid, e.window_minutes,
+	(SELECT COUNT(*) FROM event_rsvps r WHERE r.event_id = e.id),
+	(SELECT COUNT(DISTINCT a.pilotid) FROM event_attendance a WHERE a.event_id = e.id)`
+
+func scanEvent(row interface{ Scan(...any) error }) (Event, error) {
+	var e Event
+	var planned string
+	var host sql.NullInt64
+	if err := row.Scan(&e.ID, &e.Title, &e.DepartureICAO, &e.ArrivalICAO, &planned, &host,
+		&e.WindowMinutes, &e.RSVPCount, &e.AttendeeCount); err != nil {
+		return e, err
+	}
+	e.HostPilotID = int(host.Int64)
+	var err error
+	if e.PlannedDeparture, err = parseFlightTime(planned); err != nil {
+		slog.Warn("Error parsing planned departure", "event_id", e.ID, "err", err)
+	}
+	return e, nil
+}
+
+// getEvents lists events planned at or after since, soonest first.
+func getEvents(ctx context.Context, since time.Time) ([]Event, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+eventColumns+`
+		FROM events AS e
+		WHERE datetime(e.planned_departure) >= datetime(?)
+		ORDER BY datetime(e.planned_departure)`, sqlTime(since))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// getEventDetail loads an event with its RSVPs and attendees. It returns sql.ErrNoRows for unknown events.
+func getEventDetail(ctx context.Context, id int64) (EventDetail, error) {
+	e, err := scanEvent(db.QueryRowContext(ctx, `SELECT `+eventColumns+` FROM events AS e WHERE e.id = ?`, id))
+	if err != nil {
+		return EventDetail{}, err
+	}
+	detail := EventDetail{Event: e, RSVPs: []EventRSVP{}, Attendees: []EventAttendee{}}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT r.pilotid, r.pilotname, r.created_at,
+			EXISTS (SELECT 1 FROM event_attendance a WHERE a.event_id = r.event_id AND a.pilotid = r.pilotid)
+		FROM event_rsvps AS r
+		WHERE r.event_id = ?
+		ORDER BY r.created_at`, id)
+	if err != nil {
+		return detail, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rsvp EventRSVP
+		var createdAt string
+		if err := rows.Scan(&rsvp.PilotID, &rsvp.PilotName, &createdAt, &rsvp.Attended); err != nil {
+			return detail, err
+		}
+		rsvp.CreatedAt, _ = parseFlightTime(createdAt)
+		if !rsvp.Attended {
+			detail.NoShows++
+		}
+		detail.RSVPs = append(detail.RSVPs, rsvp)
+	}
+	if err := rows.Err(); err != nil {
+		return detail, err
+	}
+	rows.Close()
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT f.flightid, f.pilotid, f.pilotname, f.aircraft_name, f.landing_rate, f.departure_time, f.arrival_time,
+			EXISTS (SELECT 1 FROM event_rsvps r WHERE r.event_id = a.event_id AND r.pilotid = a.pilotid)
+		FROM event_attendance AS a
+		JOIN flights AS f ON f.flightid = a.flightid
+		WHERE a.event_id = ?
+		ORDER BY datetime(f.arrival_time)`, id)
+	if err != nil {
+		return detail, err
+	}
+	defer rows.Close()
+	walkIns := make(map[int]bool)
+	for rows.Next() {
+		var a EventAttendee
+		var departure, arrival string
+		if err := rows.Scan(&a.FlightID, &a.PilotID, &a.PilotName, &a.AircraftName, &a.LandingRate,
+			&departure, &arrival, &a.RSVPd); err != nil {
+			return detail, err
+		}
+		a.DepartureTime, _ = parseFlightTime(departure)
+		a.ArrivalTime, _ = parseFlightTime(arrival)
+		if !a.RSVPd {
+			walkIns[a.PilotID] = true
+		}
+		detail.Attendees = append(detail.Attendees, a)
+	}
+	detail.WalkIns = len(walkIns)
+	return detail, rows.Err()
+}
+
+// eventIDFromRequest parses the {id} path segment.
+func eventIDFromRequest(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// EventsHandler lists the events planned from a week ago onwards.
+func EventsHandler(w http.ResponseWriter, r *http.Request) {
+	events, err := getEvents(r.Context(), time.Now().UTC().AddDate(0, 0, -7))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error querying events", "err", err)
+		http.Error(w, "Error querying events", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// EventHandler returns an event with its planned (RSVP) and actual attendees.
+func EventHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := eventIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	detail, err := getEventDetail(r.Context(), id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error querying event", "event_id", id, "err", err)
+		http.Error(w, "Error querying event", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(detail)
+}
+
+// EventRSVPHandler records (POST {"pilotid": 1, "pilotname": "..."}) or withdraws
+// (DELETE ?pilotid=1) a pilot's RSVP to an event. Pilots RSVP with their own token from
+// PilotTokenAdminHandler, which only works for themselves; the admin token works for anyone.
+func EventRSVPHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := eventIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var rsvp EventRSVP
+	switch r.Method {
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&rsvp); err != nil || rsvp.PilotID <= 0 || rsvp.PilotName == "" {
+			http.Error(w, "Request body must include pilotid and pilotname", http.StatusBadRequest)
+			return
+		}
+	case http.MethodDelete:
+		pilotID, err := strconv.Atoi(r.URL.Query().Get("pilotid"))
+		if err != nil {
+			http.Error(w, "pilotid must be a pilot ID", http.StatusBadRequest)
+			return
+		}
+		rsvp.PilotID = pilotID
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requirePilot(w, r, rsvp.PilotID) {
+		return
+	}
+
+	var exists bool
+	if err := db.QueryRowContext(r.Context(), `SELECT EXISTS (SELECT 1 FROM events WHERE id = ?)`, id).Scan(&exists); err != nil {
+		slog.ErrorContext(r.Context(), "Error querying event", "event_id", id, "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		_, err := db.ExecContext(r.Context(), `
+			INSERT INTO event_rsvps (event_id, pilotid, pilotname, created_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT (event_id, pilotid) DO UPDATE SET pilotname = excluded.pilotname`,
+			id, rsvp.PilotID, rsvp.PilotName, time.Now().UTC().Format(time.RFC3339))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error recording RSVP", "event_id", id, "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "Pilot RSVPd to event", "event_id", id, "pilot_id", rsvp.PilotID, "pilot_name", rsvp.PilotName)
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	if _, err := db.ExecContext(r.Context(), `DELETE FROM event_rsvps WHERE event_id = ? AND pilotid = ?`, id, rsvp.PilotID); err != nil {
+		slog.ErrorContext(r.Context(), "Error withdrawing RSVP", "event_id", id, "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PilotTokenAdminHandler returns the token of the pilot in the {id} path segment, for staff or
+// the Discord bot to hand to that pilot so they can RSVP to events themselves.
+func PilotTokenAdminHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	pilotID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || pilotID <= 0 {
+		http.Error(w, "Invalid pilot ID", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"pilotid": pilotID, "token": pilotToken(pilotID)})
+}
+
+// eventRequest is the body accepted by EventsAdminHandler.
+type eventRequest struct {
+	Title            string    `json:"title"`
+	DepartureICAO    string    `json:"departure_icao"`
+	ArrivalICAO      string    `json:"arrival_icao"`
+	PlannedDeparture time.Time `json:"planned_departure"`
+	HostPilotID      int       `json:"host_pilotid"`
+	WindowMinutes    int       `json:"window_minutes"`
+}
+
+// EventsAdminHandler creates an event (POST). Flights already on record are matched
+// immediately, so events can also be created after the fact.
+func EventsAdminHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req eventRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.DepartureICAO = strings.ToUpper(strings.TrimSpace(req.DepartureICAO))
+	req.ArrivalICAO = strings.ToUpper(strings.TrimSpace(req.ArrivalICAO))
+	if req.Title == "" || req.DepartureICAO == "" || req.ArrivalICAO == "" || req.PlannedDeparture.IsZero() {
+		http.Error(w, "title, departure_icao, arrival_icao and planned_departure are required", http.StatusBadRequest)
+		return
+	}
+	if req.WindowMinutes == 0 {
+		req.WindowMinutes = int(defaultEventWindow.Minutes())
+	}
+	if req.WindowMinutes < 0 || req.WindowMinutes > 24*60 {
+		http.Error(w, "window_minutes must be between 1 and 1440", http.StatusBadRequest)
+		return
+	}
+
+	var host any
+	if req.HostPilotID > 0 {
+		host = req.HostPilotID
+	}
+	res, err := db.ExecContext(r.Context(), `
+		INSERT INTO events (title, departure_icao, arrival_icao, planned_departure, host_pilotid, window_minutes, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		req.Title, req.DepartureICAO, req.ArrivalICAO, sqlTime(req.PlannedDeparture), host, req.WindowMinutes,
+		time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error creating event", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	id, _ := res.LastInsertId()
+	slog.InfoContext(r.Context(), "Created event", "event_id", id, "title", req.Title, "departure", req.DepartureICAO, "arrival", req.ArrivalICAO)
+
+	if err := matchEventAttendance(r.Context(), id, 0, time.Time{}); err != nil {
+		slog.ErrorContext(r.Context(), "Error matching event attendance", "event_id", id, "err", err)
+	}
+
+	detail, err := getEventDetail(r.Context(), id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error querying event", "event_id", id, "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(detail)
+}
+
+// EventAdminHandler deletes (DELETE) the event in the {id} path segment along with its RSVPs and attendance.
+func EventAdminHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	id, ok := eventIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	for _, query := range []string{
+		`DELETE FROM event_attendance WHERE event_id = ?`,
+		`DELETE FROM event_rsvps WHERE event_id = ?`,
+		`DELETE FROM events WHERE id = ?`,
+	} {
+		if _, err := tx.ExecContext(r.Context(), query, id); err != nil {
+			slog.ErrorContext(r.Context(), "Error deleting event", "event_id", id, "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "Deleted event", "event_id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
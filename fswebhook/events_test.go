@@ -0,0 +1,159 @@
+package fswebhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	setupTestDB(t)
+	for _, table := range []string{"events", "event_rsvps", "event_attendance"} {
+		if _, err := db.Exec(`DELETE FROM ` + table); err != nil {
+			t.Fatalf("Failed to clear %s table: %v", table, err)
+		}
+	}
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM events`)
+		db.Exec(`DELETE FROM event_rsvps`)
+		db.Exec(`DELETE FROM event_attendance`)
+	})
+	t.Setenv("ADMIN_TOKEN", "admin-secret")
+
+	planned := time.Now().UTC().Add(2 * time.Hour).Truncate(time.Second)
+	body := fmt.Sprintf(`{"title": "Friday Shuttle", "departure_icao": "kjfk", "arrival_icao": "KBOS",
+		"planned_departure": %q, "host_pilotid": 1}`, planned.Format(time.RFC3339))
+	req := httptest.NewRequest(http.MethodPost, "/admin/events", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	rr := httptest.NewRecorder()
+	EventsAdminHandler(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusCreated, rr.Body)
+	}
+	var created EventDetail
+	if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if created.DepartureICAO != "KJFK" || created.WindowMinutes != 60 {
+		t.Errorf("unexpected event: %+v", created.Event)
+	}
+	eventID := fmt.Sprint(created.ID)
+
+	// Bob RSVPs himself with his own token; staff sign Alice up with the admin token.
+	req = httptest.NewRequest(http.MethodGet, "/admin/pilots/2/token", nil)
+	req.SetPathValue("id", "2")
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	rr = httptest.NewRecorder()
+	PilotTokenAdminHandler(rr, req)
+	var bob struct {
+		PilotID int    `json:"pilotid"`
+		Token   string `json:"token"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&bob); err != nil || rr.Code != http.StatusOK || bob.PilotID != 2 || bob.Token == "" {
+		t.Fatalf("expected Bob's token, got %v %+v (%v)", rr.Code, bob, err)
+	}
+	for _, rsvp := range []struct{ body, token string }{
+		{`{"pilotid": 1, "pilotname": "Alice"}`, "admin-secret"},
+		{`{"pilotid": 2, "pilotname": "Bob"}`, bob.Token},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/events/"+eventID+"/rsvp", strings.NewReader(rsvp.body))
+		req.SetPathValue("id", eventID)
+		req.Header.Set("Authorization", "Bearer "+rsvp.token)
+		rr := httptest.NewRecorder()
+		EventRSVPHandler(rr, req)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("RSVP returned wrong status code: got %v want %v", rr.Code, http.StatusCreated)
+		}
+	}
+
+	// Nobody can sign up or withdraw another pilot, with no token or with their own.
+	for _, tt := range []struct {
+		req   *http.Request
+		token string
+	}{
+		{httptest.NewRequest(http.MethodPost, "/events/"+eventID+"/rsvp", strings.NewReader(`{"pilotid": 5, "pilotname": "Eve"}`)), ""},
+		{httptest.NewRequest(http.MethodDelete, "/events/"+eventID+"/rsvp?pilotid=2", nil), ""},
+		{httptest.NewRequest(http.MethodPost, "/events/"+eventID+"/rsvp", strings.NewReader(`{"pilotid": 5, "pilotname": "Eve"}`)), bob.Token},
+		{httptest.NewRequest(http.MethodDelete, "/events/"+eventID+"/rsvp?pilotid=1", nil), bob.Token},
+	} {
+		tt.req.SetPathValue("id", eventID)
+		if tt.token != "" {
+			tt.req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rr := httptest.NewRecorder()
+		EventRSVPHandler(rr, tt.req)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s RSVP for another pilot: got %v want %v", tt.req.Method, tt.req.URL, rr.Code, http.StatusUnauthorized)
+		}
+	}
+
+	// Alice attends, Carol walks in, Dave flies the route too late and Bob never shows up.
+	insertTestFlights(t,
+		testFlight{FlightID: 1, PilotID: 1, PilotName: "Alice", Duration: time.Hour, DepartureICAO: "KJFK",
+			ArrivalICAO: "KBOS", Arrival: planned.Add(65 * time.Minute)},
+		testFlight{FlightID: 2, PilotID: 3, PilotName: "Carol", Duration: time.Hour, DepartureICAO: "KJFK",
+			ArrivalICAO: "KBOS", Arrival: planned.Add(50 * time.Minute)},
+		testFlight{FlightID: 3, PilotID: 4, PilotName: "Dave", Duration: time.Hour, DepartureICAO: "KJFK",
+			ArrivalICAO: "KBOS", Arrival: planned.Add(4 * time.Hour)},
+	)
+	for _, id := range []int{1, 2, 3} {
+		if err := matchEventAttendance(context.Background(), 0, id, planned.Add(-24*time.Hour)); err != nil {
+			t.Fatalf("matchEventAttendance returned error: %v", err)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/events/"+eventID, nil)
+	req.SetPathValue("id", eventID)
+	rr = httptest.NewRecorder()
+	EventHandler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var detail EventDetail
+	if err := json.NewDecoder(rr.Body).Decode(&detail); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(detail.RSVPs) != 2 || detail.RSVPCount != 2 {
+		t.Errorf("expected 2 RSVPs, got %+v", detail.RSVPs)
+	}
+	if len(detail.Attendees) != 2 || detail.AttendeeCount != 2 {
+		t.Fatalf("expected 2 attendees, got %+v", detail.Attendees)
+	}
+	if detail.Attendees[0].PilotName != "Carol" || detail.Attendees[0].RSVPd {
+		t.Errorf("expected Carol to arrive first as a walk-in, got %+v", detail.Attendees[0])
+	}
+	if detail.NoShows != 1 || detail.WalkIns != 1 {
+		t.Errorf("expected 1 no-show and 1 walk-in, got %d and %d", detail.NoShows, detail.WalkIns)
+	}
+
+	// Creating another event only matches flights against that event: Dave's late flight, stored
+	// without passing through ingest, stays off the first one.
+	if _, err := db.Exec(`UPDATE events SET window_minutes = 300 WHERE id = ?`, created.ID); err != nil {
+		t.Fatal(err)
+	}
+	body = fmt.Sprintf(`{"title": "Saturday Shuttle", "departure_icao": "KBOS", "arrival_icao": "KJFK",
+		"planned_departure": %q}`, planned.Add(-24*time.Hour).Format(time.RFC3339))
+	req = httptest.NewRequest(http.MethodPost, "/admin/events", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	rr = httptest.NewRecorder()
+	EventsAdminHandler(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusCreated, rr.Body)
+	}
+	if detail, err := getEventDetail(context.Background(), created.ID); err != nil || len(detail.Attendees) != 2 {
+		t.Errorf("expected the first event's attendance left alone, got %+v (%v)", detail.Attendees, err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/events/999999", nil)
+	req.SetPathValue("id", "999999")
+	rr = httptest.NewRecorder()
+	EventHandler(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown event, got %v", rr.Code)
+	}
+}
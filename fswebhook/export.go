@@ -0,0 +1,273 @@
+package fswebhook
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// flightColumns are the columns of the flights table, in the order exports write them.
+var flightColumns = []string{
+	"flightid", "pilotid", "pilotname", "landing_rate", "distance", "time",
+	"aircraft_icao", "aircraft_name", "departure_icao", "arrival_icao", "fuel_used",
+	"departure_time", "arrival_time",
+}
+
+// numericFlightColumns are the flightColumns written as numbers in spreadsheets.
+var numericFlightColumns = map[string]bool{
+	"flightid": true, "pilotid": true, "landing_rate": true, "distance": true, "time": true, "fuel_used": true,
+}
+
+// FlightFilter struct to hold which flights an export includes
+type FlightFilter struct {
+	Start, End   time.Time // arrival time range
+	PilotID      int       // optional
+	AircraftICAO string    // optional
+	AirportICAO  string    // optional, matches either the departure or the arrival airport
+}
+
+// flightFilterFromRequest reads the period parameters along with the optional "pilot",
+// "aircraft" and "airport" ones.
+func flightFilterFromRequest(r *http.Request) (FlightFilter, error) {
+	var filter FlightFilter
+	var err error
+	if filter.Start, filter.End, err = periodFromRequest(r); err != nil {
+		return filter, err
+	}
+	q := r.URL.Query()
+	if s := q.Get("pilot"); s != "" {
+		if filter.PilotID, err = strconv.Atoi(s); err != nil || filter.PilotID < 1 {
+			return filter, fmt.Errorf("invalid pilot ID %q", s)
+		}
+	}
+	filter.AircraftICAO = strings.ToUpper(q.Get("aircraft"))
+	filter.AirportICAO = strings.ToUpper(q.Get("airport"))
+	return filter, nil
+}
+
+// eachFlight calls fn with the columns of every flight matching filter, in arrival order. The
+// record is reused between calls.
+func eachFlight(ctx context.Context, filter FlightFilter, fn func(record []string) error) (int, error) {
+	query := `
+		SELECT flightid, pilotid, pilotname, landing_rate, distance, "time",
+			aircraft_icao, aircraft_name, departure_icao, arrival_icao, fuel_used,
+			departure_time, arrival_time
+		FROM flights
+		WHERE datetime(arrival_time) >= datetime(?) AND datetime(arrival_time) < datetime(?)`
+	args := []any{sqlTime(filter.Start), sqlTime(filter.End)}
+	if filter.PilotID != 0 {
+		query += ` AND pilotid = ?`
+		args = append(args, filter.PilotID)
+	}
+	if filter.AircraftICAO != "" {
+		query += ` AND aircraft_icao = ?`
+		args = append(args, filter.AircraftICAO)
+	}
+	if filter.AirportICAO != "" {
+		query += ` AND (departure_icao = ? OR arrival_icao = ?)`
+		args = append(args, filter.AirportICAO, filter.AirportICAO)
+	}
+	query += ` ORDER BY datetime(arrival_time), flightid`
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	values := make([]sql.NullString, len(flightColumns))
+	dest := make([]any, len(values))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	record := make([]string, len(values))
+	n := 0
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return n, err
+		}
+		for i, v := range values {
+			record[i] = v.String
+		}
+		if err := fn(record); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
+
+// csvText keeps a spreadsheet from reading a text cell as a formula, such as a pilot named
+// "=HYPERLINK(...)", by prefixing cells that start like one with a quote.
+func csvText(value string) string {
+	if value != "" && strings.ContainsRune("=+-@", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// ExportFlightsCSV writes the flights matching filter as CSV with a header row, one flight at a
+// time so the table is never held in memory. It returns how many flights were written.
+func ExportFlightsCSV(ctx context.Context, w io.Writer, filter FlightFilter) (int, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(flightColumns); err != nil {
+		return 0, err
+	}
+	n, err := eachFlight(ctx, filter, func(record []string) error {
+		for i, value := range record {
+			if !numericFlightColumns[flightColumns[i]] {
+				record[i] = csvText(value)
+			}
+		}
+		return cw.Write(record)
+	})
+	if err != nil {
+		return n, err
+	}
+	cw.Flush()
+	return n, cw.Error()
+}
+
+// ExportFlightsXLSX writes the flights matching filter as a single sheet workbook, streamed
+// like ExportFlightsCSV.
+func ExportFlightsXLSX(ctx context.Context, w io.Writer, filter FlightFilter) (int, error) {
+	x := newXLSXWriter(w, "Flights")
+	if err := x.NextSheet(); err != nil {
+		return 0, err
+	}
+	header := make([]any, len(flightColumns))
+	for i, column := range flightColumns {
+		header[i] = column
+	}
+	if err := x.WriteRow(header...); err != nil {
+		return 0, err
+	}
+
+	cells := make([]any, len(flightColumns))
+	n, err := eachFlight(ctx, filter, func(record []string) error {
+		for i, value := range record {
+			cells[i] = value
+			if numericFlightColumns[flightColumns[i]] {
+				if f, err := strconv.ParseFloat(value, 64); err == nil {
+					cells[i] = f
+				}
+			}
+		}
+		return x.WriteRow(cells...)
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, x.Close()
+}
+
+// ExportReportXLSX writes report as a workbook with one sheet per leaderboard.
+func ExportReportXLSX(w io.Writer, report WeeklyReport) error {
+	names := make([]string, len(reportBoards))
+	for i, board := range reportBoards {
+		names[i] = board.title
+	}
+	x := newXLSXWriter(w, names...)
+	for _, board := range reportBoards {
+		if err := x.NextSheet(); err != nil {
+			return err
+		}
+		header := []any{"Rank", "Pilot ID", "Pilot", "Avg. Landing Rate (fpm)", "Flights", "Distance (nm)", "Hours"}
+		if board.metric == "efficiency" {
+			header = append(header, "Fuel vs Type Average")
+		}
+		if err := x.WriteRow(header...); err != nil {
+			return err
+		}
+		for rank, p := range board.pilots(report) {
+			row := []any{rank + 1, p.PilotID, p.PilotName, p.AverageLandingRate, p.TotalFlights, p.TotalDistance, p.TotalHoursFlown}
+			if board.metric == "efficiency" {
+				row = append(row, p.FuelEfficiency)
+			}
+			if err := x.WriteRow(row...); err != nil {
+				return err
+			}
+		}
+	}
+	return x.Close()
+}
+
+// countingWriter tracks whether anything has been written, so a failed export can still be
+// answered with an error status if the response has not started.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// exportFlights serves the flights matching the request's filters through export.
+func exportFlights(w http.ResponseWriter, r *http.Request, contentType, filename string,
+	export func(context.Context, io.Writer, FlightFilter) (int, error)) {
+	filter, err := flightFilterFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	cw := &countingWriter{w: w}
+	n, err := export(r.Context(), cw, filter)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error exporting flights", "format", filename, "flights", n, "err", err)
+		if cw.n == 0 {
+			http.Error(w, "Error exporting flights", http.StatusInternalServerError)
+		}
+	}
+}
+
+// FlightsCSVHandler serves the flights as CSV, filtered by "period", "start", "end", "pilot",
+// "aircraft" and "airport", e.g. /export/flights.csv?period=month&aircraft=A320.
+func FlightsCSVHandler(w http.ResponseWriter, r *http.Request) {
+	exportFlights(w, r, "text/csv; charset=utf-8", "flights.csv", ExportFlightsCSV)
+}
+
+// FlightsXLSXHandler serves the flights as an Excel workbook, filtered like FlightsCSVHandler.
+func FlightsXLSXHandler(w http.ResponseWriter, r *http.Request) {
+	exportFlights(w, r, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "flights.xlsx", ExportFlightsXLSX)
+}
+
+// ReportXLSXHandler serves the leaderboards for the requested period, the last completed week by
+// default, as an Excel workbook with one sheet per category, e.g.
+// /export/report.xlsx?start=2025-07-01&end=2025-08-01.
+func ReportXLSXHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	period := q.Get("period")
+	if period == "" {
+		period = "week"
+	}
+	start, end, err := ParsePeriod(period, q.Get("start"), q.Get("end"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	report, err := GetWeeklyReport(r.Context(), start, end)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error querying report", "err", err)
+		http.Error(w, "Error querying report", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", `attachment; filename="report-`+start.Format(time.DateOnly)+`.xlsx"`)
+	if err := ExportReportXLSX(w, report); err != nil {
+		slog.ErrorContext(r.Context(), "Error writing report workbook", "err", err)
+	}
+}
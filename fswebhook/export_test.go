@@ -0,0 +1,230 @@
+package fswebhook
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportFlightsCSV(t *testing.T) {
+	setupTestDB(t)
+	day := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	insertTestFlights(t,
+		testFlight{FlightID: 1, PilotID: 7, PilotName: "Alice, Jr.", LandingRate: -85, Distance: 400, Duration: time.Hour,
+			AircraftICAO: "A320", DepartureICAO: "KJFK", ArrivalICAO: "KBOS", Arrival: day.Add(24 * time.Hour)},
+		testFlight{FlightID: 2, PilotID: 8, PilotName: "Bob", Duration: time.Hour, Arrival: day},
+		testFlight{FlightID: 3, PilotID: 9, PilotName: "Carol", Duration: time.Hour, Arrival: day.AddDate(0, 1, 0)},
+	)
+
+	var buf bytes.Buffer
+	n, err := ExportFlightsCSV(context.Background(), &buf, FlightFilter{Start: day, End: day.AddDate(0, 0, 7)})
+	if err != nil {
+		t.Fatalf("ExportFlightsCSV returned error: %v", err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+	if n != 2 || len(records) != 3 {
+		t.Fatalf("expected a header and 2 flights, got %d: %v", n, records)
+	}
+	if records[0][0] != "flightid" || records[0][12] != "arrival_time" {
+		t.Errorf("unexpected header %v", records[0])
+	}
+
+	// Flights come out in arrival order, with every column.
+	want := []string{"1", "7", "Alice, Jr.", "-85", "400", "3600", "A320", "", "KJFK", "KBOS", "0",
+		"2025-07-02T11:00:00Z", "2025-07-02T12:00:00Z"}
+	if records[1][0] != "2" || len(records[2]) != len(want) {
+		t.Fatalf("unexpected rows %v", records[1:])
+	}
+	for i := range want {
+		if records[2][i] != want[i] {
+			t.Errorf("column %s: expected %q, got %q", records[0][i], want[i], records[2][i])
+		}
+	}
+}
+
+func TestExportFlightsCSVFormulas(t *testing.T) {
+	setupTestDB(t)
+	day := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	insertTestFlights(t,
+		testFlight{FlightID: 1, PilotID: 7, PilotName: "=HYPERLINK(\"http://example.com\")", LandingRate: -85,
+			Duration: time.Hour, AircraftICAO: "A320", AircraftName: "@SUM(A1)", DepartureICAO: "KJFK", ArrivalICAO: "KBOS", Arrival: day},
+		testFlight{FlightID: 2, PilotID: 8, PilotName: "+Bob", Duration: time.Hour, AircraftICAO: "A320", AircraftName: "-A320-",
+			DepartureICAO: "KBOS", ArrivalICAO: "KJFK", Arrival: day.Add(time.Hour)},
+	)
+
+	var buf bytes.Buffer
+	if _, err := ExportFlightsCSV(context.Background(), &buf, FlightFilter{Start: day, End: day.AddDate(0, 0, 1)}); err != nil {
+		t.Fatalf("ExportFlightsCSV returned error: %v", err)
+	}
+	exported := buf.String()
+	records, err := csv.NewReader(strings.NewReader(exported)).ReadAll()
+	if err != nil || len(records) != 3 {
+		t.Fatalf("expected a header and 2 flights, got %v (%v)", records, err)
+	}
+
+	// Text cells that would start a formula are quoted; negative numbers are left alone.
+	for _, want := range []struct {
+		row    int
+		column string
+		value  string
+	}{
+		{1, "pilotname", `'=HYPERLINK("http://example.com")`},
+		{1, "aircraft_name", "'@SUM(A1)"},
+		{1, "landing_rate", "-85"},
+		{2, "pilotname", "'+Bob"},
+		{2, "aircraft_name", "'-A320-"},
+	} {
+		i := slices.Index(flightColumns, want.column)
+		if got := records[want.row][i]; got != want.value {
+			t.Errorf("row %d %s: expected %q, got %q", want.row, want.column, want.value, got)
+		}
+	}
+
+	// Importing the export gives back the original names.
+	setupTestDB(t)
+	if _, err := ImportFlightsCSV(context.Background(), strings.NewReader(exported)); err != nil {
+		t.Fatalf("ImportFlightsCSV returned error: %v", err)
+	}
+	var name, aircraft string
+	if err := db.QueryRow(`SELECT pilotname, aircraft_name FROM flights WHERE flightid = 2`).Scan(&name, &aircraft); err != nil {
+		t.Fatalf("Failed to query imported flight: %v", err)
+	}
+	if name != "+Bob" || aircraft != "-A320-" {
+		t.Errorf("expected the names back unquoted, got %q and %q", name, aircraft)
+	}
+}
+
+func TestFlightsCSVHandlerFilters(t *testing.T) {
+	setupTestDB(t)
+	day := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	insertTestFlights(t,
+		testFlight{FlightID: 1, PilotID: 7, Duration: time.Hour, AircraftICAO: "A320", DepartureICAO: "KJFK", ArrivalICAO: "KBOS", Arrival: day},
+		testFlight{FlightID: 2, PilotID: 7, Duration: time.Hour, AircraftICAO: "B738", DepartureICAO: "KBOS", ArrivalICAO: "KORD", Arrival: day},
+		testFlight{FlightID: 3, PilotID: 8, Duration: time.Hour, AircraftICAO: "A320", DepartureICAO: "EGLL", ArrivalICAO: "LFPG", Arrival: day},
+	)
+
+	for query, want := range map[string]string{
+		"":                      "1,2,3",
+		"pilot=7":               "1,2",
+		"aircraft=a320":         "1,3",
+		"airport=KBOS":          "1,2",
+		"pilot=7&aircraft=B738": "2",
+		"start=2025-07-02":      "",
+		"airport=lfpg":          "3",
+	} {
+		rr := httptest.NewRecorder()
+		FlightsCSVHandler(rr, httptest.NewRequest(http.MethodGet, "/export/flights.csv?"+query, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%q: expected status 200, got %d", query, rr.Code)
+		}
+		if got := rr.Header().Get("Content-Disposition"); got != `attachment; filename="flights.csv"` {
+			t.Errorf("unexpected Content-Disposition %q", got)
+		}
+		records, err := csv.NewReader(rr.Body).ReadAll()
+		if err != nil {
+			t.Fatalf("%q: failed to parse CSV: %v", query, err)
+		}
+		var ids []string
+		for _, record := range records[1:] {
+			ids = append(ids, record[0])
+		}
+		if got := strings.Join(ids, ","); got != want {
+			t.Errorf("%q: expected flights %q, got %q", query, want, got)
+		}
+	}
+
+	for _, query := range []string{"pilot=abc", "period=fortnight"} {
+		rr := httptest.NewRecorder()
+		FlightsCSVHandler(rr, httptest.NewRequest(http.MethodGet, "/export/flights.csv?"+query, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected status 400, got %d", query, rr.Code)
+		}
+	}
+}
+
+// readXLSX returns the contents of each part of a workbook.
+func readXLSX(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Failed to open workbook: %v", err)
+	}
+	parts := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", f.Name, err)
+		}
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		parts[f.Name] = string(b)
+	}
+	return parts
+}
+
+func TestExportFlightsXLSX(t *testing.T) {
+	setupTestDB(t)
+	day := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	insertTestFlights(t, testFlight{FlightID: 1, PilotID: 7, PilotName: "Alice & <Bob>", LandingRate: -85,
+		Distance: 400, Duration: time.Hour, AircraftICAO: "A320", Arrival: day})
+
+	var buf bytes.Buffer
+	n, err := ExportFlightsXLSX(context.Background(), &buf, FlightFilter{Start: day.AddDate(0, 0, -1), End: day.AddDate(0, 0, 1)})
+	if err != nil || n != 1 {
+		t.Fatalf("ExportFlightsXLSX returned %d, %v", n, err)
+	}
+	parts := readXLSX(t, buf.Bytes())
+	if !strings.Contains(parts["xl/workbook.xml"], `<sheet name="Flights" sheetId="1" r:id="rId1"/>`) {
+		t.Errorf("unexpected workbook %s", parts["xl/workbook.xml"])
+	}
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	for _, want := range []string{
+		`<t xml:space="preserve">flightid</t>`,
+		`<c><v>1</v></c><c><v>7</v></c><c t="inlineStr"><is><t xml:space="preserve">Alice &amp; &lt;Bob&gt;</t></is></c><c><v>-85</v></c>`,
+		`<t xml:space="preserve">A320</t>`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet is missing %s:\n%s", want, sheet)
+		}
+	}
+}
+
+func TestReportXLSXHandler(t *testing.T) {
+	setupTestDB(t)
+	week := getWeeklyDateRanges(1)[0]
+	var flights []testFlight
+	for i := 1; i <= LeaderboardSettings.MinFlights; i++ {
+		flights = append(flights, testFlight{FlightID: i, PilotID: 7, PilotName: "Alice", LandingRate: -90,
+			Distance: 300, Duration: time.Hour, AircraftICAO: "A320", Arrival: week[0].Add(time.Duration(i) * time.Hour)})
+	}
+	insertTestFlights(t, flights...)
+
+	rr := httptest.NewRecorder()
+	ReportXLSXHandler(rr, httptest.NewRequest(http.MethodGet, "/export/report.xlsx", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body)
+	}
+	parts := readXLSX(t, rr.Body.Bytes())
+	for i, board := range reportBoards {
+		if !strings.Contains(parts["xl/workbook.xml"], `<sheet name="`+board.title+`"`) {
+			t.Errorf("workbook is missing the %s sheet", board.title)
+		}
+		if _, ok := parts["xl/worksheets/sheet"+string(rune('1'+i))+".xml"]; !ok {
+			t.Errorf("workbook is missing sheet %d", i+1)
+		}
+	}
+	if !strings.Contains(parts["xl/worksheets/sheet1.xml"], `<c><v>1</v></c><c><v>7</v></c><c t="inlineStr"><is><t xml:space="preserve">Alice</t></is></c><c><v>-90</v></c>`) {
+		t.Errorf("unexpected landing rate sheet %s", parts["xl/worksheets/sheet1.xml"])
+	}
+}
@@ -0,0 +1,367 @@
+package fswebhook
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// feedEntries is how many entries each feed shows.
+const feedEntries = 50
+
+// feedWeeks is how many closed weeks the weekly results feed shows.
+const feedWeeks = 12
+
+// feedTagDate is the date in the tag: URIs identifying feeds and entries. It must never
+// change, or feed readers will show every entry again.
+const feedTagDate = "2024"
+
+// defaultFeedAuthority names the site in tag: URIs when no TLS hostname is configured.
+const defaultFeedAuthority = "fshub-webhook.invalid"
+
+// FeedAuthority is the authority of the tag: URIs identifying feeds and entries. It comes
+// from the configuration rather than the request, so an entry keeps its id whichever name
+// the server was reached by.
+var FeedAuthority = defaultFeedAuthority
+
+// atomFeed struct to hold an Atom feed document
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link,omitempty"`
+	Content atomContent `xml:"content"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// feedSite builds the absolute URLs and tag: URIs of a feed served for r.
+type feedSite struct {
+	base string // scheme and host, without a trailing slash
+}
+
+func feedSiteFor(r *http.Request) feedSite {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return feedSite{base: scheme + "://" + r.Host}
+}
+
+// tag returns the permanent id of the feed or entry at the given specific path.
+func (s feedSite) tag(specific string) string {
+	return "tag:" + FeedAuthority + "," + feedTagDate + ":" + specific
+}
+
+// newFeed starts a feed whose self link is the requested URL and whose alternate link is
+// the page showing the same data.
+func (s feedSite) newFeed(r *http.Request, id, title, page string) atomFeed {
+	return atomFeed{
+		ID:     s.tag(id),
+		Title:  title,
+		Author: atomAuthor{Name: "FSHub"},
+		Links: []atomLink{
+			{Rel: "self", Href: s.base + r.URL.RequestURI()},
+			{Rel: "alternate", Href: s.base + page},
+		},
+	}
+}
+
+func atomTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// writeFeed sends the feed, dating it by its newest entry.
+func writeFeed(w http.ResponseWriter, feed atomFeed, updated time.Time) {
+	feed.Updated = atomTime(updated)
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	fmt.Fprint(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		slog.Error("Error encoding feed", "feed", feed.ID, "err", err)
+	}
+}
+
+// feedFlight struct to hold a stored flight as shown in the feeds
+type feedFlight struct {
+	FlightID      int
+	PilotID       int
+	PilotName     string
+	LandingRate   float64
+	Distance      int
+	Seconds       float64
+	AircraftName  string
+	DepartureICAO string
+	ArrivalICAO   string
+	ArrivalTime   time.Time
+}
+
+// getLatestFlights loads the most recently landed flights, of one pilot if pilotID is not zero.
+func getLatestFlights(ctx context.Context, pilotID, limit int) ([]feedFlight, error) {
+	query := `
+		SELECT flightid, pilotid, pilotname, landing_rate, distance, "time",
+			aircraft_name, departure_icao, arrival_icao, arrival_time
+		FROM flights`
+	args := []any{}
+	if pilotID != 0 {
+		query += ` WHERE pilotid = ?`
+		args = append(args, pilotID)
+	}
+	query += ` ORDER BY datetime(arrival_time) DESC, flightid DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var flights []feedFlight
+	for rows.Next() {
+		var f feedFlight
+		var arrival string
+		if err := rows.Scan(&f.FlightID, &f.PilotID, &f.PilotName, &f.LandingRate, &f.Distance, &f.Seconds,
+			&f.AircraftName, &f.DepartureICAO, &f.ArrivalICAO, &arrival); err != nil {
+			return nil, err
+		}
+		if f.ArrivalTime, err = parseFlightTime(arrival); err != nil {
+			slog.Warn("Error parsing arrival time", "flight_id", f.FlightID, "err", err)
+		}
+		flights = append(flights, f)
+	}
+	return flights, rows.Err()
+}
+
+func (s feedSite) flightEntry(f feedFlight) atomEntry {
+	hours := f.Seconds / 3600
+	return atomEntry{
+		ID:      s.tag(fmt.Sprintf("flight/%d", f.FlightID)),
+		Title:   fmt.Sprintf("%s flew %s → %s", f.PilotName, f.DepartureICAO, f.ArrivalICAO),
+		Updated: atomTime(f.ArrivalTime),
+		Content: atomContent{Type: "text", Body: fmt.Sprintf("%s, %d nm in %dh %02dm, landed at %.0f fpm.",
+			f.AircraftName, f.Distance, int(hours), int(f.Seconds/60)%60, f.LandingRate)},
+	}
+}
+
+func writeFlightsFeed(w http.ResponseWriter, r *http.Request, id, title string, flights []feedFlight) {
+	site := feedSiteFor(r)
+	feed := site.newFeed(r, id, title, "/")
+	var updated time.Time
+	for _, f := range flights {
+		feed.Entries = append(feed.Entries, site.flightEntry(f))
+		if f.ArrivalTime.After(updated) {
+			updated = f.ArrivalTime
+		}
+	}
+	writeFeed(w, feed, updated)
+}
+
+// FlightsFeedHandler serves an Atom feed of the latest flights of the whole airline.
+func FlightsFeedHandler(w http.ResponseWriter, r *http.Request) {
+	flights, err := getLatestFlights(r.Context(), 0, feedEntries)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error querying latest flights", "err", err)
+		http.Error(w, "Error querying flights", http.StatusInternalServerError)
+		return
+	}
+
+	writeFlightsFeed(w, r, "flights", "Latest flights", flights)
+}
+
+// PilotFlightsFeedHandler serves an Atom feed of the latest flights of one pilot.
+func PilotFlightsFeedHandler(w http.ResponseWriter, r *http.Request) {
+	pilotID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid pilot ID", http.StatusBadRequest)
+		return
+	}
+
+	flights, err := getLatestFlights(r.Context(), pilotID, feedEntries)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error querying latest flights", "pilot_id", pilotID, "err", err)
+		http.Error(w, "Error querying flights", http.StatusInternalServerError)
+		return
+	}
+	if len(flights) == 0 {
+		http.Error(w, "Pilot not found", http.StatusNotFound)
+		return
+	}
+
+	writeFlightsFeed(w, r, fmt.Sprintf("pilot/%d/flights", pilotID), "Latest flights of "+flights[0].PilotName, flights)
+}
+
+// weeklyReportHTML renders the top three of every board of a weekly report.
+func weeklyReportHTML(report WeeklyReport) string {
+	var b strings.Builder
+	for _, board := range []struct {
+		name   string
+		pilots []PilotStats
+		value  func(PilotStats) string
+	}{
+		{"Softest landings", report.TopLandingRate, func(p PilotStats) string { return fmt.Sprintf("%.0f fpm", p.AverageLandingRate) }},
+		{"Most distance", report.TopDistance, func(p PilotStats) string { return fmt.Sprintf("%d nm", p.TotalDistance) }},
+		{"Most flights", report.TopFlights, func(p PilotStats) string { return fmt.Sprintf("%d flights", p.TotalFlights) }},
+		{"Most hours", report.TopHours, func(p PilotStats) string { return fmt.Sprintf("%.1f h", p.TotalHoursFlown) }},
+		{"Most fuel efficient", report.TopEfficiency, func(p PilotStats) string { return fmt.Sprintf("%.2f", p.FuelEfficiency) }},
+	} {
+		fmt.Fprintf(&b, "<h3>%s</h3>", board.name)
+		if len(board.pilots) == 0 {
+			b.WriteString("<p>No qualifying pilots</p>")
+			continue
+		}
+		b.WriteString("<ol>")
+		for i, p := range board.pilots {
+			if i == 3 {
+				break
+			}
+			fmt.Fprintf(&b, "<li>%s: %s</li>", html.EscapeString(p.PilotName), board.value(p))
+		}
+		b.WriteString("</ol>")
+	}
+	return b.String()
+}
+
+// WeeklyFeedHandler serves an Atom feed with the results of each closed week, the
+// current week being left out until it is over.
+func WeeklyFeedHandler(w http.ResponseWriter, r *http.Request) {
+	site := feedSiteFor(r)
+	feed := site.newFeed(r, "weekly", "Weekly results", "/")
+	var updated time.Time
+	for _, week := range getWeeklyDateRanges(feedWeeks) {
+		report, err := GetWeeklyReport(r.Context(), week[0], week[1])
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error building weekly report", "week", week[0].Format(time.DateOnly), "err", err)
+			http.Error(w, "Error querying weekly reports", http.StatusInternalServerError)
+			return
+		}
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID: site.tag("week/" + week[0].Format(time.DateOnly)),
+			Title: fmt.Sprintf("Weekly results: %s to %s", week[0].Format("Jan 2"),
+				week[1].AddDate(0, 0, -1).Format("Jan 2, 2006")),
+			Updated: atomTime(week[1]),
+			Content: atomContent{Type: "html", Body: weeklyReportHTML(report)},
+		})
+		if week[1].After(updated) {
+			updated = week[1]
+		}
+	}
+	writeFeed(w, feed, updated)
+}
+
+// getCompletedGroupFlightIDs returns the most recent group flights that can no longer grow,
+// with the time of their last arrival.
+func getCompletedGroupFlightIDs(ctx context.Context, now time.Time, opts GroupFlightOptions, limit int) ([]int64, []time.Time, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, last_arrival FROM group_flights
+		WHERE datetime(last_arrival) <= datetime(?) AND total_pilots >= ?
+		ORDER BY datetime(last_arrival) DESC, id DESC
+		LIMIT ?`, sqlTime(now.Add(-opts.Window)), opts.MinPilots, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	var lastArrivals []time.Time
+	for rows.Next() {
+		var id int64
+		var lastArrival string
+		if err := rows.Scan(&id, &lastArrival); err != nil {
+			return nil, nil, err
+		}
+		t, err := parseFlightTime(lastArrival)
+		if err != nil {
+			slog.Warn("Error parsing last arrival", "group_flight_id", id, "err", err)
+		}
+		ids = append(ids, id)
+		lastArrivals = append(lastArrivals, t)
+	}
+	return ids, lastArrivals, rows.Err()
+}
+
+// groupFlightHTML renders the landings of a group flight and how well it stuck together.
+func groupFlightHTML(g GroupFlightDetail) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<p>%d pilots flew together", g.TotalPilots)
+	if g.LeaderName != "" {
+		fmt.Fprintf(&b, ", led by %s", html.EscapeString(g.LeaderName))
+	}
+	fmt.Fprintf(&b, ". Average landing %.0f fpm", g.AverageLandingRate)
+	if f := g.Formation; f != nil {
+		fmt.Fprintf(&b, ", arrival spread %d min, formation score %.1f", f.ArrivalSpreadSeconds/60, f.Score)
+	}
+	b.WriteString(".</p><ol>")
+	for _, p := range g.Pilots {
+		fmt.Fprintf(&b, "<li>%s: %.0f fpm (%s)</li>", html.EscapeString(p.PilotName), p.LandingRate, html.EscapeString(p.AircraftName))
+	}
+	b.WriteString("</ol>")
+	return b.String()
+}
+
+// GroupFlightsFeedHandler serves an Atom feed of the results of completed group flights.
+func GroupFlightsFeedHandler(w http.ResponseWriter, r *http.Request) {
+	opts := GroupFlightSettings
+	ids, lastArrivals, err := getCompletedGroupFlightIDs(r.Context(), time.Now(), opts, feedEntries)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error querying completed group flights", "err", err)
+		http.Error(w, "Error querying group flights", http.StatusInternalServerError)
+		return
+	}
+
+	site := feedSiteFor(r)
+	feed := site.newFeed(r, "group-flights", "Group flight results", "/group-flights.html")
+	var updated time.Time
+	for i, id := range ids {
+		g, err := getGroupFlightDetail(r.Context(), id, opts.Window)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue // deleted since it was listed
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error querying group flight", "group_flight_id", id, "err", err)
+			http.Error(w, "Error querying group flights", http.StatusInternalServerError)
+			return
+		}
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:      site.tag(fmt.Sprintf("group-flight/%d", id)),
+			Title:   fmt.Sprintf("Group flight %s → %s on %s", g.DepartureICAO, g.ArrivalICAO, g.StartTime.Format("Jan 2, 2006")),
+			Updated: atomTime(lastArrivals[i]),
+			Links:   []atomLink{{Rel: "alternate", Href: fmt.Sprintf("%s/group-flights/%d", site.base, id)}},
+			Content: atomContent{Type: "html", Body: groupFlightHTML(g)},
+		})
+		if lastArrivals[i].After(updated) {
+			updated = lastArrivals[i]
+		}
+	}
+	writeFeed(w, feed, updated)
+}
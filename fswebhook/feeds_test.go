@@ -0,0 +1,121 @@
+package fswebhook
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func getFeed(t *testing.T, handler http.HandlerFunc, req *http.Request) atomFeed {
+	t.Helper()
+	FeedAuthority = "va.example.com"
+	t.Cleanup(func() { FeedAuthority = defaultFeedAuthority })
+	// The ids must not follow the name the server was reached by.
+	req.Host = "10.0.0.5:8080"
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/atom+xml") {
+		t.Errorf("expected an Atom content type, got %s", ct)
+	}
+	var feed atomFeed
+	if err := xml.NewDecoder(rr.Body).Decode(&feed); err != nil {
+		t.Fatalf("Failed to decode feed: %v", err)
+	}
+	return feed
+}
+
+func TestFlightsFeeds(t *testing.T) {
+	setupTestDB(t)
+	arrival := time.Date(2024, 5, 10, 14, 30, 0, 0, time.UTC)
+	insertTestFlights(t,
+		testFlight{FlightID: 1, PilotID: 1, PilotName: "Alice", LandingRate: -120, Distance: 300, Duration: 90 * time.Minute,
+			AircraftName: "A320", DepartureICAO: "KJFK", ArrivalICAO: "KBOS", Arrival: arrival},
+		testFlight{FlightID: 2, PilotID: 2, PilotName: "Bob", LandingRate: -250, Distance: 150, Duration: time.Hour,
+			AircraftName: "B738", DepartureICAO: "KBOS", ArrivalICAO: "KPHL", Arrival: arrival.Add(time.Hour)},
+	)
+
+	feed := getFeed(t, FlightsFeedHandler, httptest.NewRequest(http.MethodGet, "/feeds/flights.atom", nil))
+	if feed.ID != "tag:va.example.com,2024:flights" || feed.Updated != "2024-05-10T15:30:00Z" {
+		t.Errorf("unexpected feed id %s or updated %s", feed.ID, feed.Updated)
+	}
+	if len(feed.Entries) != 2 || feed.Entries[0].ID != "tag:va.example.com,2024:flight/2" {
+		t.Fatalf("expected the latest flight first, got %+v", feed.Entries)
+	}
+	alice := feed.Entries[1]
+	if alice.Updated != "2024-05-10T14:30:00Z" || alice.Title != "Alice flew KJFK → KBOS" ||
+		alice.Content.Body != "A320, 300 nm in 1h 30m, landed at -120 fpm." {
+		t.Errorf("unexpected entry %+v", alice)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/pilots/1/flights.atom", nil)
+	req.SetPathValue("id", "1")
+	feed = getFeed(t, PilotFlightsFeedHandler, req)
+	if feed.Title != "Latest flights of Alice" || len(feed.Entries) != 1 || feed.Entries[0].ID != alice.ID {
+		t.Errorf("expected only Alice's flight, got %+v", feed)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/pilots/3/flights.atom", nil)
+	req.SetPathValue("id", "3")
+	rr := httptest.NewRecorder()
+	PilotFlightsFeedHandler(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for a pilot without flights, got %d", rr.Code)
+	}
+}
+
+func TestWeeklyFeed(t *testing.T) {
+	setupTestDB(t)
+	week := getWeeklyDateRanges(1)[0]
+	for i := 0; i < 10; i++ { // pilots need 10 flights to be ranked
+		insertTestFlights(t, testFlight{FlightID: 1 + i, PilotID: 1, PilotName: "Alice <3", LandingRate: -120, Distance: 300,
+			Duration: time.Hour, AircraftName: "A320", DepartureICAO: "KJFK", ArrivalICAO: "KBOS",
+			Arrival: week[0].Add(time.Duration(2*i+1) * time.Hour)})
+	}
+
+	feed := getFeed(t, WeeklyFeedHandler, httptest.NewRequest(http.MethodGet, "/feeds/weekly.atom", nil))
+	if len(feed.Entries) != feedWeeks {
+		t.Fatalf("expected %d weeks, got %d", feedWeeks, len(feed.Entries))
+	}
+	latest := feed.Entries[0]
+	if latest.ID != "tag:va.example.com,2024:week/"+week[0].Format(time.DateOnly) || latest.Updated != atomTime(week[1]) {
+		t.Errorf("unexpected entry id %s or updated %s", latest.ID, latest.Updated)
+	}
+	if latest.Content.Type != "html" || !strings.Contains(latest.Content.Body, "<li>Alice &lt;3: -120 fpm</li>") {
+		t.Errorf("expected the escaped pilot in the results, got %s", latest.Content.Body)
+	}
+	if feed.Updated != latest.Updated {
+		t.Errorf("expected the feed dated by its latest week, got %s", feed.Updated)
+	}
+}
+
+func TestGroupFlightsFeed(t *testing.T) {
+	setupGroupFlightTables(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	insertTestGroupFlight(t, 100, 1, 10, 4, "KJFK", "KBOS", now.Add(-3*time.Hour))
+	insertTestGroupFlight(t, 200, 2, 20, 4, "KBOS", "KPHL", now.Add(-5*time.Minute)) // still landing
+	if _, err := DetectGroupFlights(context.Background(), now.Add(-24*time.Hour)); err != nil {
+		t.Fatalf("DetectGroupFlights returned error: %v", err)
+	}
+
+	feed := getFeed(t, GroupFlightsFeedHandler, httptest.NewRequest(http.MethodGet, "/feeds/group-flights.atom", nil))
+	if len(feed.Entries) != 1 {
+		t.Fatalf("expected only the completed group flight, got %+v", feed.Entries)
+	}
+	entry := feed.Entries[0]
+	if !strings.HasPrefix(entry.ID, "tag:va.example.com,2024:group-flight/") || !strings.HasPrefix(entry.Title, "Group flight KJFK → KBOS") {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+	if lastArrival := atomTime(now.Add(-3*time.Hour + 4*time.Minute)); entry.Updated != lastArrival {
+		t.Errorf("expected the entry dated by the last arrival %s, got %s", lastArrival, entry.Updated)
+	}
+	if !strings.Contains(entry.Content.Body, "5 pilots flew together") {
+		t.Errorf("unexpected content %s", entry.Content.Body)
+	}
+}
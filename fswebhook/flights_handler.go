@@ -1,9 +1,11 @@
 package fswebhook
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 )
@@ -16,6 +18,7 @@ type PilotStats struct {
 	TotalFlights       int     `json:"total_flights"`
 	TotalDistance      int     `json:"total_distance_nm"`
 	TotalHoursFlown    float64 `json:"total_hours_flown"`
+	FuelEfficiency     float64 `json:"fuel_efficiency,omitempty"` // fuel per nm relative to the aircraft type average, lower is better
 }
 
 // getWeeklyDateRange calculates the start and end dates for the weekly report.
@@ -47,26 +50,61 @@ type WeeklyReport struct {
 	TopDistance    []PilotStats `json:"top_distance"`
 	TopFlights     []PilotStats `json:"top_flights"`
 	TopHours       []PilotStats `json:"top_hours"`
+	TopEfficiency  []PilotStats `json:"top_fuel_efficiency"`
 }
 
+// sqlTime formats t for comparison against datetime(arrival_time) in queries.
+func sqlTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// topPilotsQuery describes which flights getTopPilots aggregates and how the pilots are ranked.
+type topPilotsQuery struct {
+	Start, End   time.Time
+	OrderBy      string
+	AircraftICAO string // optional, restricts the ranking to one aircraft type
+	RequireFuel  bool   // only rank pilots with fuel data, used for the efficiency board
+	MinFlights   int
+	Limit        int
+}
+
+// efficiencyOrder ranks pilots by fuel efficiency, most efficient first.
+const efficiencyOrder = "fuel_efficiency ASC"
+
 // getTopPilots is a helper function to query the database for top pilots based on a specific ordering.
-func getTopPilots(start, end time.Time, orderBy string) ([]PilotStats, error) {
+func getTopPilots(ctx context.Context, start, end time.Time, orderBy string) ([]PilotStats, error) {
+	return queryTopPilots(ctx, topPilotsQuery{
+		Start:       start,
+		End:         end,
+		OrderBy:     orderBy,
+		RequireFuel: orderBy == efficiencyOrder,
+		MinFlights:  LeaderboardSettings.MinFlights,
+		Limit:       LeaderboardSettings.Size,
+	})
+}
+
+// queryTopPilots aggregates per-pilot stats for the flights matching q.
+func queryTopPilots(ctx context.Context, q topPilotsQuery) ([]PilotStats, error) {
+	defer timeQuery(ctx, "top_pilots")()
 	baseQuery := `
 		SELECT
-			pilotname,
-			pilotid,
-			AVG(landing_rate) AS avg_landing_rate,
-			COUNT(flightid) AS total_flights,
-			SUM(distance) AS total_distance,
-			SUM(time) / 3600.0 AS total_hours
-		FROM flights
-		WHERE arrival_time >= ? AND arrival_time < ?
-		GROUP BY pilotid, pilotname
-		HAVING COUNT(flightid) >= 10
+			f.pilotname,
+			f.pilotid,
+			AVG(f.landing_rate) AS avg_landing_rate,
+			COUNT(f.flightid) AS total_flights,
+			SUM(f.distance) AS total_distance,
+			SUM(f.time) / 3600.0 AS total_hours,
+			AVG(` + flightEfficiencyExpr + `) AS fuel_efficiency
+		FROM flights AS f
+		LEFT JOIN (` + aircraftFuelBaselineQuery + `) AS t ON t.aircraft_icao = f.aircraft_icao
+		WHERE datetime(f.arrival_time) >= datetime(?) AND datetime(f.arrival_time) < datetime(?)
+			AND (? = '' OR f.aircraft_icao = ?)
+		GROUP BY f.pilotid, f.pilotname
+		HAVING COUNT(f.flightid) >= ? AND (? = 0 OR fuel_efficiency IS NOT NULL)
 	`
-	query := fmt.Sprintf("%s ORDER BY %s LIMIT 10", baseQuery, orderBy)
+	query := fmt.Sprintf("%s ORDER BY %s LIMIT %d", baseQuery, q.OrderBy, q.Limit)
 
-	rows, err := db.Query(query, start, end)
+	rows, err := db.QueryContext(ctx, query, sqlTime(q.Start), sqlTime(q.End), q.AircraftICAO, q.AircraftICAO, q.MinFlights, q.RequireFuel)
 	if err != nil {
 		return nil, err
 	}
@@ -75,56 +113,96 @@ func getTopPilots(start, end time.Time, orderBy string) ([]PilotStats, error) {
 	var stats []PilotStats
 	for rows.Next() {
 		var ps PilotStats
-		err := rows.Scan(&ps.PilotName, &ps.PilotID, &ps.AverageLandingRate, &ps.TotalFlights, &ps.TotalDistance, &ps.TotalHoursFlown)
+		var efficiency sql.NullFloat64
+		err := rows.Scan(&ps.PilotName, &ps.PilotID, &ps.AverageLandingRate, &ps.TotalFlights, &ps.TotalDistance, &ps.TotalHoursFlown, &efficiency)
 		if err != nil {
-			log.Printf("Error scanning pilot stats: %v", err)
+			slog.ErrorContext(ctx, "Error scanning pilot stats", "err", err)
 			return nil, err
 		}
+		ps.FuelEfficiency = efficiency.Float64
 		stats = append(stats, ps)
 	}
 	return stats, nil
 }
 
-// FlightsHandler calculates and returns categorized top 10 pilot reports for the last few weeks.
-func FlightsHandler(w http.ResponseWriter, r *http.Request) {
-	weeklyReports := []WeeklyReport{}
-	dateRanges := getWeeklyDateRanges(3) // Get data for the last 3 weeks
+// periodFromRequest reads the reporting period from the "period", "start" and "end" query parameters.
+func periodFromRequest(r *http.Request) (time.Time, time.Time, error) {
+	q := r.URL.Query()
+	return ParsePeriod(q.Get("period"), q.Get("start"), q.Get("end"))
+}
 
-	for _, dr := range dateRanges {
-		start, end := dr[0], dr[1]
+// ParsePeriod returns the start and end of a reporting period. "week" selects the most
+// recently completed week, "month" the last month and "all" (or "") every flight on record.
+// Explicit start/end dates (YYYY-MM-DD) override the period.
+func ParsePeriod(period, startDate, endDate string) (time.Time, time.Time, error) {
+	start := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Now().UTC().AddDate(0, 0, 1)
+
+	switch period {
+	case "", "all":
+	case "week":
+		week := getWeeklyDateRanges(1)[0]
+		start, end = week[0], week[1]
+	case "month":
+		start = end.AddDate(0, -1, 0)
+	default:
+		return start, end, fmt.Errorf("unknown period %q", period)
+	}
 
-		topLandingRate, err := getTopPilots(start, end, "avg_landing_rate DESC")
+	if startDate != "" {
+		t, err := time.Parse(time.DateOnly, startDate)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return start, end, fmt.Errorf("invalid start date %q", startDate)
 		}
-
-		topDistance, err := getTopPilots(start, end, "total_distance DESC")
+		start = t
+	}
+	if endDate != "" {
+		t, err := time.Parse(time.DateOnly, endDate)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return start, end, fmt.Errorf("invalid end date %q", endDate)
 		}
+		end = t
+	}
+	if !end.After(start) {
+		return start, end, fmt.Errorf("end date must be after start date")
+	}
+	return start, end, nil
+}
 
-		topFlights, err := getTopPilots(start, end, "total_flights DESC")
+// GetWeeklyReport ranks the pilots who flew between start and end in every category.
+func GetWeeklyReport(ctx context.Context, start, end time.Time) (WeeklyReport, error) {
+	report := WeeklyReport{StartDate: start, EndDate: end}
+	for _, category := range []struct {
+		orderBy string
+		dest    *[]PilotStats
+	}{
+		{"avg_landing_rate DESC", &report.TopLandingRate},
+		{"total_distance DESC", &report.TopDistance},
+		{"total_flights DESC", &report.TopFlights},
+		{"total_hours DESC", &report.TopHours},
+		{efficiencyOrder, &report.TopEfficiency},
+	} {
+		top, err := getTopPilots(ctx, start, end, category.orderBy)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return report, err
 		}
+		*category.dest = top
+	}
+	return report, nil
+}
 
-		topHours, err := getTopPilots(start, end, "total_hours DESC")
+// FlightsHandler calculates and returns categorized top pilot reports for the last few weeks.
+func FlightsHandler(w http.ResponseWriter, r *http.Request) {
+	weeklyReports := []WeeklyReport{}
+	dateRanges := getWeeklyDateRanges(LeaderboardSettings.Weeks)
+
+	for _, dr := range dateRanges {
+		report, err := GetWeeklyReport(r.Context(), dr[0], dr[1])
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-
-		weeklyReports = append(weeklyReports, WeeklyReport{
-			StartDate:      start,
-			EndDate:        end,
-			TopLandingRate: topLandingRate,
-			TopDistance:    topDistance,
-			TopFlights:     topFlights,
-			TopHours:       topHours,
-		})
+		weeklyReports = append(weeklyReports, report)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,241 @@
+package fswebhook
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// formationMinGroups is the default number of group flights a pilot needs to appear on the
+// formation leaderboard.
+const formationMinGroups = 3
+
+// FormationStats struct to hold how closely a group flight stayed together
+type FormationStats struct {
+	DepartureSpreadSeconds int     `json:"departure_spread_seconds"`
+	ArrivalSpreadSeconds   int     `json:"arrival_spread_seconds"`
+	MedianDelaySeconds     int     `json:"median_delay_seconds"` // median arrival behind the leader
+	Score                  float64 `json:"score"`                // average stuck-with-the-group score, 0-100
+}
+
+// FormationLeader struct to hold a pilot's formation record across group flights
+type FormationLeader struct {
+	PilotID            int     `json:"pilot_id"`
+	PilotName          string  `json:"pilot_name"`
+	GroupFlights       int     `json:"group_flights"`
+	AverageScore       float64 `json:"average_score"`
+	MedianDelaySeconds int     `json:"median_delay_seconds"`
+}
+
+// scoreFormation measures each pilot against the group's reference times and fills in their
+// delays and stuck-with-the-group score. The leader's departure and arrival are the reference;
+// leaderless groups are measured against their median departure and arrival instead.
+// A pilot departing and arriving with the reference scores 100, falling to 0 as their larger
+// deviation reaches the window. The leader is left out of the group's median delay and score.
+func scoreFormation(pilots []GroupFlightPilot, window time.Duration) FormationStats {
+	var stats FormationStats
+	if len(pilots) == 0 {
+		return stats
+	}
+
+	departures := make([]time.Time, len(pilots))
+	arrivals := make([]time.Time, len(pilots))
+	var refDeparture, refArrival time.Time
+	hasLeader := false
+	for i, p := range pilots {
+		departures[i], arrivals[i] = p.DepartureTime, p.ArrivalTime
+		if p.IsLeader {
+			refDeparture, refArrival, hasLeader = p.DepartureTime, p.ArrivalTime, true
+		}
+	}
+	sortTimes(departures)
+	sortTimes(arrivals)
+	stats.DepartureSpreadSeconds = int(departures[len(departures)-1].Sub(departures[0]).Seconds())
+	stats.ArrivalSpreadSeconds = int(arrivals[len(arrivals)-1].Sub(arrivals[0]).Seconds())
+	if !hasLeader {
+		refDeparture, refArrival = medianTime(departures), medianTime(arrivals)
+	}
+
+	var delays []int
+	var total float64
+	for i := range pilots {
+		p := &pilots[i]
+		p.DepartureDelaySeconds = int(p.DepartureTime.Sub(refDeparture).Seconds())
+		p.ArrivalDelaySeconds = int(p.ArrivalTime.Sub(refArrival).Seconds())
+		deviation := math.Max(math.Abs(float64(p.DepartureDelaySeconds)), math.Abs(float64(p.ArrivalDelaySeconds)))
+		p.StuckScore = math.Round(1000*math.Max(0, 1-deviation/window.Seconds())) / 10
+		if !p.IsLeader {
+			delays = append(delays, p.ArrivalDelaySeconds)
+			total += p.StuckScore
+		}
+	}
+	if len(delays) > 0 {
+		stats.MedianDelaySeconds = medianInt(delays)
+		stats.Score = math.Round(10*total/float64(len(delays))) / 10
+	}
+	return stats
+}
+
+func sortTimes(times []time.Time) {
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+}
+
+// medianTime returns the median of sorted times, halfway between the middle two for an even count.
+func medianTime(sorted []time.Time) time.Time {
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[mid]
+	}
+	return sorted[mid-1].Add(sorted[mid].Sub(sorted[mid-1]) / 2)
+}
+
+func medianInt(values []int) int {
+	sorted := make([]int, len(values))
+	copy(sorted, values)
+	sort.Ints(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[mid]
+	}
+	return (sorted[mid-1] + sorted[mid]) / 2
+}
+
+// getFormationLeaderboard ranks pilots by their average stuck-with-the-group score over the
+// group flights of at least opts.MinPilots pilots that started between start and end, scored
+// against opts.Window. Leaders are not scored on the groups they led.
+func getFormationLeaderboard(ctx context.Context, start, end time.Time, opts GroupFlightOptions, minGroups, limit int) ([]FormationLeader, error) {
+	defer timeQuery(ctx, "formation_leaderboard")()
+	const condition = `datetime(g.first_arrival) >= datetime(?) AND datetime(g.first_arrival) < datetime(?)
+		AND g.total_pilots >= ?`
+	args := []any{sqlTime(start), sqlTime(end), opts.MinPilots}
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+groupFlightColumns+`
+		FROM group_flights AS g
+		WHERE `+condition+`
+		ORDER BY datetime(first_arrival)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []GroupFlight
+	for rows.Next() {
+		g, err := scanGroupFlight(rows)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// Every roster in one go, rather than a query per group flight.
+	pilotsByGroup, err := queryGroupFlightPilots(ctx, condition, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	type pilotRecord struct {
+		name   string
+		scores []float64
+		delays []int
+	}
+	records := make(map[int]*pilotRecord)
+	for i := range groups {
+		pilots := pilotsByGroup[groups[i].ID]
+		markGroupFlightLeader(&groups[i], pilots)
+		scoreFormation(pilots, opts.Window)
+		for _, p := range pilots {
+			if p.IsLeader {
+				continue
+			}
+			rec := records[p.PilotID]
+			if rec == nil {
+				rec = &pilotRecord{}
+				records[p.PilotID] = rec
+			}
+			rec.name = p.PilotName
+			rec.scores = append(rec.scores, p.StuckScore)
+			rec.delays = append(rec.delays, p.ArrivalDelaySeconds)
+		}
+	}
+
+	leaders := []FormationLeader{}
+	for id, rec := range records {
+		if len(rec.scores) < minGroups {
+			continue
+		}
+		var total float64
+		for _, s := range rec.scores {
+			total += s
+		}
+		leaders = append(leaders, FormationLeader{
+			PilotID:            id,
+			PilotName:          rec.name,
+			GroupFlights:       len(rec.scores),
+			AverageScore:       math.Round(10*total/float64(len(rec.scores))) / 10,
+			MedianDelaySeconds: medianInt(rec.delays),
+		})
+	}
+	sort.Slice(leaders, func(i, j int) bool {
+		a, b := leaders[i], leaders[j]
+		if a.AverageScore != b.AverageScore {
+			return a.AverageScore > b.AverageScore
+		}
+		if a.GroupFlights != b.GroupFlights {
+			return a.GroupFlights > b.GroupFlights
+		}
+		return a.PilotID < b.PilotID
+	})
+	if len(leaders) > limit {
+		leaders = leaders[:limit]
+	}
+	return leaders, nil
+}
+
+// FormationLeaderboardHandler returns the pilots who stick with the group best across group
+// flights in the requested period. "min_groups" sets how many group flights a pilot needs;
+// "window" and "min_pilots" override the server's group flight options.
+func FormationLeaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	start, end, err := periodFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts, err := groupFlightOptionsFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, ok := limitFromRequest(r, defaultListLimit)
+	if !ok {
+		http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+		return
+	}
+	minGroups := formationMinGroups
+	if s := r.URL.Query().Get("min_groups"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			http.Error(w, "min_groups must be a positive number", http.StatusBadRequest)
+			return
+		}
+		minGroups = n
+	}
+
+	leaders, err := getFormationLeaderboard(r.Context(), start, end, opts, minGroups, limit)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error querying formation leaderboard", "err", err)
+		http.Error(w, "Error querying formation leaderboard", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(leaders)
+}
@@ -0,0 +1,110 @@
+package fswebhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestScoreFormation(t *testing.T) {
+	base := time.Date(2025, 7, 24, 20, 0, 0, 0, time.UTC)
+	pilot := func(id int, leader bool, departure, arrival time.Duration) GroupFlightPilot {
+		return GroupFlightPilot{PilotID: id, IsLeader: leader,
+			DepartureTime: base.Add(departure), ArrivalTime: base.Add(time.Hour + arrival)}
+	}
+
+	pilots := []GroupFlightPilot{
+		pilot(1, true, 0, 0),
+		pilot(2, false, time.Minute, 2*time.Minute),     // close behind
+		pilot(3, false, 0, 15*time.Minute),              // half the window late
+		pilot(4, false, -40*time.Minute, 4*time.Minute), // left well ahead
+		pilot(5, false, 2*time.Minute, 3*time.Minute),   // close behind
+	}
+	stats := scoreFormation(pilots, 30*time.Minute)
+
+	wantScores := []float64{100, 93.3, 50, 0, 90}
+	for i, want := range wantScores {
+		if pilots[i].StuckScore != want {
+			t.Errorf("pilot %d: expected score %.1f, got %.1f", pilots[i].PilotID, want, pilots[i].StuckScore)
+		}
+	}
+	if pilots[2].ArrivalDelaySeconds != 900 {
+		t.Errorf("expected pilot 3 to arrive 900s behind the leader, got %d", pilots[2].ArrivalDelaySeconds)
+	}
+	// Followers arrive 2, 3, 4 and 15 minutes behind the leader.
+	if stats.MedianDelaySeconds != 210 {
+		t.Errorf("expected a median delay of 210s, got %d", stats.MedianDelaySeconds)
+	}
+	if stats.ArrivalSpreadSeconds != 900 || stats.DepartureSpreadSeconds != 2520 {
+		t.Errorf("expected spreads of 2520s and 900s, got %+v", stats)
+	}
+	// The leader is not part of the group's score.
+	if stats.Score != 58.3 {
+		t.Errorf("expected a group score of 58.3, got %.1f", stats.Score)
+	}
+
+	// Without a leader, pilots are measured against the group's median times.
+	leaderless := []GroupFlightPilot{pilot(1, false, 0, 0), pilot(2, false, 0, 6*time.Minute), pilot(3, false, 0, 12*time.Minute)}
+	stats = scoreFormation(leaderless, 30*time.Minute)
+	if leaderless[0].ArrivalDelaySeconds != -360 || leaderless[1].StuckScore != 100 {
+		t.Errorf("expected pilots measured against the median arrival, got %+v", leaderless)
+	}
+	if stats.MedianDelaySeconds != 0 || stats.Score != 86.7 {
+		t.Errorf("expected median delay 0 and score 86.7, got %+v", stats)
+	}
+}
+
+func TestFormationLeaderboardHandler(t *testing.T) {
+	setupGroupFlightTables(t)
+	if err := AddGroupFlightLeaders(context.Background(), []int{1}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	// Three group flights led by pilot 1 with the same followers; pilot 13 always trails furthest.
+	for i := 0; i < 3; i++ {
+		insertTestGroupFlight(t, 100*(i+1), 1, 10, 4, "KJFK", "KBOS", now.Add(-time.Duration(2+i*24)*time.Hour))
+	}
+	if _, err := DetectGroupFlights(context.Background(), now.Add(-7*24*time.Hour)); err != nil {
+		t.Fatalf("DetectGroupFlights returned error: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	FormationLeaderboardHandler(rr, httptest.NewRequest(http.MethodGet, "/group-flights/leaderboard", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var leaders []FormationLeader
+	if err := json.NewDecoder(rr.Body).Decode(&leaders); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(leaders) != 4 {
+		t.Fatalf("expected the 4 followers on the leaderboard, got %+v", leaders)
+	}
+	if leaders[0].PilotID != 10 || leaders[0].GroupFlights != 3 || leaders[0].MedianDelaySeconds != 60 {
+		t.Errorf("expected pilot 10 first with 3 groups 60s behind, got %+v", leaders[0])
+	}
+	if leaders[3].PilotID != 13 {
+		t.Errorf("expected the last follower at the bottom, got %+v", leaders[3])
+	}
+	for _, l := range leaders {
+		if l.PilotID == 1 {
+			t.Errorf("the leader should not be scored on their own group flights")
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	FormationLeaderboardHandler(rr, httptest.NewRequest(http.MethodGet, "/group-flights/leaderboard?min_groups=4", nil))
+	if err := json.NewDecoder(rr.Body).Decode(&leaders); err != nil || len(leaders) != 0 {
+		t.Errorf("expected nobody with 4 group flights, got %+v (%v)", leaders, err)
+	}
+
+	rr = httptest.NewRecorder()
+	FormationLeaderboardHandler(rr, httptest.NewRequest(http.MethodGet, "/group-flights/leaderboard?min_groups=0", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for min_groups=0, got %d", rr.Code)
+	}
+}
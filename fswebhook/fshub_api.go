@@ -0,0 +1,224 @@
+package fswebhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// fshubAPIURL is the FSHub API updatedb.py imports flights from.
+const fshubAPIURL = "https://fshub.io/api/v3"
+
+// syncPageSize is how many flights are requested per page, the most the API returns.
+const syncPageSize = 100
+
+// APIFlight struct to hold a flight as listed by the FSHub API. It differs from the
+// webhook's FlightData: airports and times sit directly under departure and arrival, and
+// the duration and fuel come precomputed.
+type APIFlight struct {
+	ID          int         `json:"id"`
+	User        User        `json:"user"`
+	LandingRate float64     `json:"landing_rate"`
+	Distance    APIDistance `json:"distance"`
+	Time        int         `json:"time"` // seconds
+	Aircraft    Aircraft    `json:"aircraft"`
+	Departure   APIAirport  `json:"departure"`
+	Arrival     APIAirport  `json:"arrival"`
+	FuelUsed    float64     `json:"fuel_used"`
+}
+
+// APIDistance struct to hold a flight's distance as listed by the FSHub API
+type APIDistance struct {
+	NM float64 `json:"nm"`
+}
+
+// APIAirport struct to hold one end of a flight as listed by the FSHub API
+type APIAirport struct {
+	ICAO string `json:"icao"`
+	Time string `json:"time"`
+}
+
+// flightData returns the flight in the webhook's shape, for validation.
+func (f APIFlight) flightData() FlightData {
+	return FlightData{
+		ID:        f.ID,
+		User:      f.User,
+		Aircraft:  f.Aircraft,
+		Departure: Departure{Airport: Airport{ICAO: f.Departure.ICAO}, DateTime: f.Departure.Time},
+		Arrival:   Arrival{Airport: Airport{ICAO: f.Arrival.ICAO}, LandingRate: int(f.LandingRate), DateTime: f.Arrival.Time},
+		Distance:  Distance{NM: int(f.Distance.NM)},
+		FuelBurnt: f.FuelUsed,
+	}
+}
+
+// normalize validates the flight as the webhook would and returns it with its times in
+// RFC 3339, the duration worked out from them when the listing left it out.
+func (f APIFlight) normalize() (APIFlight, *Rejection) {
+	if rejection := ValidateFlight(f.flightData(), IngestSettings); rejection != nil {
+		return f, rejection
+	}
+	departure, _ := parseFlightTime(f.Departure.Time)
+	arrival, _ := parseFlightTime(f.Arrival.Time)
+	f.Departure.Time = departure.Format(time.RFC3339)
+	f.Arrival.Time = arrival.Format(time.RFC3339)
+	if f.Time == 0 {
+		f.Time = int(arrival.Sub(departure).Seconds())
+	}
+	return f, nil
+}
+
+// ImportResult struct to hold how many flights an import stored or passed over
+type ImportResult struct {
+	Inserted int `json:"inserted"`
+	Skipped  int `json:"skipped"` // already on record
+	Invalid  int `json:"invalid"`
+}
+
+func (r *ImportResult) add(other ImportResult) {
+	r.Inserted += other.Inserted
+	r.Skipped += other.Skipped
+	r.Invalid += other.Invalid
+}
+
+// storeAPIFlights inserts the flights not already on record, in one transaction. Flights
+// failing validation are recorded as rejected from source.
+func storeAPIFlights(ctx context.Context, source string, flights []APIFlight) (ImportResult, error) {
+	var result ImportResult
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT OR IGNORE INTO flights (
+			flightid, pilotid, pilotname, landing_rate, distance, "time",
+			aircraft_icao, aircraft_name, departure_icao, arrival_icao, fuel_used,
+			departure_time, arrival_time
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return result, err
+	}
+	defer stmt.Close()
+
+	for _, f := range flights {
+		f, rejection := f.normalize()
+		if rejection != nil {
+			recordRejection(ctx, tx, source, f.flightData(), rejection)
+			result.Invalid++
+			continue
+		}
+		res, err := stmt.ExecContext(ctx,
+			f.ID, f.User.ID, f.User.Name, f.LandingRate, f.Distance.NM, f.Time,
+			f.Aircraft.ICAO, f.Aircraft.Name, f.Departure.ICAO, f.Arrival.ICAO, f.FuelUsed,
+			f.Departure.Time, f.Arrival.Time)
+		if err != nil {
+			return result, fmt.Errorf("inserting flight %d: %w", f.ID, err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			result.Skipped++
+		} else {
+			result.Inserted++
+		}
+	}
+	return result, tx.Commit()
+}
+
+// apiFlightPage struct to hold one page of the airline flight listing
+type apiFlightPage struct {
+	Data []APIFlight `json:"data"`
+	Meta struct {
+		Cursor struct {
+			Next json.Number `json:"next"`
+		} `json:"cursor"`
+	} `json:"meta"`
+}
+
+// FSHubClient reads from the FSHub API with a pilot's API token.
+type FSHubClient struct {
+	BaseURL string
+	Token   string
+	Client  *http.Client
+}
+
+// NewFSHubClient returns a client for the public FSHub API.
+func NewFSHubClient(token string) *FSHubClient {
+	return &FSHubClient{
+		BaseURL: fshubAPIURL,
+		Token:   token,
+		Client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// airlineFlights fetches one page of an airline's flights after the cursor. A nil page
+// means there are no more.
+func (c *FSHubClient) airlineFlights(ctx context.Context, airlineID int, cursor string) (*apiFlightPage, error) {
+	params := url.Values{"limit": {strconv.Itoa(syncPageSize)}}
+	if cursor != "" {
+		params.Set("cursor", cursor)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s/airline/%d/flight?%s", c.BaseURL, airlineID, params.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Pilot-Token", c.Token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// The API answers 404 past the last page.
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching flights: %s", resp.Status)
+	}
+	var page apiFlightPage
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("decoding flights: %w", err)
+	}
+	return &page, nil
+}
+
+// SyncFlights imports the airline's flights newer than the latest on record, as updatedb.py
+// does, storing each page as it arrives.
+func SyncFlights(ctx context.Context, client *FSHubClient, airlineID int) (ImportResult, error) {
+	var result ImportResult
+	var maxID int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(flightid), 0) FROM flights`).Scan(&maxID); err != nil {
+		return result, err
+	}
+
+	cursor := ""
+	if maxID > 0 {
+		cursor = strconv.Itoa(maxID)
+	}
+	for {
+		page, err := client.airlineFlights(ctx, airlineID, cursor)
+		if err != nil || page == nil {
+			return result, err
+		}
+		stored, err := storeAPIFlights(ctx, sourceSync, page.Data)
+		result.add(stored)
+		if err != nil {
+			return result, err
+		}
+		slog.DebugContext(ctx, "Synced flight page", "flights", len(page.Data), "cursor", cursor)
+
+		next := page.Meta.Cursor.Next.String()
+		if next == "" || next == "0" || next == cursor {
+			return result, nil
+		}
+		cursor = next
+	}
+}
@@ -0,0 +1,101 @@
+package fswebhook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// apiFlightJSON returns a flight as listed by the FSHub API.
+func apiFlightJSON(id int, aircraftICAO string) string {
+	return fmt.Sprintf(`{
+		"id": %d,
+		"user": {"id": 7, "name": "Alice"},
+		"landing_rate": -85,
+		"distance": {"nm": 412.5, "km": 764},
+		"time": 5400,
+		"aircraft": {"icao": %q, "name": "Airbus A320"},
+		"departure": {"icao": "KJFK", "time": "2025-07-24T20:00:00.000000Z"},
+		"arrival": {"icao": "KBOS", "time": "2025-07-24T21:30:00.000000Z"},
+		"fuel_used": 2500
+	}`, id, aircraftICAO)
+}
+
+func TestSyncFlights(t *testing.T) {
+	setupTestDB(t)
+	insertTestFlights(t, testFlight{FlightID: 100, PilotID: 7, PilotName: "Alice"})
+
+	var cursors []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/airline/6076/flight" || r.Header.Get("X-Pilot-Token") != "test-token" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		cursor := r.URL.Query().Get("cursor")
+		cursors = append(cursors, cursor)
+		switch cursor {
+		case "100":
+			fmt.Fprintf(w, `{"data": [%s, %s], "meta": {"cursor": {"current": 100, "next": 102}}}`,
+				apiFlightJSON(101, "A320"), apiFlightJSON(102, "A320"))
+		case "102":
+			// The last page repeats a flight and carries one without an aircraft.
+			fmt.Fprintf(w, `{"data": [%s, %s], "meta": {"cursor": {"current": 102, "next": null}}}`,
+				apiFlightJSON(102, "A320"), apiFlightJSON(103, ""))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := NewFSHubClient("test-token")
+	client.BaseURL = server.URL
+	result, err := SyncFlights(context.Background(), client, 6076)
+	if err != nil {
+		t.Fatalf("SyncFlights returned error: %v", err)
+	}
+	if result != (ImportResult{Inserted: 2, Skipped: 1, Invalid: 1}) {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if strings.Join(cursors, ",") != "100,102" {
+		t.Errorf("expected pages fetched after the latest flight on record, got cursors %v", cursors)
+	}
+
+	var distance float64
+	var departure, aircraft string
+	if err := db.QueryRow(`SELECT distance, departure_time, aircraft_icao FROM flights WHERE flightid = 101`).Scan(&distance, &departure, &aircraft); err != nil {
+		t.Fatalf("Failed to read synced flight: %v", err)
+	}
+	if dep, _ := parseFlightTime(departure); distance != 412.5 || !dep.Equal(time.Date(2025, 7, 24, 20, 0, 0, 0, time.UTC)) || aircraft != "A320" {
+		t.Errorf("unexpected synced flight: %v %s %s", distance, departure, aircraft)
+	}
+}
+
+func TestImportFlightsJSON(t *testing.T) {
+	setupTestDB(t)
+
+	// Both a bare list and a page saved from the API are accepted.
+	for _, input := range []string{
+		"[" + apiFlightJSON(1, "A320") + "," + apiFlightJSON(2, "B738") + "]",
+		`{"data": [` + apiFlightJSON(2, "B738") + "," + apiFlightJSON(3, "C172") + `], "meta": {}}`,
+	} {
+		if _, err := ImportFlightsJSON(context.Background(), strings.NewReader(input)); err != nil {
+			t.Fatalf("ImportFlightsJSON returned error: %v", err)
+		}
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM flights`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 flights imported, got %d", count)
+	}
+
+	if _, err := ImportFlightsJSON(context.Background(), strings.NewReader("not json")); err == nil {
+		t.Error("expected an error importing a file that is not JSON")
+	}
+}
@@ -0,0 +1,124 @@
+package fswebhook
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// aircraftFuelBaselineQuery computes the average fuel burnt per nm for every aircraft type.
+// Pilots are compared against the baseline of the type they flew, so a heavy jet is not
+// penalised next to a Cessna.
+const aircraftFuelBaselineQuery = `
+	SELECT aircraft_icao,
+		SUM(fuel_used) * 1.0 / SUM(distance) AS fuel_per_nm
+	FROM flights
+	WHERE distance > 0 AND fuel_used > 0
+	GROUP BY aircraft_icao`
+
+// flightEfficiencyExpr is a flight's fuel per nm divided by its type baseline: 1.0 is average,
+// lower is better. It expects the flight aliased as f and the baseline as t.
+const flightEfficiencyExpr = `
+	CASE WHEN f.distance > 0 AND f.fuel_used > 0 AND t.fuel_per_nm > 0
+		THEN (f.fuel_used * 1.0 / f.distance) / t.fuel_per_nm
+	END`
+
+// FlightEfficiency struct to hold the derived fuel metrics of a single flight
+type FlightEfficiency struct {
+	FlightID          int       `json:"flightid"`
+	PilotID           int       `json:"pilotid"`
+	PilotName         string    `json:"pilotname"`
+	AircraftICAO      string    `json:"aircraft_icao"`
+	DepartureICAO     string    `json:"departure_icao"`
+	ArrivalICAO       string    `json:"arrival_icao"`
+	ArrivalTime       time.Time `json:"arrival_time"`
+	FuelUsed          float64   `json:"fuel_used"`
+	FuelPerNM         float64   `json:"fuel_per_nm"`
+	FuelPerHour       float64   `json:"fuel_per_hour"`
+	AircraftFuelPerNM float64   `json:"aircraft_fuel_per_nm"`
+	FuelEfficiency    float64   `json:"fuel_efficiency"`
+}
+
+// getFlightEfficiencies returns the fuel metrics of the most recent flights with fuel data.
+// A zero pilotID returns flights for every pilot.
+func getFlightEfficiencies(ctx context.Context, pilotID, limit int) ([]FlightEfficiency, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT f.flightid,
+			f.pilotid,
+			f.pilotname,
+			f.aircraft_icao,
+			f.departure_icao,
+			f.arrival_icao,
+			f.arrival_time,
+			f.fuel_used,
+			f.fuel_used * 1.0 / f.distance,
+			CASE WHEN f.time > 0 THEN f.fuel_used * 3600.0 / f.time END,
+			t.fuel_per_nm,
+			`+flightEfficiencyExpr+`
+		FROM flights AS f
+		LEFT JOIN (`+aircraftFuelBaselineQuery+`) AS t ON t.aircraft_icao = f.aircraft_icao
+		WHERE f.distance > 0 AND f.fuel_used > 0
+			AND (? = 0 OR f.pilotid = ?)
+		ORDER BY f.arrival_time DESC
+		LIMIT ?`,
+		pilotID, pilotID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var flights []FlightEfficiency
+	for rows.Next() {
+		var fe FlightEfficiency
+		var arrivalTime string
+		var fuelPerHour, baseline, efficiency sql.NullFloat64
+		if err := rows.Scan(&fe.FlightID, &fe.PilotID, &fe.PilotName, &fe.AircraftICAO, &fe.DepartureICAO,
+			&fe.ArrivalICAO, &arrivalTime, &fe.FuelUsed, &fe.FuelPerNM, &fuelPerHour, &baseline, &efficiency); err != nil {
+			slog.Error("Error scanning flight efficiency", "err", err)
+			return nil, err
+		}
+		if fe.ArrivalTime, err = parseFlightTime(arrivalTime); err != nil {
+			slog.Warn("Error parsing arrival time", "flight_id", fe.FlightID, "err", err)
+		}
+		fe.FuelPerHour = fuelPerHour.Float64
+		fe.AircraftFuelPerNM = baseline.Float64
+		fe.FuelEfficiency = efficiency.Float64
+		flights = append(flights, fe)
+	}
+	return flights, rows.Err()
+}
+
+// EfficiencyHandler returns fuel per nm, fuel per hour and the type-normalised efficiency
+// of recent flights, optionally for a single pilot (?pilot=<id>).
+func EfficiencyHandler(w http.ResponseWriter, r *http.Request) {
+	pilotID := 0
+	if s := r.URL.Query().Get("pilot"); s != "" {
+		id, err := strconv.Atoi(s)
+		if err != nil || id < 1 {
+			http.Error(w, "pilot must be a pilot ID", http.StatusBadRequest)
+			return
+		}
+		pilotID = id
+	}
+	limit, ok := limitFromRequest(r, defaultListLimit)
+	if !ok {
+		http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+		return
+	}
+
+	flights, err := getFlightEfficiencies(r.Context(), pilotID, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if flights == nil {
+		flights = []FlightEfficiency{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(flights)
+}
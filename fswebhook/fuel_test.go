@@ -0,0 +1,67 @@
+package fswebhook
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestFuelEfficiency(t *testing.T) {
+	setupTestDB(t)
+
+	arrival := time.Now().UTC().Add(-time.Hour)
+	var flights []testFlight
+	for i := 0; i < 10; i++ {
+		// Alice burns 10/nm in a type averaging 12.5/nm, Bob burns 0.5/nm in a type averaging
+		// 0.4/nm. Bob burns far less fuel, but Alice is the more efficient pilot for her type.
+		flights = append(flights,
+			testFlight{FlightID: 1000 + i, PilotID: 1, PilotName: "Alice", Distance: 100, Duration: time.Hour,
+				AircraftICAO: "A320", FuelUsed: 1000, Arrival: arrival},
+			testFlight{FlightID: 2000 + i, PilotID: 2, PilotName: "Bob", Distance: 100, Duration: time.Hour,
+				AircraftICAO: "C172", FuelUsed: 50, Arrival: arrival},
+			testFlight{FlightID: 3000 + i, PilotID: 3, PilotName: "Carol", Distance: 100, Duration: time.Hour,
+				AircraftICAO: "A320", FuelUsed: 1500, Arrival: arrival},
+			testFlight{FlightID: 4000 + i, PilotID: 4, PilotName: "Dave", Distance: 100, Duration: time.Hour,
+				AircraftICAO: "C172", FuelUsed: 30, Arrival: arrival},
+		)
+	}
+	insertTestFlights(t, flights...)
+
+	stats, err := getTopPilots(context.Background(), arrival.Add(-time.Hour), arrival.Add(time.Hour), efficiencyOrder)
+	if err != nil {
+		t.Fatalf("getTopPilots returned error: %v", err)
+	}
+	if len(stats) != 4 {
+		t.Fatalf("expected 4 pilots, got %d", len(stats))
+	}
+
+	want := []struct {
+		name       string
+		efficiency float64
+	}{
+		{"Dave", 0.75},
+		{"Alice", 0.8},
+		{"Carol", 1.2},
+		{"Bob", 1.25},
+	}
+	for i, w := range want {
+		if stats[i].PilotName != w.name {
+			t.Errorf("rank %d: expected %s, got %s", i+1, w.name, stats[i].PilotName)
+		}
+		if math.Abs(stats[i].FuelEfficiency-w.efficiency) > 1e-9 {
+			t.Errorf("rank %d: expected efficiency %f, got %f", i+1, w.efficiency, stats[i].FuelEfficiency)
+		}
+	}
+
+	perFlight, err := getFlightEfficiencies(context.Background(), 1, 1)
+	if err != nil {
+		t.Fatalf("getFlightEfficiencies returned error: %v", err)
+	}
+	if len(perFlight) != 1 {
+		t.Fatalf("expected 1 flight, got %d", len(perFlight))
+	}
+	if perFlight[0].FuelPerNM != 10 || perFlight[0].FuelPerHour != 1000 || perFlight[0].AircraftFuelPerNM != 12.5 {
+		t.Errorf("unexpected fuel metrics: %+v", perFlight[0])
+	}
+}
@@ -0,0 +1,353 @@
+package fswebhook
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GroupFlightOptions tunes how group flights are recognised.
+type GroupFlightOptions struct {
+	Window    time.Duration // arrivals this close to one another belong to the same group
+	MinPilots int           // fewest distinct pilots that count as a group flight
+	Top       int           // landings listed per group flight, besides the leader's
+}
+
+// GroupFlightSettings are the server-wide group flight options.
+var GroupFlightSettings = GroupFlightOptions{
+	Window:    30 * time.Minute,
+	MinPilots: 5,
+	Top:       5,
+}
+
+// Validate checks the options are within the bounds the group flight queries can handle.
+func (o GroupFlightOptions) Validate() error {
+	if o.Window < time.Minute || o.Window > 6*time.Hour {
+		return fmt.Errorf("group flight window must be between 1m and 6h, got %v", o.Window)
+	}
+	if o.MinPilots < 2 || o.MinPilots > 100 {
+		return fmt.Errorf("group flight minimum size must be between 2 and 100 pilots, got %d", o.MinPilots)
+	}
+	if o.Top < 1 || o.Top > 100 {
+		return fmt.Errorf("group flight top landings must be between 1 and 100, got %d", o.Top)
+	}
+	return nil
+}
+
+// groupFlightOptionsFromRequest overrides the server-wide options with the "window" (minutes),
+// "min_pilots" and "top" query parameters.
+func groupFlightOptionsFromRequest(r *http.Request) (GroupFlightOptions, error) {
+	opts := GroupFlightSettings
+	q := r.URL.Query()
+	for _, p := range []struct {
+		name string
+		set  func(int)
+	}{
+		{"window", func(n int) { opts.Window = time.Duration(n) * time.Minute }},
+		{"min_pilots", func(n int) { opts.MinPilots = n }},
+		{"top", func(n int) { opts.Top = n }},
+	} {
+		if s := q.Get(p.name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return opts, fmt.Errorf("%s must be a number", p.name)
+			}
+			p.set(n)
+		}
+	}
+	return opts, opts.Validate()
+}
+
+// groupCandidate is a flight considered by the group flight detector.
+type groupCandidate struct {
+	FlightID      int
+	PilotID       int
+	DepartureICAO string
+	ArrivalICAO   string
+	Arrival       time.Time
+}
+
+// clusterFlights groups flights flying the same departure/arrival pair whose arrivals
+// follow one another within opts.Window, regardless of who flew them. A cluster never spans
+// more than twice the window, so a steady stream of traffic on a busy route does not chain
+// into one endless group; a stored group can only outgrow that when saveGroupFlight merges
+// groups. Only clusters with at least opts.MinPilots distinct pilots are returned.
+func clusterFlights(flights []groupCandidate, opts GroupFlightOptions) [][]groupCandidate {
+	sorted := make([]groupCandidate, len(flights))
+	copy(sorted, flights)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.DepartureICAO != b.DepartureICAO {
+			return a.DepartureICAO < b.DepartureICAO
+		}
+		if a.ArrivalICAO != b.ArrivalICAO {
+			return a.ArrivalICAO < b.ArrivalICAO
+		}
+		return a.Arrival.Before(b.Arrival)
+	})
+
+	var clusters [][]groupCandidate
+	var current []groupCandidate
+	flush := func() {
+		pilots := make(map[int]bool)
+		for _, f := range current {
+			pilots[f.PilotID] = true
+		}
+		if len(current) > 0 && len(pilots) >= opts.MinPilots {
+			clusters = append(clusters, current)
+		}
+		current = nil
+	}
+
+	for _, f := range sorted {
+		if len(current) > 0 {
+			first, prev := current[0], current[len(current)-1]
+			if f.DepartureICAO != first.DepartureICAO || f.ArrivalICAO != first.ArrivalICAO ||
+				f.Arrival.Sub(prev.Arrival) > opts.Window || f.Arrival.Sub(first.Arrival) > 2*opts.Window {
+				flush()
+			}
+		}
+		current = append(current, f)
+	}
+	flush()
+	return clusters
+}
+
+// groupCandidates loads the flights arriving at or after since, optionally limited to one route.
+func groupCandidates(ctx context.Context, since time.Time, departureICAO, arrivalICAO string) ([]groupCandidate, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT flightid, pilotid, departure_icao, arrival_icao, arrival_time
+		FROM flights
+		WHERE datetime(arrival_time) >= datetime(?)
+			AND departure_icao != '' AND arrival_icao != ''
+			AND (? = '' OR (departure_icao = ? AND arrival_icao = ?))`,
+		sqlTime(since), departureICAO, departureICAO, arrivalICAO)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var flights []groupCandidate
+	for rows.Next() {
+		var f groupCandidate
+		var arrivalTime string
+		if err := rows.Scan(&f.FlightID, &f.PilotID, &f.DepartureICAO, &f.ArrivalICAO, &arrivalTime); err != nil {
+			return nil, err
+		}
+		if f.Arrival, err = parseFlightTime(arrivalTime); err != nil {
+			slog.Warn("Error parsing arrival time", "flight_id", f.FlightID, "err", err)
+			continue
+		}
+		flights = append(flights, f)
+	}
+	return flights, rows.Err()
+}
+
+// DetectGroupFlights clusters every flight arriving since the given time and stores the
+// clusters large enough to be group flights. It returns the number of new group flights.
+func DetectGroupFlights(ctx context.Context, since time.Time) (int, error) {
+	return detectGroupFlights(ctx, since, "", "")
+}
+
+// detectGroupFlightsForFlight re-runs detection on the route of a freshly stored flight,
+// far enough back to cover any group it could have joined.
+func detectGroupFlightsForFlight(ctx context.Context, flight FlightData) error {
+	arrival, err := parseFlightTime(flight.Arrival.DateTime)
+	if err != nil {
+		return err
+	}
+	since := arrival.Add(-4 * GroupFlightSettings.Window)
+	_, err = detectGroupFlights(ctx, since, flight.Departure.Airport.ICAO, flight.Arrival.Airport.ICAO)
+	return err
+}
+
+func detectGroupFlights(ctx context.Context, since time.Time, departureICAO, arrivalICAO string) (int, error) {
+	flights, err := groupCandidates(ctx, since, departureICAO, arrivalICAO)
+	if err != nil {
+		return 0, fmt.Errorf("loading flights: %w", err)
+	}
+
+	created := 0
+	for _, cluster := range clusterFlights(flights, GroupFlightSettings) {
+		id, isNew, err := saveGroupFlight(ctx, cluster)
+		if err != nil {
+			return created, fmt.Errorf("saving group flight: %w", err)
+		}
+		if isNew {
+			created++
+			slog.InfoContext(ctx, "Detected group flight", "group_flight_id", id,
+				"departure", cluster[0].DepartureICAO, "arrival", cluster[0].ArrivalICAO, "flights", len(cluster))
+			detail, err := getGroupFlightDetail(ctx, id, GroupFlightSettings.Window)
+			if err != nil {
+				return created, fmt.Errorf("loading group flight %d: %w", id, err)
+			}
+			publish(NotificationGroupFlightDetected, detail)
+		}
+	}
+	return created, nil
+}
+
+// announceCompletedGroupFlights publishes each group flight once no further arrival could join
+// it, that is a full window after its last arrival.
+func announceCompletedGroupFlights(ctx context.Context, now time.Time) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id FROM group_flights
+		WHERE datetime(last_arrival) <= datetime(?)
+			AND 'group_flight:' || id NOT IN (SELECT key FROM sent_notifications)
+		ORDER BY datetime(first_arrival)`, sqlTime(now.Add(-GroupFlightSettings.Window)))
+	if err != nil {
+		return err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		detail, err := getGroupFlightDetail(ctx, id, GroupFlightSettings.Window)
+		if err != nil {
+			return fmt.Errorf("loading group flight %d: %w", id, err)
+		}
+		first, err := markNotified(ctx, fmt.Sprintf("group_flight:%d", id))
+		if err != nil {
+			return err
+		}
+		if first {
+			publish(NotificationGroupFlightCompleted, detail)
+		}
+	}
+	return nil
+}
+
+// saveGroupFlight stores a cluster as a group flight. A cluster sharing a flight with a
+// group flight already on record extends that group rather than creating a new one. When a
+// late arrival bridges several recorded groups, they are merged into the oldest of them, so a
+// flight is never in two groups; the merged group may then span more than twice the window.
+func saveGroupFlight(ctx context.Context, cluster []groupCandidate) (int64, bool, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback()
+
+	ids := make([]string, len(cluster))
+	for i, f := range cluster {
+		ids[i] = fmt.Sprint(f.FlightID)
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT DISTINCT group_flight_id FROM group_flight_members
+		WHERE flightid IN (`+strings.Join(ids, ",")+`)
+		ORDER BY group_flight_id`)
+	if err != nil {
+		return 0, false, err
+	}
+	var groupIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, false, err
+		}
+		groupIDs = append(groupIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, false, err
+	}
+
+	var groupID int64
+	isNew := false
+	if len(groupIDs) == 0 {
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO group_flights (departure_icao, arrival_icao, first_arrival, last_arrival, total_pilots, detected_at)
+			VALUES (?, ?, ?, ?, 0, ?)`,
+			cluster[0].DepartureICAO, cluster[0].ArrivalICAO,
+			sqlTime(cluster[0].Arrival), sqlTime(cluster[len(cluster)-1].Arrival),
+			time.Now().UTC().Format(time.RFC3339))
+		if err != nil {
+			return 0, false, err
+		}
+		if groupID, err = res.LastInsertId(); err != nil {
+			return 0, false, err
+		}
+		isNew = true
+	} else {
+		groupID = groupIDs[0]
+		for _, merged := range groupIDs[1:] {
+			if err := mergeGroupFlight(ctx, tx, groupID, merged); err != nil {
+				return 0, false, err
+			}
+		}
+	}
+
+	for _, f := range cluster {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT OR IGNORE INTO group_flight_members (group_flight_id, flightid) VALUES (?, ?)`,
+			groupID, f.FlightID); err != nil {
+			return 0, false, err
+		}
+	}
+
+	// Recompute the summary from the full membership, which may include earlier detections.
+	_, err = tx.ExecContext(ctx, `
+		UPDATE group_flights SET
+			first_arrival = (SELECT MIN(datetime(f.arrival_time)) FROM group_flight_members m JOIN flights f ON f.flightid = m.flightid WHERE m.group_flight_id = ?1),
+			last_arrival = (SELECT MAX(datetime(f.arrival_time)) FROM group_flight_members m JOIN flights f ON f.flightid = m.flightid WHERE m.group_flight_id = ?1),
+			total_pilots = (SELECT COUNT(DISTINCT f.pilotid) FROM group_flight_members m JOIN flights f ON f.flightid = m.flightid WHERE m.group_flight_id = ?1),
+			leader_pilotid = (
+				SELECT f.pilotid FROM group_flight_members m
+				JOIN flights f ON f.flightid = m.flightid
+				JOIN group_flight_leaders l ON l.pilotid = f.pilotid
+				WHERE m.group_flight_id = ?1
+				ORDER BY datetime(f.arrival_time)
+				LIMIT 1)
+		WHERE id = ?1`, groupID)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return groupID, isNew, tx.Commit()
+}
+
+// mergeGroupFlight moves the members of group flight from into group flight into and deletes
+// from. If from was already announced, into counts as announced too, so the pilots of the
+// merged group are not announced twice.
+func mergeGroupFlight(ctx context.Context, tx *sql.Tx, into, from int64) error {
+	if _, err := tx.ExecContext(ctx, `
+		INSERT OR IGNORE INTO group_flight_members (group_flight_id, flightid)
+		SELECT ?, flightid FROM group_flight_members WHERE group_flight_id = ?`, into, from); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT OR IGNORE INTO sent_notifications (key, sent_at)
+		SELECT ?, sent_at FROM sent_notifications WHERE key = ?`,
+		fmt.Sprintf("group_flight:%d", into), fmt.Sprintf("group_flight:%d", from)); err != nil {
+		return err
+	}
+	for _, stmt := range []string{
+		`DELETE FROM group_flight_members WHERE group_flight_id = ?`,
+		`DELETE FROM group_flights WHERE id = ?`,
+	} {
+		if _, err := tx.ExecContext(ctx, stmt, from); err != nil {
+			return err
+		}
+	}
+	_, err := tx.ExecContext(ctx, `DELETE FROM sent_notifications WHERE key = ?`, fmt.Sprintf("group_flight:%d", from))
+	return err
+}
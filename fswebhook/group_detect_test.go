@@ -0,0 +1,200 @@
+package fswebhook
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestClusterFlights(t *testing.T) {
+	base := time.Date(2025, 7, 24, 20, 0, 0, 0, time.UTC)
+	flight := func(id, pilot int, dep, arr string, offset time.Duration) groupCandidate {
+		return groupCandidate{FlightID: id, PilotID: pilot, DepartureICAO: dep, ArrivalICAO: arr, Arrival: base.Add(offset)}
+	}
+	opts := GroupFlightOptions{Window: 30 * time.Minute, MinPilots: 3}
+
+	clusters := clusterFlights([]groupCandidate{
+		// Three pilots arriving within minutes of each other.
+		flight(1, 1, "KJFK", "KBOS", 0),
+		flight(2, 2, "KJFK", "KBOS", 10*time.Minute),
+		flight(3, 3, "KJFK", "KBOS", 25*time.Minute),
+		// Same route two hours later: a separate, too small cluster.
+		flight(4, 4, "KJFK", "KBOS", 2*time.Hour),
+		flight(5, 5, "KJFK", "KBOS", 2*time.Hour+5*time.Minute),
+		// Same arrival airport from elsewhere does not count.
+		flight(6, 6, "KLGA", "KBOS", 5*time.Minute),
+		// One pilot flying the route three times is not a group.
+		flight(7, 7, "KBOS", "KPHL", 0),
+		flight(8, 7, "KBOS", "KPHL", 5*time.Minute),
+		flight(9, 7, "KBOS", "KPHL", 10*time.Minute),
+	}, opts)
+
+	if len(clusters) != 1 {
+		t.Fatalf("expected 1 cluster, got %d: %+v", len(clusters), clusters)
+	}
+	if len(clusters[0]) != 3 || clusters[0][0].FlightID != 1 || clusters[0][2].FlightID != 3 {
+		t.Errorf("expected flights 1-3 in the cluster, got %+v", clusters[0])
+	}
+
+	// A steady stream of arrivals 20 minutes apart is capped at twice the window.
+	var stream []groupCandidate
+	for i := 0; i < 9; i++ {
+		stream = append(stream, flight(100+i, 100+i, "EGLL", "LFPG", time.Duration(i)*20*time.Minute))
+	}
+	for _, c := range clusterFlights(stream, opts) {
+		if span := c[len(c)-1].Arrival.Sub(c[0].Arrival); span > 2*opts.Window {
+			t.Errorf("cluster spans %v, more than twice the window", span)
+		}
+	}
+}
+
+func TestDetectGroupFlights(t *testing.T) {
+	setupTestDB(t)
+	for _, table := range []string{"group_flights", "group_flight_members", "group_flight_leaders"} {
+		if _, err := db.Exec(`DELETE FROM ` + table); err != nil {
+			t.Fatalf("Failed to clear %s table: %v", table, err)
+		}
+	}
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM group_flights`)
+		db.Exec(`DELETE FROM group_flight_members`)
+		db.Exec(`DELETE FROM group_flight_leaders`)
+	})
+
+	now := time.Now().UTC().Truncate(time.Second)
+	// Nobody configured as a leader flew this one.
+	insertTestGroupFlight(t, 100, 1, 10, 4, "KJFK", "KBOS", now.Add(-2*time.Hour))
+
+	created, err := DetectGroupFlights(context.Background(), now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("DetectGroupFlights returned error: %v", err)
+	}
+	if created != 1 {
+		t.Fatalf("expected 1 new group flight, got %d", created)
+	}
+
+	// A straggler arriving later joins the existing group instead of creating a new one.
+	insertTestFlights(t, testFlight{FlightID: 150, PilotID: 50, PilotName: "Straggler", LandingRate: -20,
+		Duration: time.Hour, DepartureICAO: "KJFK", ArrivalICAO: "KBOS", Arrival: now.Add(-2*time.Hour + 20*time.Minute)})
+	if err := AddGroupFlightLeaders(context.Background(), []int{1}); err != nil {
+		t.Fatal(err)
+	}
+	created, err = DetectGroupFlights(context.Background(), now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("DetectGroupFlights returned error: %v", err)
+	}
+	if created != 0 {
+		t.Errorf("expected no new group flights on a second run, got %d", created)
+	}
+
+	groups, err := getDetectedGroupFlights(context.Background(), groupFlightCursor{Before: now.Add(time.Minute)}, defaultGroupFlightPage, GroupFlightSettings)
+	if err != nil {
+		t.Fatalf("getDetectedGroupFlights returned error: %v", err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("expected 1 group flight, got %d", len(groups))
+	}
+	g := groups[0]
+	if g.TotalPilots != 6 {
+		t.Errorf("expected 6 pilots, got %d", g.TotalPilots)
+	}
+	if g.LeaderID != 1 || g.LeaderName != "Leader" {
+		t.Errorf("expected pilot 1 to be recognised as the leader, got %d (%s)", g.LeaderID, g.LeaderName)
+	}
+	if len(g.TopLandingRates) != 6 || g.TopLandingRates[0].PilotName != "Straggler" {
+		t.Errorf("expected the straggler's -20 fpm to rank first among 6 listed, got %+v", g.TopLandingRates)
+	}
+
+	// Arrivals in SQLite's own format are understood too.
+	flight := FlightData{ID: 150, Arrival: Arrival{Airport: Airport{ICAO: "KBOS"}, DateTime: now.Add(-time.Hour).Format(time.DateTime)},
+		Departure: Departure{Airport: Airport{ICAO: "KJFK"}}}
+	if err := detectGroupFlightsForFlight(context.Background(), flight); err != nil {
+		t.Errorf("detectGroupFlightsForFlight returned error: %v", err)
+	}
+}
+
+func TestDetectGroupFlightsMergesBridgedGroups(t *testing.T) {
+	setupTestDB(t)
+	for _, table := range []string{"group_flights", "group_flight_members", "group_flight_leaders", "sent_notifications"} {
+		if _, err := db.Exec(`DELETE FROM ` + table); err != nil {
+			t.Fatalf("Failed to clear %s table: %v", table, err)
+		}
+	}
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM group_flights`)
+		db.Exec(`DELETE FROM group_flight_members`)
+		db.Exec(`DELETE FROM sent_notifications`)
+	})
+
+	now := time.Now().UTC().Truncate(time.Second)
+	// Two groups 36 minutes apart, further than the 30 minute window.
+	start := now.Add(-3 * time.Hour)
+	insertTestGroupFlight(t, 100, 1, 10, 4, "KJFK", "KBOS", start)
+	insertTestGroupFlight(t, 200, 2, 20, 4, "KJFK", "KBOS", start.Add(40*time.Minute))
+	created, err := DetectGroupFlights(context.Background(), now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("DetectGroupFlights returned error: %v", err)
+	}
+	if created != 2 {
+		t.Fatalf("expected 2 new group flights, got %d", created)
+	}
+	var kept, merged int64
+	if err := db.QueryRow(`SELECT MIN(id), MAX(id) FROM group_flights`).Scan(&kept, &merged); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := markNotified(context.Background(), fmt.Sprintf("group_flight:%d", merged)); err != nil {
+		t.Fatal(err)
+	}
+
+	// A late arrival between them chains both into one cluster.
+	insertTestFlights(t, testFlight{FlightID: 150, PilotID: 50, PilotName: "Bridge", LandingRate: -90,
+		Duration: time.Hour, DepartureICAO: "KJFK", ArrivalICAO: "KBOS", Arrival: start.Add(20 * time.Minute)})
+	if created, err = DetectGroupFlights(context.Background(), now.Add(-24*time.Hour)); err != nil {
+		t.Fatalf("DetectGroupFlights returned error: %v", err)
+	}
+	if created != 0 {
+		t.Errorf("expected the bridged groups to merge rather than create one, got %d new", created)
+	}
+
+	var groups, memberships, flights int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM group_flights`).Scan(&groups); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*), COUNT(DISTINCT flightid) FROM group_flight_members WHERE group_flight_id = ?`, kept).Scan(&memberships, &flights); err != nil {
+		t.Fatal(err)
+	}
+	if groups != 1 || memberships != 11 || flights != 11 {
+		t.Errorf("expected one group holding all 11 flights, got %d groups and %d members of group %d", groups, memberships, kept)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM group_flight_members WHERE group_flight_id != ?`, kept).Scan(&memberships); err != nil || memberships != 0 {
+		t.Errorf("expected no flight left in another group, got %d (%v)", memberships, err)
+	}
+
+	var total int
+	var first, last string
+	if err := db.QueryRow(`SELECT total_pilots, first_arrival, last_arrival FROM group_flights WHERE id = ?`, kept).Scan(&total, &first, &last); err != nil {
+		t.Fatal(err)
+	}
+	if total != 11 || first != sqlTime(start) || last != sqlTime(start.Add(44*time.Minute)) {
+		t.Errorf("expected the summary to cover both groups, got %d pilots from %s to %s", total, first, last)
+	}
+
+	// The merged group was announced already, so the kept one is not announced again.
+	var keys []string
+	rows, err := db.Query(`SELECT key FROM sent_notifications ORDER BY key`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+	if want := fmt.Sprintf("group_flight:%d", kept); len(keys) != 1 || keys[0] != want {
+		t.Errorf("expected the announcement carried over to %s, got %v", want, keys)
+	}
+}
@@ -2,14 +2,15 @@ package fswebhook
 
 import (
 	"encoding/json"
-	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"time"
 )
 
 // PilotFlightDetails struct to hold pilot's landing rate
 type PilotFlightDetails struct {
+	PilotID      int     `json:"pilot_id"`
 	PilotName    string  `json:"pilot_name"`
 	LandingRate  float64 `json:"landing_rate"`
 	AircraftName string  `json:"aircraft_name"`
@@ -18,12 +19,17 @@ type PilotFlightDetails struct {
 
 // GroupFlight struct to hold data for a group flight event
 type GroupFlight struct {
+	ID              int64                `json:"id,omitempty"` // set for detected group flights
 	DepartureICAO   string               `json:"departure_icao"`
 	ArrivalICAO     string               `json:"arrival_icao"`
 	FlightCount     int                  `json:"flight_count"`
 	StartTime       time.Time            `json:"start_time"`
+	FirstArrival    *time.Time           `json:"first_arrival,omitempty"` // set for detected group flights
+	LeaderID        int                  `json:"leader_id"`
+	LeaderName      string               `json:"leader_name"`
 	TotalPilots     int                  `json:"total_pilots"`
 	TopLandingRates []PilotFlightDetails `json:"top_landing_rates"`
+	Formation       *FormationStats      `json:"formation,omitempty"` // set for detected group flights
 }
 
 // Intermediate struct to scan results from the DB
@@ -33,18 +39,45 @@ type groupFlightScanResult struct {
 	ArrivalTime   string
 	LandingRate   float64
 	AircraftName  string
+	PilotID       int
 	PilotName     string
+	LeaderID      int
+	LeaderName    string
 	FlightID      string
 	FlightNumber  int
 	Rank          int
 	TotalPilots   int
 }
 
-const flightLeaderDefault = "KipOnTheGround"
-
+// GroupFlightHandler finds the group flights led by a group flight leader in the last 24 hours.
+// The optional "leader" parameter (a registered leader's pilot ID) limits the search to flights
+// led by that pilot; "window", "min_pilots" and "top" override the server's group flight options.
 func GroupFlightHandler(w http.ResponseWriter, r *http.Request) {
+	opts, err := groupFlightOptionsFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	pilotName := flightLeaderDefault // Default leader
+	leaderID := 0 // Any configured leader
+	if s := r.URL.Query().Get("leader"); s != "" {
+		id, err := strconv.Atoi(s)
+		if err != nil || id <= 0 {
+			http.Error(w, "leader must be a pilot ID", http.StatusBadRequest)
+			return
+		}
+		ok, err := isGroupFlightLeader(r.Context(), id)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error checking group flight leader", "pilot_id", id, "err", err)
+			http.Error(w, "Error querying for group flights", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "leader is not a group flight leader", http.StatusBadRequest)
+			return
+		}
+		leaderID = id
+	}
 	sinceTime := time.Now().UTC().Add(-24 * time.Hour)
 
 	query := `
@@ -53,7 +86,10 @@ func GroupFlightHandler(w http.ResponseWriter, r *http.Request) {
 			f2.arrival_time,
 			f2.landing_rate, 
 			f2.aircraft_name,
+			f2.pilotid,
 			f2.pilotname,
+			f2.leader_id,
+			f2.leader_name,
 			f2.flightid,
 			f2.flight_number,
 			f2.rank,
@@ -63,7 +99,10 @@ func GroupFlightHandler(w http.ResponseWriter, r *http.Request) {
 			f.arrival_time,
 			f.landing_rate, 
 			f.aircraft_name,
+			f.pilotid,
 			f.pilotname,
+			lf.pilotid AS leader_id,
+			lf.pilotname AS leader_name,
 			lf.flightid,
 			lf.flight_number,
 			row_number() OVER (PARTITION BY lf.flightid ORDER BY f.landing_rate desc) AS rank,
@@ -75,24 +114,27 @@ func GroupFlightHandler(w http.ResponseWriter, r *http.Request) {
 					arrival_time,
 					landing_rate, 
 					aircraft_name,
+					pilotid,
+					pilotname,
 					flightid,
 					row_number() OVER () AS flight_number
 			FROM flights
-			WHERE pilotname = ? 
+			WHERE (? = 0 AND pilotid IN (SELECT pilotid FROM group_flight_leaders) OR pilotid = ?)
 				AND arrival_time >= ?
 			ORDER BY arrival_time DESC) AS lf 
 		ON f.departure_icao = lf.departure_icao
 		AND f.arrival_icao = lf.arrival_icao
-		AND datetime(f.arrival_time) >= datetime(lf.arrival_time, '-30 minutes')
-		AND datetime(f.arrival_time) <= datetime(lf.arrival_time, '+30 minutes')
+		AND abs(julianday(f.arrival_time) - julianday(lf.arrival_time)) * 86400 <= ?
 	) as f2
-	where (f2.rank <= 5 OR f2.pilotname = ?)
-	and f2.total_pilots > 4
+	where (f2.rank <= ? OR f2.pilotid = f2.leader_id)
+	and f2.total_pilots >= ?
 	ORDER BY f2.flight_number desc, f2.rank asc;`
 
-	rows, err := db.Query(query, pilotName, sinceTime.Format(time.RFC3339), pilotName)
+	queryDone := timeQuery(r.Context(), "group_flight")
+	rows, err := db.QueryContext(r.Context(), query, leaderID, leaderID, sinceTime.Format(time.RFC3339),
+		opts.Window.Seconds(), opts.Top, opts.MinPilots)
 	if err != nil {
-		log.Printf("Error querying for group flights: %v", err)
+		slog.ErrorContext(r.Context(), "Error querying for group flights", "err", err)
 		http.Error(w, "Error querying for group flights", http.StatusInternalServerError)
 		return
 	}
@@ -100,7 +142,7 @@ func GroupFlightHandler(w http.ResponseWriter, r *http.Request) {
 
 	flightNumber := -1
 
-	var allGroupFlights []GroupFlight
+	allGroupFlights := []GroupFlight{}
 	var currentGroupFlight GroupFlight
 
 	for rows.Next() {
@@ -111,13 +153,16 @@ func GroupFlightHandler(w http.ResponseWriter, r *http.Request) {
 			&res.ArrivalTime,
 			&res.LandingRate,
 			&res.AircraftName,
+			&res.PilotID,
 			&res.PilotName,
+			&res.LeaderID,
+			&res.LeaderName,
 			&res.FlightID,
 			&res.FlightNumber,
 			&res.Rank,
 			&res.TotalPilots,
 		); err != nil {
-			log.Printf("Error scanning group flight row: %v", err)
+			slog.ErrorContext(r.Context(), "Error scanning group flight row", "err", err)
 			continue
 		}
 
@@ -131,17 +176,19 @@ func GroupFlightHandler(w http.ResponseWriter, r *http.Request) {
 			currentGroupFlight = GroupFlight{
 				DepartureICAO:   res.DepartureICAO,
 				ArrivalICAO:     res.ArrivalICAO,
+				LeaderID:        res.LeaderID,
+				LeaderName:      res.LeaderName,
 				TotalPilots:     res.TotalPilots,
 				TopLandingRates: []PilotFlightDetails{},
 			}
 
 		}
 
-		if res.PilotName == flightLeaderDefault {
+		if res.PilotID == res.LeaderID {
 			// If the pilot is the flight leader, set the start time to the parsed time
 			parsedTime, err := time.Parse(time.RFC3339, res.ArrivalTime)
 			if err != nil {
-				log.Printf("Error parsing arrival time for group flight: %v", err)
+				slog.WarnContext(r.Context(), "Error parsing arrival time", "flight_id", res.FlightID, "err", err)
 				continue
 			}
 			currentGroupFlight.StartTime = parsedTime
@@ -149,6 +196,7 @@ func GroupFlightHandler(w http.ResponseWriter, r *http.Request) {
 
 		// Add to top landing rates if they are in the top 5
 		pfd := PilotFlightDetails{
+			PilotID:      res.PilotID,
 			PilotName:    res.PilotName,
 			LandingRate:  res.LandingRate,
 			AircraftName: res.AircraftName,
@@ -156,16 +204,12 @@ func GroupFlightHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		currentGroupFlight.TopLandingRates = append(currentGroupFlight.TopLandingRates, pfd)
 	}
+	queryDone()
 
 	if len(currentGroupFlight.TopLandingRates) > 0 {
 		allGroupFlights = append(allGroupFlights, currentGroupFlight)
 	}
 
-	fmt.Println(allGroupFlights)
-	if len(allGroupFlights) > 0 {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(allGroupFlights)
-	} else {
-		w.WriteHeader(http.StatusNotFound)
-	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(allGroupFlights)
 }
@@ -0,0 +1,248 @@
+package fswebhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// insertTestGroupFlight stores a leader's flight and followers arriving a minute apart
+// after it, all on the same route. Followers get pilot IDs firstPilot, firstPilot+1, ...
+func insertTestGroupFlight(t *testing.T, firstFlight, leaderID, firstPilot, followers int, dep, arr string, leaderArrival time.Time) {
+	t.Helper()
+	flights := []testFlight{{FlightID: firstFlight, PilotID: leaderID, PilotName: "Leader", LandingRate: -150,
+		Duration: time.Hour, AircraftName: "A320", DepartureICAO: dep, ArrivalICAO: arr, Arrival: leaderArrival}}
+	for i := 0; i < followers; i++ {
+		flights = append(flights, testFlight{FlightID: firstFlight + 1 + i, PilotID: firstPilot + i,
+			PilotName: "Follower" + string(rune('A'+i)), LandingRate: float64(-100 - 10*i), Duration: time.Hour,
+			AircraftName: "B738", DepartureICAO: dep, ArrivalICAO: arr,
+			Arrival: leaderArrival.Add(time.Duration(i+1) * time.Minute)})
+	}
+	insertTestFlights(t, flights...)
+}
+
+func TestGroupFlightHandlerLeaders(t *testing.T) {
+	setupTestDB(t)
+	if _, err := db.Exec(`DELETE FROM group_flight_leaders`); err != nil {
+		t.Fatalf("Failed to clear group_flight_leaders table: %v", err)
+	}
+	t.Cleanup(func() { db.Exec(`DELETE FROM group_flight_leaders`) })
+
+	now := time.Now().UTC().Truncate(time.Second)
+	insertTestGroupFlight(t, 100, 1, 10, 5, "KJFK", "KBOS", now.Add(-3*time.Hour))
+	insertTestGroupFlight(t, 200, 2, 20, 5, "KBOS", "KPHL", now.Add(-time.Hour))
+
+	if err := AddGroupFlightLeaders(context.Background(), []int{1, 2}); err != nil {
+		t.Fatalf("AddGroupFlightLeaders returned error: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	GroupFlightHandler(rr, httptest.NewRequest(http.MethodGet, "/group-flight", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var groups []GroupFlight
+	if err := json.NewDecoder(rr.Body).Decode(&groups); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 group flights, got %d", len(groups))
+	}
+	for _, g := range groups {
+		if g.TotalPilots != 6 {
+			t.Errorf("expected 6 pilots in %s-%s, got %d", g.DepartureICAO, g.ArrivalICAO, g.TotalPilots)
+		}
+		if g.StartTime.IsZero() {
+			t.Errorf("expected start time to be set for the group led by %d", g.LeaderID)
+		}
+		// The top 5 plus the leader, who has the worst landing and ranks 6th.
+		if len(g.TopLandingRates) != 6 {
+			t.Errorf("expected 6 listed pilots, got %d", len(g.TopLandingRates))
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	GroupFlightHandler(rr, httptest.NewRequest(http.MethodGet, "/group-flight?leader=2", nil))
+	groups = nil
+	if err := json.NewDecoder(rr.Body).Decode(&groups); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(groups) != 1 || groups[0].LeaderID != 2 || groups[0].ArrivalICAO != "KPHL" {
+		t.Errorf("expected only the group led by pilot 2, got %+v", groups)
+	}
+	if !groups[0].StartTime.Equal(now.Add(-time.Hour)) {
+		t.Errorf("expected start time %v, got %v", now.Add(-time.Hour), groups[0].StartTime)
+	}
+
+	// Only registered leaders can be asked for.
+	for _, leader := range []string{"abc", "10"} {
+		rr = httptest.NewRecorder()
+		GroupFlightHandler(rr, httptest.NewRequest(http.MethodGet, "/group-flight?leader="+leader, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for leader %q, got %v", leader, rr.Code)
+		}
+	}
+}
+
+func TestSeedGroupFlightLeaders(t *testing.T) {
+	setupTestDB(t)
+	clearSentNotifications(t)
+	if _, err := db.Exec(`DELETE FROM group_flight_leaders`); err != nil {
+		t.Fatalf("Failed to clear group_flight_leaders table: %v", err)
+	}
+	t.Cleanup(func() { db.Exec(`DELETE FROM group_flight_leaders`) })
+
+	if seeded, err := SeedGroupFlightLeaders(context.Background(), []int{1, 2}); err != nil || !seeded {
+		t.Fatalf("expected the empty list to be seeded, got %v, %v", seeded, err)
+	}
+	// A leader removed through the admin API is not brought back on the next start.
+	if _, err := db.Exec(`DELETE FROM group_flight_leaders WHERE pilotid = 2`); err != nil {
+		t.Fatal(err)
+	}
+	if seeded, err := SeedGroupFlightLeaders(context.Background(), []int{1, 2}); err != nil || seeded {
+		t.Fatalf("expected an existing list to be left alone, got %v, %v", seeded, err)
+	}
+	leaders, err := getGroupFlightLeaders(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaders) != 1 || leaders[0].PilotID != 1 {
+		t.Errorf("expected only pilot 1 to lead, got %+v", leaders)
+	}
+
+	// Nor are they once every leader is removed.
+	if _, err := db.Exec(`DELETE FROM group_flight_leaders`); err != nil {
+		t.Fatal(err)
+	}
+	if seeded, err := SeedGroupFlightLeaders(context.Background(), []int{1, 2}); err != nil || seeded {
+		t.Fatalf("expected an emptied list to stay empty, got %v, %v", seeded, err)
+	}
+}
+
+func TestMigrateKipOnTheGroundAsLeader(t *testing.T) {
+	setupTestDB(t)
+	clearSentNotifications(t)
+	if _, err := db.Exec(`DELETE FROM group_flight_leaders`); err != nil {
+		t.Fatalf("Failed to clear group_flight_leaders table: %v", err)
+	}
+	t.Cleanup(func() { db.Exec(`DELETE FROM group_flight_leaders`) })
+	insertTestFlights(t,
+		testFlight{FlightID: 1, PilotID: 7, PilotName: "KipOnTheGround", Duration: time.Hour, Arrival: time.Now().UTC()},
+		testFlight{FlightID: 2, PilotID: 7, PilotName: "KipOnTheGround", Duration: time.Hour, Arrival: time.Now().UTC()},
+		testFlight{FlightID: 3, PilotID: 8, PilotName: "Someone", Duration: time.Hour, Arrival: time.Now().UTC()},
+	)
+
+	// Migration 11, as run on a database that had no leaders yet.
+	if _, err := db.Exec(migrations[10]); err != nil {
+		t.Fatalf("Failed to apply migration: %v", err)
+	}
+	leaders, err := getGroupFlightLeaders(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaders) != 1 || leaders[0].PilotID != 7 {
+		t.Errorf("expected KipOnTheGround to lead, got %+v", leaders)
+	}
+	// The configured leaders are still registered on the first start.
+	if seeded, err := SeedGroupFlightLeaders(context.Background(), []int{1}); err != nil || !seeded {
+		t.Errorf("expected the configured leaders seeded, got %v, %v", seeded, err)
+	}
+}
+
+func TestGroupFlightHandlerOptions(t *testing.T) {
+	setupTestDB(t)
+	if _, err := db.Exec(`DELETE FROM group_flight_leaders`); err != nil {
+		t.Fatalf("Failed to clear group_flight_leaders table: %v", err)
+	}
+	t.Cleanup(func() { db.Exec(`DELETE FROM group_flight_leaders`) })
+	if err := AddGroupFlightLeaders(context.Background(), []int{1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A small weekday event: the leader, two followers, and a straggler 45 minutes behind.
+	now := time.Now().UTC().Truncate(time.Second)
+	insertTestGroupFlight(t, 100, 1, 10, 2, "KJFK", "KBOS", now.Add(-3*time.Hour))
+	insertTestFlights(t, testFlight{FlightID: 150, PilotID: 50, PilotName: "Straggler", LandingRate: -50,
+		Duration: time.Hour, DepartureICAO: "KJFK", ArrivalICAO: "KBOS", Arrival: now.Add(-3*time.Hour + 45*time.Minute)})
+
+	get := func(query string) []GroupFlight {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		GroupFlightHandler(rr, httptest.NewRequest(http.MethodGet, "/group-flight?"+query, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", query, rr.Code, rr.Body.String())
+		}
+		var groups []GroupFlight
+		if err := json.NewDecoder(rr.Body).Decode(&groups); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return groups
+	}
+
+	if groups := get(""); len(groups) != 0 {
+		t.Errorf("expected three pilots to fall short of the default minimum, got %+v", groups)
+	}
+	groups := get("min_pilots=3")
+	if len(groups) != 1 || groups[0].TotalPilots != 3 {
+		t.Fatalf("expected a group of 3 with min_pilots=3, got %+v", groups)
+	}
+	groups = get("min_pilots=3&window=60")
+	if len(groups) != 1 || groups[0].TotalPilots != 4 {
+		t.Fatalf("expected the straggler to join with a 60 minute window, got %+v", groups)
+	}
+	// The straggler's -50 fpm ranks first; the leader is always listed.
+	groups = get("min_pilots=3&window=60&top=1")
+	if len(groups) != 1 || len(groups[0].TopLandingRates) != 2 || groups[0].TopLandingRates[0].PilotID != 50 {
+		t.Errorf("expected the best landing and the leader's with top=1, got %+v", groups)
+	}
+
+	for _, query := range []string{"window=0", "window=abc", "min_pilots=1", "top=0", "top=101"} {
+		rr := httptest.NewRecorder()
+		GroupFlightHandler(rr, httptest.NewRequest(http.MethodGet, "/group-flight?"+query, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, rr.Code)
+		}
+	}
+}
+
+func TestGroupLeadersAdminHandler(t *testing.T) {
+	setupTestDB(t)
+	db.Exec(`DELETE FROM group_flight_leaders`)
+	t.Cleanup(func() { db.Exec(`DELETE FROM group_flight_leaders`) })
+	t.Setenv("ADMIN_TOKEN", "admin-secret")
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/group-leaders", strings.NewReader(`{"pilotid": 42}`))
+	rr := httptest.NewRecorder()
+	GroupLeadersAdminHandler(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a token, got %v", rr.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/admin/group-leaders", strings.NewReader(`{"pilotid": 42}`))
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	rr = httptest.NewRecorder()
+	GroupLeadersAdminHandler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var leaders []GroupFlightLeader
+	if err := json.NewDecoder(rr.Body).Decode(&leaders); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(leaders) != 1 || leaders[0].PilotID != 42 {
+		t.Errorf("expected pilot 42 to be the only leader, got %+v", leaders)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/admin/group-leaders/42", nil)
+	req.SetPathValue("id", "42")
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	rr = httptest.NewRecorder()
+	GroupLeaderAdminHandler(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("expected 204 removing a leader, got %v", rr.Code)
+	}
+}
@@ -0,0 +1,310 @@
+package fswebhook
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// defaultGroupFlightPage is the number of group flights returned per page of history.
+const defaultGroupFlightPage = 20
+
+// GroupFlightPilot struct to hold one member flight of a group flight
+type GroupFlightPilot struct {
+	FlightID      int       `json:"flightid"`
+	PilotID       int       `json:"pilot_id"`
+	PilotName     string    `json:"pilot_name"`
+	LandingRate   float64   `json:"landing_rate"`
+	AircraftName  string    `json:"aircraft_name"`
+	DepartureTime time.Time `json:"departure_time"`
+	ArrivalTime   time.Time `json:"arrival_time"`
+	Rank          int       `json:"rank"` // Rank based on landing rate
+	IsLeader      bool      `json:"is_leader"`
+
+	DepartureDelaySeconds int     `json:"departure_delay_seconds"` // behind the leader, or the group's median without one
+	ArrivalDelaySeconds   int     `json:"arrival_delay_seconds"`
+	StuckScore            float64 `json:"stuck_score"`
+}
+
+// GroupFlightDetail struct to hold a group flight's full roster and summary
+type GroupFlightDetail struct {
+	GroupFlight
+	AverageLandingRate float64            `json:"average_landing_rate"`
+	Pilots             []GroupFlightPilot `json:"pilots"`
+}
+
+const groupFlightColumns = `id, departure_icao, arrival_icao, first_arrival, total_pilots, leader_pilotid`
+
+func scanGroupFlight(row interface{ Scan(...any) error }) (GroupFlight, error) {
+	var g GroupFlight
+	var firstArrival string
+	var leaderID sql.NullInt64
+	if err := row.Scan(&g.ID, &g.DepartureICAO, &g.ArrivalICAO, &firstArrival, &g.TotalPilots, &leaderID); err != nil {
+		return g, err
+	}
+	var err error
+	if g.StartTime, err = parseFlightTime(firstArrival); err != nil {
+		slog.Warn("Error parsing first arrival", "group_flight_id", g.ID, "err", err)
+	}
+	first := g.StartTime
+	g.FirstArrival = &first
+	g.LeaderID = int(leaderID.Int64)
+	return g, nil
+}
+
+// groupFlightCursor struct to hold where a page of group flights starts: the groups that
+// started before Before, and those that started in the same second with an ID below BeforeID.
+type groupFlightCursor struct {
+	Before   time.Time
+	BeforeID int64 // 0 to skip every group starting in Before's second
+}
+
+// GroupFlightPage struct to hold a page of group flights and the cursor of the next page
+type GroupFlightPage struct {
+	GroupFlights []GroupFlight `json:"group_flights"`
+	NextBefore   *time.Time    `json:"next_before,omitempty"` // unset on the last page
+	NextID       int64         `json:"next_id,omitempty"`
+}
+
+// getDetectedGroupFlights loads up to limit stored group flights of at least opts.MinPilots
+// pilots that started before the cursor, most recent first, each with the top opts.Top
+// landings plus the leader's and its formation stats.
+func getDetectedGroupFlights(ctx context.Context, cursor groupFlightCursor, limit int, opts GroupFlightOptions) ([]GroupFlight, error) {
+	defer timeQuery(ctx, "group_flights")()
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+groupFlightColumns+`
+		FROM group_flights
+		WHERE (datetime(first_arrival) < datetime(?1) OR (datetime(first_arrival) = datetime(?1) AND id < ?2))
+			AND total_pilots >= ?3
+		ORDER BY datetime(first_arrival) DESC, id DESC
+		LIMIT ?4`, sqlTime(cursor.Before), cursor.BeforeID, opts.MinPilots, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []GroupFlight{}
+	for rows.Next() {
+		g, err := scanGroupFlight(rows)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range groups {
+		pilots, err := getGroupFlightPilots(ctx, &groups[i])
+		if err != nil {
+			return nil, err
+		}
+		stats := scoreFormation(pilots, opts.Window)
+		groups[i].Formation = &stats
+		groups[i].TopLandingRates = []PilotFlightDetails{}
+		for _, p := range pilots {
+			if p.Rank <= opts.Top || p.IsLeader {
+				groups[i].TopLandingRates = append(groups[i].TopLandingRates, PilotFlightDetails{
+					PilotID:      p.PilotID,
+					PilotName:    p.PilotName,
+					LandingRate:  p.LandingRate,
+					AircraftName: p.AircraftName,
+					Rank:         p.Rank,
+				})
+			}
+		}
+	}
+	return groups, nil
+}
+
+// getGroupFlightPilots loads every member flight of a stored group flight, best landing first.
+// The leader's name and arrival are copied onto the group, the arrival becoming its start time.
+func getGroupFlightPilots(ctx context.Context, g *GroupFlight) ([]GroupFlightPilot, error) {
+	byGroup, err := queryGroupFlightPilots(ctx, `g.id = ?`, g.ID)
+	if err != nil {
+		return nil, err
+	}
+	pilots := byGroup[g.ID]
+	if pilots == nil {
+		pilots = []GroupFlightPilot{}
+	}
+	markGroupFlightLeader(g, pilots)
+	return pilots, nil
+}
+
+// queryGroupFlightPilots loads the member flights of the group flights g matching condition in
+// one query, by group flight ID and best landing first.
+func queryGroupFlightPilots(ctx context.Context, condition string, args ...any) (map[int64][]GroupFlightPilot, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT m.group_flight_id,
+			f.flightid,
+			f.pilotid,
+			f.pilotname,
+			f.landing_rate,
+			f.aircraft_name,
+			f.departure_time,
+			f.arrival_time,
+			row_number() OVER (PARTITION BY m.group_flight_id ORDER BY f.landing_rate DESC) AS rank
+		FROM group_flights AS g
+		JOIN group_flight_members AS m ON m.group_flight_id = g.id
+		JOIN flights AS f ON f.flightid = m.flightid
+		WHERE `+condition+`
+		ORDER BY m.group_flight_id, rank`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pilots := make(map[int64][]GroupFlightPilot)
+	for rows.Next() {
+		var groupID int64
+		var p GroupFlightPilot
+		var departure, arrival string
+		if err := rows.Scan(&groupID, &p.FlightID, &p.PilotID, &p.PilotName, &p.LandingRate, &p.AircraftName,
+			&departure, &arrival, &p.Rank); err != nil {
+			return nil, err
+		}
+		if p.DepartureTime, err = parseFlightTime(departure); err != nil {
+			slog.Warn("Error parsing departure time", "flight_id", p.FlightID, "err", err)
+		}
+		if p.ArrivalTime, err = parseFlightTime(arrival); err != nil {
+			slog.Warn("Error parsing arrival time", "flight_id", p.FlightID, "err", err)
+		}
+		pilots[groupID] = append(pilots[groupID], p)
+	}
+	return pilots, rows.Err()
+}
+
+// markGroupFlightLeader flags the leader's flight among the group's pilots and copies the
+// leader's name and arrival onto the group.
+func markGroupFlightLeader(g *GroupFlight, pilots []GroupFlightPilot) {
+	if g.LeaderID == 0 {
+		return
+	}
+	for i := range pilots {
+		if pilots[i].PilotID == g.LeaderID {
+			pilots[i].IsLeader = true
+			g.LeaderName = pilots[i].PilotName
+			g.StartTime = pilots[i].ArrivalTime
+		}
+	}
+}
+
+// getGroupFlightDetail loads a stored group flight with its full roster, scoring its formation
+// against window. It returns sql.ErrNoRows for unknown group flights.
+func getGroupFlightDetail(ctx context.Context, id int64, window time.Duration) (GroupFlightDetail, error) {
+	g, err := scanGroupFlight(db.QueryRowContext(ctx, `SELECT `+groupFlightColumns+` FROM group_flights WHERE id = ?`, id))
+	if err != nil {
+		return GroupFlightDetail{}, err
+	}
+	pilots, err := getGroupFlightPilots(ctx, &g)
+	if err != nil {
+		return GroupFlightDetail{}, err
+	}
+
+	stats := scoreFormation(pilots, window)
+	g.Formation = &stats
+	detail := GroupFlightDetail{GroupFlight: g, Pilots: pilots}
+	for _, p := range pilots {
+		detail.AverageLandingRate += p.LandingRate / float64(len(pilots))
+	}
+	return detail, nil
+}
+
+// GroupFlightsHandler pages through the detected group flights, whether or not a group flight
+// leader flew them. "before" (RFC 3339 or YYYY-MM-DD) returns the groups that started before
+// that time. Each page but the last carries next_before and next_id; pass them back as "before"
+// and "before_id" to fetch the next one. "min_pilots" and "top" override the server's group
+// flight options, "window" the one formation is scored against. Detection itself always uses
+// the server's options.
+func GroupFlightsHandler(w http.ResponseWriter, r *http.Request) {
+	opts, err := groupFlightOptionsFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	before := time.Now().UTC().Add(time.Minute)
+	if s := r.URL.Query().Get("before"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			if t, err = time.Parse(time.DateOnly, s); err != nil {
+				http.Error(w, "before must be an RFC 3339 timestamp or a date", http.StatusBadRequest)
+				return
+			}
+		}
+		before = t
+	}
+	cursor := groupFlightCursor{Before: before}
+	if s := r.URL.Query().Get("before_id"); s != "" {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || id < 1 {
+			http.Error(w, "before_id must be a group flight ID", http.StatusBadRequest)
+			return
+		}
+		cursor.BeforeID = id
+	}
+
+	limit := defaultGroupFlightPage
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 100 {
+			http.Error(w, "limit must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	groups, err := getDetectedGroupFlights(r.Context(), cursor, limit, opts)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error querying detected group flights", "err", err)
+		http.Error(w, "Error querying for group flights", http.StatusInternalServerError)
+		return
+	}
+
+	page := GroupFlightPage{GroupFlights: groups}
+	if len(groups) == limit {
+		last := groups[len(groups)-1]
+		page.NextBefore = last.FirstArrival
+		page.NextID = last.ID
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// GroupFlightDetailHandler returns the full roster of the group flight in the {id} path
+// segment, with each pilot's landing, aircraft, times and formation score, and the group's
+// spreads and average landing.
+func GroupFlightDetailHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid group flight ID", http.StatusBadRequest)
+		return
+	}
+
+	opts, err := groupFlightOptionsFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	detail, err := getGroupFlightDetail(r.Context(), id, opts.Window)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Group flight not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error querying group flight", "group_flight_id", id, "err", err)
+		http.Error(w, "Error querying for group flight", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(detail)
+}
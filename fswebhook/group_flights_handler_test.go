@@ -0,0 +1,163 @@
+package fswebhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func setupGroupFlightTables(t *testing.T) {
+	t.Helper()
+	setupTestDB(t)
+	clear := func() {
+		for _, table := range []string{"group_flights", "group_flight_members", "group_flight_leaders"} {
+			if _, err := db.Exec(`DELETE FROM ` + table); err != nil {
+				t.Fatalf("Failed to clear %s table: %v", table, err)
+			}
+		}
+	}
+	clear()
+	t.Cleanup(clear)
+}
+
+func TestGroupFlightsHandlerPagination(t *testing.T) {
+	setupGroupFlightTables(t)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for i := 0; i < 3; i++ {
+		insertTestGroupFlight(t, 100*(i+1), 1+i, 10*(i+1), 4, "KJFK", "KBOS", now.Add(-time.Duration(3+i*24)*time.Hour))
+	}
+	if _, err := DetectGroupFlights(context.Background(), now.Add(-7*24*time.Hour)); err != nil {
+		t.Fatalf("DetectGroupFlights returned error: %v", err)
+	}
+
+	get := func(query string) GroupFlightPage {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		GroupFlightsHandler(rr, httptest.NewRequest(http.MethodGet, "/group-flights?"+query, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", query, rr.Code, rr.Body.String())
+		}
+		var page GroupFlightPage
+		if err := json.NewDecoder(rr.Body).Decode(&page); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return page
+	}
+	nextPage := func(page GroupFlightPage, limit int) GroupFlightPage {
+		t.Helper()
+		if page.NextBefore == nil || page.NextID == 0 {
+			t.Fatalf("expected a cursor for the next page, got %+v", page)
+		}
+		return get(fmt.Sprintf("limit=%d&before=%s&before_id=%d", limit,
+			url.QueryEscape(page.NextBefore.Format(time.RFC3339)), page.NextID))
+	}
+
+	page := get("limit=2")
+	if len(page.GroupFlights) != 2 {
+		t.Fatalf("expected 2 group flights on the first page, got %d", len(page.GroupFlights))
+	}
+	first, second := page.GroupFlights[0], page.GroupFlights[1]
+	if !first.StartTime.After(second.StartTime) {
+		t.Errorf("expected the most recent group flight first, got %v then %v", first.StartTime, second.StartTime)
+	}
+
+	next := nextPage(page, 2)
+	if len(next.GroupFlights) != 1 || next.GroupFlights[0].ID == first.ID || next.GroupFlights[0].ID == second.ID {
+		t.Errorf("expected the one remaining group flight on the second page, got %+v", next.GroupFlights)
+	}
+	if next.NextBefore != nil {
+		t.Errorf("expected no cursor on the last page, got %v", next.NextBefore)
+	}
+
+	// Groups starting in the same second are told apart by ID rather than skipped.
+	if _, err := db.Exec(`UPDATE group_flights SET first_arrival = ?`, sqlTime(now.Add(-time.Hour))); err != nil {
+		t.Fatalf("Failed to update group flights: %v", err)
+	}
+	seen := make(map[int64]bool)
+	for page = get("limit=1"); ; page = nextPage(page, 1) {
+		for _, g := range page.GroupFlights {
+			seen[g.ID] = true
+		}
+		if page.NextBefore == nil || len(seen) > 3 {
+			break
+		}
+	}
+	if len(seen) != 3 {
+		t.Errorf("expected to page through all 3 group flights starting together, saw %d", len(seen))
+	}
+
+	if empty := get("before=2000-01-01"); len(empty.GroupFlights) != 0 {
+		t.Errorf("expected no group flights before 2000, got %d", len(empty.GroupFlights))
+	}
+
+	for _, query := range []string{"limit=0", "limit=101", "before=yesterday", "before_id=x"} {
+		rr := httptest.NewRecorder()
+		GroupFlightsHandler(rr, httptest.NewRequest(http.MethodGet, "/group-flights?"+query, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, rr.Code)
+		}
+	}
+}
+
+func TestGroupFlightDetailHandler(t *testing.T) {
+	setupGroupFlightTables(t)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	leaderArrival := now.Add(-2 * time.Hour)
+	insertTestGroupFlight(t, 100, 1, 10, 6, "KJFK", "KBOS", leaderArrival)
+	if err := AddGroupFlightLeaders(context.Background(), []int{1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DetectGroupFlights(context.Background(), now.Add(-24*time.Hour)); err != nil {
+		t.Fatalf("DetectGroupFlights returned error: %v", err)
+	}
+	groups, err := getDetectedGroupFlights(context.Background(), groupFlightCursor{Before: now}, defaultGroupFlightPage, GroupFlightSettings)
+	if err != nil || len(groups) != 1 {
+		t.Fatalf("expected 1 group flight, got %d (%v)", len(groups), err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/group-flights/{id}", GroupFlightDetailHandler)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/group-flights/%d", groups[0].ID), nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var detail GroupFlightDetail
+	if err := json.NewDecoder(rr.Body).Decode(&detail); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	// The full roster is returned, not only the top 5.
+	if len(detail.Pilots) != 7 {
+		t.Fatalf("expected 7 pilots in the roster, got %d", len(detail.Pilots))
+	}
+	if detail.LeaderName != "Leader" || !detail.StartTime.Equal(leaderArrival) {
+		t.Errorf("expected the leader's arrival as the start time, got %s at %v", detail.LeaderName, detail.StartTime)
+	}
+	if detail.Pilots[0].LandingRate != -100 || detail.Pilots[0].Rank != 1 {
+		t.Errorf("expected the -100 fpm landing to rank first, got %+v", detail.Pilots[0])
+	}
+	// Followers arrive one minute apart after the leader, all flying for an hour.
+	if f := detail.Formation; f == nil || f.ArrivalSpreadSeconds != 360 || f.DepartureSpreadSeconds != 360 {
+		t.Errorf("expected 360s spreads, got %+v", f)
+	}
+	// (-150 - 100 - 110 - 120 - 130 - 140 - 150) / 7
+	if want := -900.0 / 7; detail.AverageLandingRate < want-0.01 || detail.AverageLandingRate > want+0.01 {
+		t.Errorf("expected average landing rate %.2f, got %.2f", want, detail.AverageLandingRate)
+	}
+
+	for path, code := range map[string]int{"/group-flights/999": http.StatusNotFound, "/group-flights/abc": http.StatusBadRequest} {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != code {
+			t.Errorf("%s: expected status %d, got %d", path, code, rr.Code)
+		}
+	}
+}
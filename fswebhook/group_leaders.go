@@ -0,0 +1,155 @@
+package fswebhook
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// GroupFlightLeader struct to hold a pilot allowed to lead group flights
+type GroupFlightLeader struct {
+	PilotID   int    `json:"pilotid"`
+	PilotName string `json:"pilotname,omitempty"`
+}
+
+// AddGroupFlightLeaders registers pilots as group flight leaders. Pilots that are already
+// leaders are left untouched.
+func AddGroupFlightLeaders(ctx context.Context, pilotIDs []int) error {
+	for _, id := range pilotIDs {
+		if err := addGroupFlightLeader(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupFlightLeadersSeededKey marks in sent_notifications that the configured leaders were
+// registered.
+const groupFlightLeadersSeededKey = "seed:group_flight_leaders"
+
+// SeedGroupFlightLeaders registers the configured leaders the first time there are any. From
+// then on the list is managed through the admin API, so leaders removed there stay removed
+// across restarts, even if none are left. It reports whether the list was seeded.
+func SeedGroupFlightLeaders(ctx context.Context, pilotIDs []int) (bool, error) {
+	var seeded bool
+	if err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM sent_notifications WHERE key = ?)`,
+		groupFlightLeadersSeededKey).Scan(&seeded); err != nil {
+		return false, err
+	}
+	if seeded || len(pilotIDs) == 0 {
+		return false, nil
+	}
+	if err := AddGroupFlightLeaders(ctx, pilotIDs); err != nil {
+		return false, err
+	}
+	_, err := markNotified(ctx, groupFlightLeadersSeededKey)
+	return err == nil, err
+}
+
+// isGroupFlightLeader reports whether the pilot is a registered group flight leader.
+func isGroupFlightLeader(ctx context.Context, pilotID int) (bool, error) {
+	var exists bool
+	err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM group_flight_leaders WHERE pilotid = ?)`, pilotID).Scan(&exists)
+	return exists, err
+}
+
+func addGroupFlightLeader(ctx context.Context, pilotID int) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT OR IGNORE INTO group_flight_leaders (pilotid, added_at) VALUES (?, ?)`,
+		pilotID, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// getGroupFlightLeaders lists the configured leaders along with the name they last flew under.
+func getGroupFlightLeaders(ctx context.Context) ([]GroupFlightLeader, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT l.pilotid,
+			(SELECT pilotname FROM flights f WHERE f.pilotid = l.pilotid ORDER BY f.arrival_time DESC LIMIT 1)
+		FROM group_flight_leaders AS l
+		ORDER BY l.pilotid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	leaders := []GroupFlightLeader{}
+	for rows.Next() {
+		var l GroupFlightLeader
+		var name sql.NullString
+		if err := rows.Scan(&l.PilotID, &name); err != nil {
+			return nil, err
+		}
+		l.PilotName = name.String
+		leaders = append(leaders, l)
+	}
+	return leaders, rows.Err()
+}
+
+// GroupLeadersAdminHandler lists (GET) or adds (POST {"pilotid": 123}) group flight leaders.
+func GroupLeadersAdminHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var leader GroupFlightLeader
+		if err := json.NewDecoder(r.Body).Decode(&leader); err != nil || leader.PilotID <= 0 {
+			http.Error(w, "Request body must be {\"pilotid\": <id>}", http.StatusBadRequest)
+			return
+		}
+		if err := addGroupFlightLeader(r.Context(), leader.PilotID); err != nil {
+			slog.ErrorContext(r.Context(), "Error adding group flight leader", "pilot_id", leader.PilotID, "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "Added group flight leader", "pilot_id", leader.PilotID)
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	leaders, err := getGroupFlightLeaders(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error querying group flight leaders", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(leaders)
+}
+
+// GroupLeaderAdminHandler removes (DELETE) the group flight leader in the {id} path segment.
+func GroupLeaderAdminHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pilotID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid pilot ID", http.StatusBadRequest)
+		return
+	}
+
+	res, err := db.ExecContext(r.Context(), `DELETE FROM group_flight_leaders WHERE pilotid = ?`, pilotID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error removing group flight leader", "pilot_id", pilotID, "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Not a group flight leader", http.StatusNotFound)
+		return
+	}
+	slog.InfoContext(r.Context(), "Removed group flight leader", "pilot_id", pilotID)
+	w.WriteHeader(http.StatusNoContent)
+}
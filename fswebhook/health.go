@@ -0,0 +1,137 @@
+package fswebhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// CertCacheDir is the autocert cache checked by the readiness endpoint, empty when TLS is off.
+var CertCacheDir string
+
+// jobStaleIntervals is how many intervals a periodic job may go without succeeding before
+// the server stops reporting itself ready.
+const jobStaleIntervals = 3
+
+// readinessTimeout bounds the database checks so a locked database fails the probe
+// instead of hanging it.
+const readinessTimeout = 2 * time.Second
+
+// CheckResult struct to hold the outcome of one readiness check
+type CheckResult struct {
+	Status string `json:"status"` // "ok" or "fail"
+	Error  string `json:"error,omitempty"`
+
+	// Set for periodic jobs.
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	AgeSeconds  *int64     `json:"age_seconds,omitempty"`
+}
+
+// ReadinessReport struct to hold the readiness of the server and each of its dependencies
+type ReadinessReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+func checkResult(err error) CheckResult {
+	if err != nil {
+		return CheckResult{Status: "fail", Error: err.Error()}
+	}
+	return CheckResult{Status: "ok"}
+}
+
+// checkJob fails a periodic job that has gone jobStaleIntervals intervals without succeeding,
+// counting from when it started if it never has.
+func checkJob(job jobState, now time.Time) CheckResult {
+	since := job.Started
+	result := CheckResult{Status: "ok"}
+	if !job.LastSuccess.IsZero() {
+		since = job.LastSuccess
+		lastSuccess := job.LastSuccess.UTC()
+		age := int64(now.Sub(job.LastSuccess).Seconds())
+		result.LastSuccess, result.AgeSeconds = &lastSuccess, &age
+	}
+	if now.Sub(since) > jobStaleIntervals*job.Interval {
+		result.Status = "fail"
+		result.Error = fmt.Sprintf("no successful run in %s", now.Sub(since).Round(time.Second))
+		if job.LastError != "" {
+			result.Error += ", last error: " + job.LastError
+		}
+	}
+	return result
+}
+
+// checkReadiness runs every readiness check.
+func checkReadiness(ctx context.Context, now time.Time) ReadinessReport {
+	report := ReadinessReport{Status: "ok", Checks: make(map[string]CheckResult)}
+
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+	report.Checks["database"] = checkResult(db.PingContext(ctx))
+
+	var version int
+	err := db.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version)
+	if err == nil && version != len(migrations) {
+		err = fmt.Errorf("schema version %d, expected %d", version, len(migrations))
+	}
+	report.Checks["migrations"] = checkResult(err)
+
+	if CertCacheDir != "" {
+		_, err := os.ReadDir(CertCacheDir)
+		report.Checks["cert_cache"] = checkResult(err)
+	}
+
+	jobsMu.Lock()
+	for name, job := range jobs {
+		report.Checks["job:"+name] = checkJob(*job, now)
+	}
+	jobsMu.Unlock()
+
+	for _, check := range report.Checks {
+		if check.Status != "ok" {
+			report.Status = "fail"
+		}
+	}
+	return report
+}
+
+// Diagnose runs the readiness checks along with ones too slow to poll: a full integrity check
+// of the database.
+func Diagnose(ctx context.Context) ReadinessReport {
+	report := checkReadiness(ctx, time.Now())
+
+	var result string
+	err := db.QueryRowContext(ctx, `PRAGMA integrity_check`).Scan(&result)
+	if err == nil && result != "ok" {
+		err = errors.New(result)
+	}
+	report.Checks["integrity"] = checkResult(err)
+	if err != nil {
+		report.Status = "fail"
+	}
+	return report
+}
+
+// HealthzHandler reports that the process is up, without checking its dependencies.
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// ReadyzHandler reports whether the server can do its work: the database answers and is fully
+// migrated, the certificate cache is readable and the periodic jobs keep succeeding. It
+// answers 503 with the failing checks otherwise.
+func ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	report := checkReadiness(r.Context(), time.Now())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
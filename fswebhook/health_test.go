@@ -0,0 +1,75 @@
+package fswebhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckJob(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		job    jobState
+		status string
+	}{
+		{"recent success", jobState{Interval: 5 * time.Minute, Started: now.Add(-time.Hour), LastSuccess: now.Add(-5 * time.Minute)}, "ok"},
+		{"stale success", jobState{Interval: 5 * time.Minute, Started: now.Add(-time.Hour), LastSuccess: now.Add(-20 * time.Minute), LastError: "database is locked"}, "fail"},
+		{"just started", jobState{Interval: 5 * time.Minute, Started: now.Add(-time.Minute)}, "ok"},
+		{"never succeeded", jobState{Interval: 5 * time.Minute, Started: now.Add(-time.Hour)}, "fail"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkJob(tt.job, now); got.Status != tt.status {
+				t.Errorf("expected %s, got %+v", tt.status, got)
+			}
+		})
+	}
+
+	got := checkJob(tests[1].job, now)
+	if got.Error != "no successful run in 20m0s, last error: database is locked" || *got.AgeSeconds != 1200 {
+		t.Errorf("unexpected stale job result %+v", got)
+	}
+}
+
+func TestReadyzHandler(t *testing.T) {
+	setupTestDB(t)
+
+	ready := func() (int, ReadinessReport) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		ReadyzHandler(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var report ReadinessReport
+		if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return rr.Code, report
+	}
+
+	code, report := ready()
+	if code != http.StatusOK || report.Status != "ok" || report.Checks["database"].Status != "ok" || report.Checks["migrations"].Status != "ok" {
+		t.Errorf("expected the server ready, got %d %+v", code, report)
+	}
+
+	CertCacheDir = filepath.Join(t.TempDir(), "missing")
+	jobsMu.Lock()
+	jobs["test-job"] = &jobState{Interval: time.Minute, Started: time.Now().Add(-time.Hour)}
+	jobsMu.Unlock()
+	t.Cleanup(func() {
+		CertCacheDir = ""
+		jobsMu.Lock()
+		delete(jobs, "test-job")
+		jobsMu.Unlock()
+	})
+
+	code, report = ready()
+	if code != http.StatusServiceUnavailable || report.Status != "fail" {
+		t.Errorf("expected status 503, got %d %+v", code, report)
+	}
+	if report.Checks["cert_cache"].Status != "fail" || report.Checks["job:test-job"].Status != "fail" {
+		t.Errorf("expected the certificate cache and job checks to fail, got %+v", report.Checks)
+	}
+}
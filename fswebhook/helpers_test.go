@@ -0,0 +1,75 @@
+package fswebhook
+
+import (
+	"testing"
+	"time"
+)
+
+// testFlight describes a row inserted into the flights table by insertTestFlights.
+type testFlight struct {
+	FlightID      int
+	PilotID       int
+	PilotName     string
+	LandingRate   float64
+	Distance      int
+	Duration      time.Duration
+	AircraftICAO  string
+	AircraftName  string
+	DepartureICAO string
+	ArrivalICAO   string
+	FuelUsed      float64
+	Arrival       time.Time
+}
+
+// setupTestDB opens the test database and empties the flights table.
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	InitDB()
+
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS flights (
+		flightid INTEGER PRIMARY KEY,
+		pilotid INTEGER,
+		pilotname TEXT,
+		landing_rate INTEGER,
+		distance INTEGER,
+		"time" INTEGER,
+		aircraft_icao TEXT,
+		aircraft_name TEXT,
+		departure_icao TEXT,
+		arrival_icao TEXT,
+		fuel_used INTEGER,
+		departure_time DATETIME,
+		arrival_time DATETIME
+	);
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create flights table: %v", err)
+	}
+	if _, err := db.Exec(`DELETE FROM flights`); err != nil {
+		t.Fatalf("Failed to clear flights table: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM flights`)
+	})
+}
+
+// insertTestFlights writes flights straight into the flights table, the same way updatedb.py does.
+func insertTestFlights(t *testing.T, flights ...testFlight) {
+	t.Helper()
+	for _, f := range flights {
+		departure := f.Arrival.Add(-f.Duration)
+		_, err := db.Exec(`
+			INSERT INTO flights (
+				flightid, pilotid, pilotname, landing_rate, distance, "time",
+				aircraft_icao, aircraft_name, departure_icao, arrival_icao, fuel_used,
+				departure_time, arrival_time
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			f.FlightID, f.PilotID, f.PilotName, f.LandingRate, f.Distance, int(f.Duration.Seconds()),
+			f.AircraftICAO, f.AircraftName, f.DepartureICAO, f.ArrivalICAO, f.FuelUsed,
+			departure.UTC().Format(time.RFC3339), f.Arrival.UTC().Format(time.RFC3339))
+		if err != nil {
+			t.Fatalf("Failed to insert flight %d: %v", f.FlightID, err)
+		}
+	}
+}
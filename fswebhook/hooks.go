@@ -2,11 +2,12 @@ package fswebhook
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"time"
@@ -16,17 +17,50 @@ import (
 
 var db *sql.DB
 
-func InitDB() {
+// OpenDB opens the database at DatabasePath without migrating it.
+func OpenDB() error {
 	var err error
-	db, err = sql.Open("sqlite3", "./fshub.db")
+	// Webhook deliveries and background jobs write concurrently with ingest, so wait for
+	// locks rather than failing straight away.
+	db, err = sql.Open("sqlite3", DatabasePath+"?_busy_timeout=5000")
 	if err != nil {
-		log.Fatalf("Error opening database: %v", err)
+		return fmt.Errorf("opening database: %w", err)
 	}
-
 	if err = db.Ping(); err != nil {
-		log.Fatalf("Error connecting to database: %v", err)
+		return fmt.Errorf("connecting to database: %w", err)
+	}
+	return nil
+}
+
+// MigrateDB applies the migrations the database has not seen yet and returns how many ran.
+func MigrateDB() (int, error) {
+	before, err := schemaVersion()
+	if err != nil {
+		return 0, fmt.Errorf("reading schema version: %w", err)
+	}
+	if err := migrate(); err != nil {
+		return 0, fmt.Errorf("migrating database: %w", err)
+	}
+	return len(migrations) - before, nil
+}
+
+// InitDB opens and migrates the database, exiting if either fails.
+func InitDB() {
+	if err := OpenDB(); err != nil {
+		slog.Error("Error opening database", "err", err)
+		os.Exit(1)
+	}
+	slog.Info("Connected to the database")
+
+	if _, err := MigrateDB(); err != nil {
+		slog.Error("Error migrating database", "err", err)
+		os.Exit(1)
 	}
-	fmt.Println("Successfully connected to the database.")
+}
+
+// CloseDB closes the database once nothing is left writing to it.
+func CloseDB() error {
+	return db.Close()
 }
 
 type FlightCompletedEvent struct {
@@ -59,7 +93,19 @@ type Departure struct {
 }
 
 type Airport struct {
-	ICAO string `json:"icao"`
+	ICAO   string         `json:"icao"`
+	Locale *AirportLocale `json:"locale,omitempty"`
+}
+
+// AirportLocale struct to hold where an airport is, as sent by the webhook
+type AirportLocale struct {
+	GPS *Coordinates `json:"gps,omitempty"`
+}
+
+// Coordinates struct to hold a position in decimal degrees
+type Coordinates struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
 }
 
 type Arrival struct {
@@ -72,48 +118,121 @@ type Distance struct {
 	NM int `json:"nm"`
 }
 
+// flightTimeLayouts are the formats arrival_time and departure_time are stored in:
+// RFC 3339 from the webhook and FSHub API, and SQLite's own datetime() format.
+var flightTimeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05Z07:00", time.DateTime}
+
+// parseFlightTime parses a timestamp read back from the flights table.
+func parseFlightTime(s string) (time.Time, error) {
+	var err error
+	for _, layout := range flightTimeLayouts {
+		var t time.Time
+		if t, err = time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, err
+}
+
 func FlightCompletedHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	ctx := r.Context()
 	secret := os.Getenv("WEBHOOK_SECRET")
 	if secret != "" {
 		if r.URL.Query().Get("secret") != secret {
+			slog.WarnContext(ctx, "Rejected flight completed event with the wrong secret")
+			recordIngest(ingestAuthFailure)
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 	}
 
-	log.Println("Received flight completed event")
+	slog.DebugContext(ctx, "Received flight completed event")
 
 	if r.Method != http.MethodPost {
+		recordIngest(ingestInvalidMethod)
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
 	}
 
 	bodyBytes, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Printf("Error reading request body: %v", err)
+		slog.ErrorContext(ctx, "Error reading request body", "err", err)
+		recordIngest(ingestReadError)
 		http.Error(w, "Error reading request body", http.StatusBadRequest)
 		return
 	}
-	log.Printf("Received flight completed event: %s", bodyBytes)
+	logPayload(ctx, "Flight completed event payload", bodyBytes)
 
 	r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
 
 	var event FlightCompletedEvent
 	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
-		log.Printf("Error decoding request body: %v /n body: %s", err, bodyBytes)
+		slog.WarnContext(ctx, "Error decoding flight completed event", "err", err, "bytes", len(bodyBytes))
+		recordIngest(ingestDecodeError)
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
-	if event.Data.Arrival.Airport.ICAO == "" || event.Data.Departure.Airport.ICAO == "" {
-		log.Println("Missing required fields in flight data")
+	outcome, rejection, err := ingestFlight(ctx, sourceWebhook, event.Data)
+	recordIngest(outcome)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if outcome == ingestStored {
+		lastFlightIngested.SetToCurrentTime()
+		ingestDuration.Observe(time.Since(start).Seconds())
+	}
+	// Rejected flights are still acknowledged so FSHub does not retry them, but say why.
+	if rejection != nil {
+		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(rejection)
 		return
 	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// ReplayFlightCompleted ingests flight completed events saved from the webhook, one JSON
+// document after another, as if they had just been delivered. Flights already on record are
+// replaced. It returns how many events ended in each ingest outcome.
+func ReplayFlightCompleted(ctx context.Context, r io.Reader) (map[string]int, error) {
+	outcomes := make(map[string]int)
+	dec := json.NewDecoder(r)
+	for n := 1; ; n++ {
+		var event FlightCompletedEvent
+		if err := dec.Decode(&event); err == io.EOF {
+			return outcomes, nil
+		} else if err != nil {
+			return outcomes, fmt.Errorf("decoding event %d: %w", n, err)
+		}
+		outcome, _, err := ingestFlight(ctx, sourceReplay, event.Data)
+		outcomes[outcome]++
+		if err != nil {
+			return outcomes, err
+		}
+	}
+}
+
+// ingestFlight validates and stores a flight from a flight completed event, then runs
+// everything that follows a new flight: achievements, notifications, group flight detection
+// and event attendance. It returns the ingest outcome and, for flights failing validation,
+// why they were rejected; rejected flights are recorded and are not an error.
+func ingestFlight(ctx context.Context, source string, flight FlightData) (string, *Rejection, error) {
+	if rejection := ValidateFlight(flight, IngestSettings); rejection != nil {
+		recordRejection(ctx, db, source, flight, rejection)
+		return rejection.Reason.ingestOutcome(), rejection, nil
+	}
 
-	flight := event.Data
+	// A retried delivery or a replayed log stores the flight again but announces it only once.
+	var existed bool
+	if err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM flights WHERE flightid = ?)`, flight.ID).Scan(&existed); err != nil {
+		slog.ErrorContext(ctx, "Error checking for a stored flight", "flight_id", flight.ID, "err", err)
+		return ingestDatabaseFailure, nil, err
+	}
 
-	stmt, err := db.Prepare(`
+	stmt, err := db.PrepareContext(ctx, `
 		INSERT OR REPLACE INTO flights (
 			flightid, pilotid, pilotname, landing_rate, distance, "time",
 			aircraft_icao, aircraft_name, departure_icao, arrival_icao, fuel_used,
@@ -121,29 +240,17 @@ func FlightCompletedHandler(w http.ResponseWriter, r *http.Request) {
 		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`)
 	if err != nil {
-		log.Printf("Error preparing statement: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
+		slog.ErrorContext(ctx, "Error preparing statement", "err", err)
+		return ingestDatabaseFailure, nil, err
 	}
 	defer stmt.Close()
 
-	departureTime, _ := time.Parse(time.RFC3339, flight.Departure.DateTime)
-	arrivalTime, _ := time.Parse(time.RFC3339, flight.Arrival.DateTime)
+	departureTime, _ := parseFlightTime(flight.Departure.DateTime)
+	arrivalTime, _ := parseFlightTime(flight.Arrival.DateTime)
 	duration := arrivalTime.Sub(departureTime).Seconds()
 
-	if duration < 300 { // Ignore flights shorter than 5 minutes
-		log.Println("Ignoring flight shorter than 5 minutes. body: ", bodyBytes)
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
-	if departureTime.IsZero() || arrivalTime.IsZero() {
-		log.Println("Invalid departure or arrival time: body: ", bodyBytes)
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
-	_, err = stmt.Exec(
+	// Finish storing the flight even if the sender hangs up.
+	_, err = stmt.ExecContext(context.WithoutCancel(ctx),
 		flight.ID,
 		flight.User.ID,
 		flight.User.Name,
@@ -159,11 +266,32 @@ func FlightCompletedHandler(w http.ResponseWriter, r *http.Request) {
 		flight.Arrival.DateTime,
 	)
 	if err != nil {
-		log.Printf("Error inserting flight data: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
+		slog.ErrorContext(ctx, "Error inserting flight data", "flight_id", flight.ID, "err", err)
+		return ingestDatabaseFailure, nil, err
 	}
 
-	log.Printf("Successfully inserted flight data for flight ID %d", flight.ID)
-	w.WriteHeader(http.StatusOK)
+	slog.InfoContext(ctx, "Stored flight", "flight_id", flight.ID, "pilot_id", flight.User.ID,
+		"departure", flight.Departure.Airport.ICAO, "arrival", flight.Arrival.Airport.ICAO)
+
+	// What follows from the stored flight is finished as well, keeping the request ID.
+	ctx = context.WithoutCancel(ctx)
+	if err := evaluateAchievements(ctx, flight); err != nil {
+		slog.ErrorContext(ctx, "Error evaluating achievements", "flight_id", flight.ID, "err", err)
+	}
+
+	if !existed {
+		if err := publishFlightNotifications(ctx, flight, duration); err != nil {
+			slog.ErrorContext(ctx, "Error publishing notifications", "flight_id", flight.ID, "err", err)
+		}
+	}
+
+	if err := detectGroupFlightsForFlight(ctx, flight); err != nil {
+		slog.ErrorContext(ctx, "Error detecting group flights", "flight_id", flight.ID, "err", err)
+	}
+
+	if err := matchEventAttendance(ctx, 0, flight.ID, departureTime.Add(-24*time.Hour)); err != nil {
+		slog.ErrorContext(ctx, "Error matching event attendance", "flight_id", flight.ID, "err", err)
+	}
+
+	return ingestStored, nil, nil
 }
@@ -2,11 +2,13 @@ package fswebhook
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -303,3 +305,45 @@ func TestFlightCompletedHandler_EdgeCases(t *testing.T) {
 		})
 	}
 }
+
+func TestReplayFlightCompleted(t *testing.T) {
+	setupTestDB(t)
+	jsonData, err := os.ReadFile(filepath.Join("testdata", "flight.completed.example.json"))
+	if err != nil {
+		t.Fatalf("Failed to read example JSON file: %v", err)
+	}
+
+	ch, unsubscribe := Subscribe(10)
+	defer unsubscribe()
+
+	// The same event twice, then one without airports.
+	payloads := string(jsonData) + "\n" + string(jsonData) + "\n" + `{"_data": {"id": 1}}`
+	outcomes, err := ReplayFlightCompleted(context.Background(), strings.NewReader(payloads))
+	if err != nil {
+		t.Fatalf("ReplayFlightCompleted returned error: %v", err)
+	}
+	if outcomes[ingestStored] != 2 || outcomes[ingestMissingFields] != 1 {
+		t.Errorf("unexpected outcomes %v", outcomes)
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM flights`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected the replayed flight stored once, got %d", count)
+	}
+	stored := 0
+	for _, n := range receiveNotifications(ch) {
+		if n.Type == NotificationFlightStored {
+			stored++
+		}
+	}
+	if stored != 1 {
+		t.Errorf("expected the replayed flight announced once, got %d", stored)
+	}
+
+	if _, err := ReplayFlightCompleted(context.Background(), strings.NewReader(`{"_data": `)); err == nil {
+		t.Error("expected an error replaying a truncated payload")
+	}
+}
@@ -0,0 +1,257 @@
+package fswebhook
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// importBatchSize is how many flights an import stores per transaction.
+const importBatchSize = 500
+
+// importFlight struct to hold a flight in either the FSHub API's shape or the webhook's, so
+// dumps of both can be read alike: the API puts the airport code and time directly under
+// departure and arrival, the webhook nests the code under "airport" and calls the time
+// "datetime".
+type importFlight struct {
+	ID          int           `json:"id"`
+	User        User          `json:"user"`
+	LandingRate float64       `json:"landing_rate"`
+	Distance    APIDistance   `json:"distance"`
+	Time        int           `json:"time"`
+	Aircraft    Aircraft      `json:"aircraft"`
+	Departure   importAirport `json:"departure"`
+	Arrival     importAirport `json:"arrival"`
+	FuelUsed    float64       `json:"fuel_used"`
+	FuelBurnt   float64       `json:"fuel_burnt"`
+}
+
+// importAirport struct to hold one end of an importFlight
+type importAirport struct {
+	ICAO        string  `json:"icao"`
+	Airport     Airport `json:"airport"`
+	Time        string  `json:"time"`
+	DateTime    string  `json:"datetime"`
+	LandingRate float64 `json:"landing_rate"`
+}
+
+func (a importAirport) apiAirport() APIAirport {
+	airport := APIAirport{ICAO: a.ICAO, Time: a.Time}
+	if airport.ICAO == "" {
+		airport.ICAO = a.Airport.ICAO
+	}
+	if airport.Time == "" {
+		airport.Time = a.DateTime
+	}
+	return airport
+}
+
+func (f importFlight) apiFlight() APIFlight {
+	flight := APIFlight{
+		ID:          f.ID,
+		User:        f.User,
+		LandingRate: f.LandingRate,
+		Distance:    f.Distance,
+		Time:        f.Time,
+		Aircraft:    f.Aircraft,
+		Departure:   f.Departure.apiAirport(),
+		Arrival:     f.Arrival.apiAirport(),
+		FuelUsed:    f.FuelUsed,
+	}
+	if flight.LandingRate == 0 {
+		flight.LandingRate = f.Arrival.LandingRate
+	}
+	if flight.FuelUsed == 0 {
+		flight.FuelUsed = f.FuelBurnt
+	}
+	return flight
+}
+
+// importBatch collects flights and stores them a batch at a time.
+type importBatch struct {
+	ctx     context.Context
+	flights []APIFlight
+	result  ImportResult
+}
+
+func (b *importBatch) add(f APIFlight) error {
+	b.flights = append(b.flights, f)
+	if len(b.flights) < importBatchSize {
+		return nil
+	}
+	return b.flush()
+}
+
+func (b *importBatch) flush() error {
+	if len(b.flights) == 0 {
+		return nil
+	}
+	stored, err := storeAPIFlights(b.ctx, sourceImport, b.flights)
+	b.result.add(stored)
+	b.flights = b.flights[:0]
+	return err
+}
+
+// ImportFlights stores the flights read from r that are not already on record, telling JSON
+// from CSV by the first character. Flights are stored as they are, without the notifications
+// or derived data that follow a webhook delivery; the backfill command catches up on those.
+func ImportFlights(ctx context.Context, r io.Reader) (ImportResult, error) {
+	br := bufio.NewReader(r)
+	for {
+		c, _, err := br.ReadRune()
+		if err == io.EOF {
+			return ImportResult{}, nil
+		} else if err != nil {
+			return ImportResult{}, err
+		}
+		switch c {
+		case ' ', '\t', '\r', '\n', '\uFEFF':
+			continue
+		}
+		br.UnreadRune()
+		if c == '[' || c == '{' {
+			return ImportFlightsJSON(ctx, br)
+		}
+		return ImportFlightsCSV(ctx, br)
+	}
+}
+
+// ImportFlightsJSON stores flights from a sequence of JSON documents, each of which may be a
+// list of flights, a page saved from the FSHub API with the flights under "data", a webhook
+// flight completed event (one per line, as the webhook log keeps them) or a lone flight.
+func ImportFlightsJSON(ctx context.Context, r io.Reader) (ImportResult, error) {
+	batch := &importBatch{ctx: ctx}
+	dec := json.NewDecoder(r)
+	for n := 1; ; n++ {
+		var doc json.RawMessage
+		if err := dec.Decode(&doc); err == io.EOF {
+			break
+		} else if err != nil {
+			return batch.result, fmt.Errorf("decoding document %d: %w", n, err)
+		}
+
+		// API pages keep their flights under "data", webhook events under "_data".
+		var wrapper struct {
+			Data      json.RawMessage `json:"data"`
+			EventData json.RawMessage `json:"_data"`
+		}
+		if doc[0] == '{' {
+			if err := json.Unmarshal(doc, &wrapper); err != nil {
+				return batch.result, fmt.Errorf("decoding document %d: %w", n, err)
+			}
+			if len(wrapper.Data) > 0 {
+				doc = wrapper.Data
+			} else if len(wrapper.EventData) > 0 {
+				doc = wrapper.EventData
+			}
+		}
+
+		var flights []importFlight
+		if bytes.HasPrefix(doc, []byte("[")) {
+			if err := json.Unmarshal(doc, &flights); err != nil {
+				return batch.result, fmt.Errorf("decoding document %d: %w", n, err)
+			}
+		} else {
+			var flight importFlight
+			if err := json.Unmarshal(doc, &flight); err != nil {
+				return batch.result, fmt.Errorf("decoding document %d: %w", n, err)
+			}
+			flights = append(flights, flight)
+		}
+		for _, f := range flights {
+			if err := batch.add(f.apiFlight()); err != nil {
+				return batch.result, err
+			}
+		}
+	}
+	return batch.result, batch.flush()
+}
+
+// ImportFlightsCSV stores flights from CSV with a header row naming flightColumns, as written
+// by ExportFlightsCSV. Columns may come in any order and unknown ones are ignored.
+func ImportFlightsCSV(ctx context.Context, r io.Reader) (ImportResult, error) {
+	batch := &importBatch{ctx: ctx}
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return batch.result, nil
+	} else if err != nil {
+		return batch.result, fmt.Errorf("reading header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimPrefix(name, "\uFEFF")] = i
+	}
+	if _, ok := columns["flightid"]; !ok {
+		return batch.result, fmt.Errorf("header has no flightid column")
+	}
+	cr.FieldsPerRecord = len(header)
+
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return batch.result, err
+		}
+		flight, err := csvFlight(record, columns)
+		if err != nil {
+			slog.WarnContext(ctx, "Skipping invalid flight", "line", line, "err", err)
+			batch.result.Invalid++
+			continue
+		}
+		if err := batch.add(flight); err != nil {
+			return batch.result, err
+		}
+	}
+	return batch.result, batch.flush()
+}
+
+// csvFlight reads a flight from a CSV record; missing columns are left zero.
+func csvFlight(record []string, columns map[string]int) (APIFlight, error) {
+	var f APIFlight
+	var err error
+	column := func(name string) string {
+		if i, ok := columns[name]; ok {
+			return record[i]
+		}
+		return ""
+	}
+	// Text cells are read back without the quote csvText guards formulas with.
+	text := func(name string) string {
+		s := column(name)
+		if len(s) > 1 && s[0] == '\'' && csvText(s[1:]) != s[1:] {
+			return s[1:]
+		}
+		return s
+	}
+	number := func(name string) float64 {
+		s := column(name)
+		if s == "" || err != nil {
+			return 0
+		}
+		var v float64
+		if v, err = strconv.ParseFloat(s, 64); err != nil {
+			err = fmt.Errorf("invalid %s %q", name, s)
+		}
+		return v
+	}
+
+	f.ID = int(number("flightid"))
+	f.User = User{ID: int(number("pilotid")), Name: text("pilotname")}
+	f.LandingRate = number("landing_rate")
+	f.Distance.NM = number("distance")
+	f.Time = int(number("time"))
+	f.Aircraft = Aircraft{ICAO: text("aircraft_icao"), Name: text("aircraft_name")}
+	f.Departure = APIAirport{ICAO: text("departure_icao"), Time: column("departure_time")}
+	f.Arrival = APIAirport{ICAO: text("arrival_icao"), Time: column("arrival_time")}
+	f.FuelUsed = number("fuel_used")
+	return f, err
+}
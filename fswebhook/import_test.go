@@ -0,0 +1,91 @@
+package fswebhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImportFlightsWebhookEvents(t *testing.T) {
+	setupTestDB(t)
+	jsonData, err := os.ReadFile(filepath.Join("testdata", "flight.completed.example.json"))
+	if err != nil {
+		t.Fatalf("Failed to read test data: %v", err)
+	}
+	var event bytes.Buffer
+	if err := json.Compact(&event, jsonData); err != nil {
+		t.Fatal(err)
+	}
+
+	// One event per line, repeated, followed by an API flight with an unreadable time.
+	input := event.String() + "\n" + event.String() + "\n" +
+		strings.Replace(apiFlightJSON(5, "A320"), "2025-07-24T20:00:00.000000Z", "yesterday", 1)
+	result, err := ImportFlights(context.Background(), strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ImportFlights returned error: %v", err)
+	}
+	if result != (ImportResult{Inserted: 1, Skipped: 1, Invalid: 1}) {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	var landingRate, fuel float64
+	var seconds int
+	var departureICAO, departure string
+	if err := db.QueryRow(`SELECT landing_rate, fuel_used, "time", departure_icao, departure_time FROM flights WHERE flightid = 3901328`).
+		Scan(&landingRate, &fuel, &seconds, &departureICAO, &departure); err != nil {
+		t.Fatalf("Failed to read imported flight: %v", err)
+	}
+	// The webhook's datetime fields are read like the API's time, and the duration worked out.
+	dep, _ := parseFlightTime(departure)
+	if landingRate != -196 || fuel != 2390 || seconds != 3469 || departureICAO != "KMYR" ||
+		!dep.Equal(time.Date(2025, 7, 24, 21, 32, 49, 0, time.UTC)) {
+		t.Errorf("unexpected imported flight: %v %v %d %s %s", landingRate, fuel, seconds, departureICAO, departure)
+	}
+}
+
+func TestImportFlightsCSV(t *testing.T) {
+	setupTestDB(t)
+	day := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	insertTestFlights(t,
+		testFlight{FlightID: 1, PilotID: 7, PilotName: "Alice, Jr.", LandingRate: -85, Distance: 400, Duration: time.Hour,
+			AircraftICAO: "A320", DepartureICAO: "KJFK", ArrivalICAO: "KBOS", Arrival: day},
+		testFlight{FlightID: 2, PilotID: 8, PilotName: "Bob", Duration: 2 * time.Hour, AircraftICAO: "B738",
+			DepartureICAO: "KORD", ArrivalICAO: "KATL", Arrival: day},
+	)
+	var exported bytes.Buffer
+	if _, err := ExportFlightsCSV(context.Background(), &exported, FlightFilter{Start: day.AddDate(0, 0, -1), End: day.AddDate(0, 0, 1)}); err != nil {
+		t.Fatalf("ExportFlightsCSV returned error: %v", err)
+	}
+	if _, err := db.Exec(`DELETE FROM flights WHERE flightid = 1`); err != nil {
+		t.Fatal(err)
+	}
+
+	// An export reads back in, with a row whose landing rate is not a number.
+	input := exported.String() + "3,9,Carol,soft,100,3600,C172,,KJFK,KJFK,0,2025-07-01T10:00:00Z,2025-07-01T11:00:00Z\n"
+	result, err := ImportFlights(context.Background(), strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ImportFlights returned error: %v", err)
+	}
+	if result != (ImportResult{Inserted: 1, Skipped: 1, Invalid: 1}) {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	var name, aircraft string
+	var landingRate, distance float64
+	if err := db.QueryRow(`SELECT pilotname, aircraft_icao, landing_rate, distance FROM flights WHERE flightid = 1`).
+		Scan(&name, &aircraft, &landingRate, &distance); err != nil {
+		t.Fatalf("Failed to read imported flight: %v", err)
+	}
+	if name != "Alice, Jr." || aircraft != "A320" || landingRate != -85 || distance != 400 {
+		t.Errorf("unexpected imported flight: %s %s %v %v", name, aircraft, landingRate, distance)
+	}
+
+	if _, err := ImportFlightsCSV(context.Background(), strings.NewReader("id,pilot\n1,7\n")); err == nil {
+		t.Error("expected an error importing CSV without a flightid column")
+	}
+}
@@ -0,0 +1,88 @@
+package fswebhook
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// jobState struct to hold what the readiness check needs to know about a periodic job
+type jobState struct {
+	Interval    time.Duration
+	Started     time.Time
+	LastSuccess time.Time
+	LastError   string
+}
+
+var (
+	jobsMu sync.Mutex
+	jobs   = make(map[string]*jobState)
+)
+
+// RunPeriodic runs fn immediately and then every interval until ctx is cancelled, which is
+// also passed to fn. Failures are logged; the time of the last successful run is kept per job name.
+func RunPeriodic(ctx context.Context, name string, interval time.Duration, fn func(context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	jobsMu.Lock()
+	state := &jobState{Interval: interval, Started: time.Now()}
+	jobs[name] = state
+	jobsMu.Unlock()
+
+	for {
+		err := fn(ctx)
+		if err != nil {
+			slog.Error("Error running job", "job", name, "err", err)
+		}
+		jobsMu.Lock()
+		if err != nil {
+			state.LastError = err.Error()
+		} else {
+			state.LastSuccess = time.Now()
+			state.LastError = ""
+		}
+		jobsMu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// groupDetectorLookback is how far back GroupFlightDetectorJob looks for group flights.
+const groupDetectorLookback = 24 * time.Hour
+
+// GroupFlightDetectorJob detects group flights among the flights of the last day. It picks
+// up flights imported by updatedb.py, which never pass through the webhook. Group flights
+// that can no longer grow are then announced.
+func GroupFlightDetectorJob(ctx context.Context) error {
+	now := time.Now().UTC()
+	if _, err := DetectGroupFlights(ctx, now.Add(-groupDetectorLookback)); err != nil {
+		return err
+	}
+	return announceCompletedGroupFlights(ctx, now)
+}
+
+// WeeklyDigestJob announces the leaderboards of the most recently completed week, once. The
+// week is marked as announced only after it is published, so a crash in between announces
+// it again rather than never.
+func WeeklyDigestJob(ctx context.Context) error {
+	week := getWeeklyDateRanges(1)[0]
+	key := "week:" + week[0].Format(time.DateOnly)
+
+	var sent bool
+	if err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM sent_notifications WHERE key = ?)`, key).Scan(&sent); err != nil || sent {
+		return err
+	}
+	report, err := GetWeeklyReport(ctx, week[0], week[1])
+	if err != nil {
+		return err
+	}
+	publish(NotificationWeekClosed, report)
+	_, err = markNotified(ctx, key)
+	return err
+}
@@ -0,0 +1,151 @@
+package fswebhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/felixge/httpsnoop"
+)
+
+// requestIDHeader carries the request ID, taken from the client or proxy when it sends one.
+const requestIDHeader = "X-Request-ID"
+
+type contextKey int
+
+const requestIDKey contextKey = iota
+
+// RequestID returns the ID of the request ctx belongs to, or "" outside of a request.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// contextHandler adds the request ID to records logged with a request's context.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// SetupLogging makes structured JSON at the given level the default log output, including
+// for anything still logging through the log package.
+func SetupLogging(w io.Writer, level slog.Leveler) {
+	slog.SetDefault(slog.New(contextHandler{slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})}))
+}
+
+// validRequestID accepts IDs from upstream that are safe to log and echo back.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// quietPaths are polled by monitoring, so their requests are only logged at debug level.
+var quietPaths = map[string]bool{"/healthz": true, "/readyz": true, "/metrics": true}
+
+// RequestLogger gives every request an ID, passed on in its context and the X-Request-ID
+// response header, and logs it once served. Query strings are left out of the log as the
+// webhook secret travels in one.
+func RequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDKey, id))
+
+		m := httpsnoop.CaptureMetrics(next, w, r)
+
+		level := slog.LevelInfo
+		if quietPaths[r.URL.Path] {
+			level = slog.LevelDebug
+		}
+		slog.Log(r.Context(), level, "Request served",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"route", r.Pattern,
+			"status", m.Code,
+			"bytes", m.Written,
+			"duration_ms", m.Duration.Milliseconds(),
+			"remote", r.RemoteAddr,
+			"user_agent", r.UserAgent())
+	})
+}
+
+// redactedFields are payload fields never written to the logs, matched case-insensitively.
+var redactedFields = map[string]bool{
+	"email": true, "password": true, "secret": true, "token": true,
+	"api_key": true, "apikey": true, "authorization": true,
+}
+
+func redact(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if redactedFields[strings.ToLower(key)] {
+				v[key] = "[redacted]"
+			} else {
+				v[key] = redact(value)
+			}
+		}
+	case []any:
+		for i := range v {
+			v[i] = redact(v[i])
+		}
+	}
+	return v
+}
+
+// redactPayload returns a JSON payload fit for logging, with personal data and credentials
+// blanked out. Anything that is not JSON is only described, as it cannot be redacted.
+func redactPayload(body []byte) any {
+	var payload any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return fmt.Sprintf("%d bytes, not JSON", len(body))
+	}
+	redacted, err := json.Marshal(redact(payload))
+	if err != nil {
+		return fmt.Sprintf("%d bytes", len(body))
+	}
+	return json.RawMessage(redacted)
+}
+
+// logPayload logs a request body at debug level, redacted.
+func logPayload(ctx context.Context, msg string, body []byte) {
+	if slog.Default().Enabled(ctx, slog.LevelDebug) {
+		slog.DebugContext(ctx, msg, "body", redactPayload(body))
+	}
+}
@@ -0,0 +1,127 @@
+package fswebhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// captureLogs sends the default logger to a buffer for the rest of the test.
+func captureLogs(t *testing.T, level slog.Level) *bytes.Buffer {
+	t.Helper()
+	previous := slog.Default()
+	var buf bytes.Buffer
+	SetupLogging(&buf, level)
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+// logRecords decodes the JSON log lines written to buf.
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Failed to decode log line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestRequestLogger(t *testing.T) {
+	logs := captureLogs(t, slog.LevelInfo)
+	var handlerID string
+	handler := RequestLogger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlerID = RequestID(r.Context())
+		slog.InfoContext(r.Context(), "Handling")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/webhook/flight-completed?secret=hunter2", nil))
+	id := rr.Header().Get(requestIDHeader)
+	if len(id) != 16 || handlerID != id {
+		t.Errorf("expected a generated request ID passed to the handler, got %q and %q", id, handlerID)
+	}
+
+	records := logRecords(t, logs)
+	if len(records) != 2 {
+		t.Fatalf("expected 2 log records, got %d: %s", len(records), logs)
+	}
+	for _, record := range records {
+		if record["request_id"] != id {
+			t.Errorf("expected request_id %s on %v", id, record)
+		}
+	}
+	access := records[1]
+	if access["path"] != "/webhook/flight-completed" || access["status"] != float64(http.StatusAccepted) {
+		t.Errorf("unexpected access log %v", access)
+	}
+	if strings.Contains(logs.String(), "hunter2") {
+		t.Error("the query string should not be logged")
+	}
+
+	// IDs from upstream are kept when they are safe to log, replaced otherwise.
+	for given, kept := range map[string]bool{"abc-123_DEF.4": true, "bad id\nwith newline": false} {
+		req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+		req.Header.Set(requestIDHeader, given)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if got := rr.Header().Get(requestIDHeader); (got == given) != kept {
+			t.Errorf("%q: unexpected request ID %q", given, got)
+		}
+	}
+}
+
+func TestFlightCompletedPayloadLogging(t *testing.T) {
+	setupTestDB(t)
+	t.Setenv("WEBHOOK_SECRET", "")
+	jsonData, err := os.ReadFile(filepath.Join("testdata", "flight.completed.example.json"))
+	if err != nil {
+		t.Fatalf("Failed to read example JSON file: %v", err)
+	}
+	post := func() {
+		rr := httptest.NewRecorder()
+		FlightCompletedHandler(rr, httptest.NewRequest(http.MethodPost, "/webhook/flight-completed", bytes.NewReader(jsonData)))
+	}
+
+	logs := captureLogs(t, slog.LevelInfo)
+	post()
+	if strings.Contains(logs.String(), "payload") {
+		t.Errorf("expected no payload logged at info level, got %s", logs)
+	}
+
+	logs = captureLogs(t, slog.LevelDebug)
+	post()
+	if !strings.Contains(logs.String(), "Flight completed event payload") {
+		t.Fatalf("expected the payload logged at debug level, got %s", logs)
+	}
+	if strings.Contains(logs.String(), "@hotmail.com") || strings.Contains(logs.String(), "@gmail.com") {
+		t.Error("pilot emails should be redacted from the payload")
+	}
+}
+
+func TestRedactPayload(t *testing.T) {
+	got, err := json.Marshal(redactPayload([]byte(`{"user": {"name": "Alice", "Email": "a@example.com"}, "tokens": [{"token": "x"}]}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"tokens":[{"token":"[redacted]"}],"user":{"Email":"[redacted]","name":"Alice"}}`
+	if string(got) != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+	if got := redactPayload([]byte("email=a@example.com")); got != "19 bytes, not JSON" {
+		t.Errorf("expected non-JSON payloads described, got %v", got)
+	}
+}
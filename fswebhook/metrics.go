@@ -0,0 +1,121 @@
+package fswebhook
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Outcomes of flight completed webhook deliveries.
+const (
+	ingestStored          = "stored"
+	ingestShortFlight     = "short_flight"
+	ingestBadTime         = "bad_time"
+	ingestDecodeError     = "decode_error"
+	ingestMissingFields   = "missing_fields"
+	ingestAuthFailure     = "auth_failure"
+	ingestInvalidMethod   = "invalid_method"
+	ingestReadError       = "read_error"
+	ingestDatabaseFailure = "database_error"
+)
+
+var (
+	ingestDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "fshub_webhook_deliveries_total",
+		Help: "Flight completed webhook deliveries by outcome.",
+	}, []string{"outcome"})
+
+	ingestDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "fshub_ingest_duration_seconds",
+		Help:    "Time taken to store a flight and run everything triggered by it.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	lastFlightIngested = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "fshub_last_flight_ingested_timestamp_seconds",
+		Help: "Unix time the last flight was stored by the webhook, or the latest arrival on record at startup.",
+	})
+
+	dbQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "fshub_db_query_duration_seconds",
+		Help:    "Duration of the database queries behind the handlers.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"query"})
+
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "fshub_http_requests_total",
+		Help: "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "fshub_http_request_duration_seconds",
+		Help:    "HTTP request latencies by route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route"})
+)
+
+// recordIngest counts a webhook delivery with the given outcome.
+func recordIngest(outcome string) {
+	ingestDeliveries.WithLabelValues(outcome).Inc()
+}
+
+// timeQuery starts timing a database query, to be stopped by calling the returned function:
+//
+//	defer timeQuery(ctx, "top_pilots")()
+//
+// Durations are also logged at debug level, against the request running the query.
+func timeQuery(ctx context.Context, name string) func() {
+	start := time.Now()
+	return func() {
+		elapsed := time.Since(start)
+		dbQueryDuration.WithLabelValues(name).Observe(elapsed.Seconds())
+		slog.DebugContext(ctx, "Query finished", "query", name, "duration_ms", elapsed.Milliseconds())
+	}
+}
+
+// LoadMetrics sets the metrics that start from the database, so alerts on the time of the
+// last ingested flight do not fire just because the server restarted.
+func LoadMetrics(ctx context.Context) error {
+	var latest *string
+	if err := db.QueryRowContext(ctx, `SELECT max(arrival_time) FROM flights`).Scan(&latest); err != nil || latest == nil {
+		return err
+	}
+	t, err := parseFlightTime(*latest)
+	if err != nil {
+		return err
+	}
+	lastFlightIngested.Set(float64(t.Unix()))
+	return nil
+}
+
+// metricsMethods are the methods given their own label value, any other counting as "other".
+var metricsMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true,
+	http.MethodPut: true, http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// InstrumentHandler counts and times the requests served by mux, labelled by the pattern of the
+// route they matched so that path parameters do not multiply the series.
+func InstrumentHandler(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := httpsnoop.CaptureMetrics(mux, w, r)
+
+		// ServeMux records the matched pattern on the request it routed.
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		method := r.Method
+		if !metricsMethods[method] {
+			method = "other"
+		}
+		httpRequests.WithLabelValues(route, method, strconv.Itoa(m.Code)).Inc()
+		httpDuration.WithLabelValues(route).Observe(m.Duration.Seconds())
+	})
+}
@@ -0,0 +1,77 @@
+package fswebhook
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestFlightCompletedHandlerMetrics(t *testing.T) {
+	setupTestDB(t)
+	t.Setenv("WEBHOOK_SECRET", "test-secret")
+	jsonData, err := os.ReadFile(filepath.Join("testdata", "flight.completed.example.json"))
+	if err != nil {
+		t.Fatalf("Failed to read example JSON file: %v", err)
+	}
+
+	deliveries := func(outcome string) float64 {
+		return testutil.ToFloat64(ingestDeliveries.WithLabelValues(outcome))
+	}
+	before := map[string]float64{}
+	for _, outcome := range []string{ingestStored, ingestDecodeError, ingestAuthFailure} {
+		before[outcome] = deliveries(outcome)
+	}
+
+	for _, tc := range []struct {
+		query string
+		body  []byte
+	}{
+		{"secret=wrong", jsonData},
+		{"secret=test-secret", []byte("{not json")},
+		{"secret=test-secret", jsonData},
+	} {
+		rr := httptest.NewRecorder()
+		FlightCompletedHandler(rr, httptest.NewRequest(http.MethodPost, "/webhook/flight-completed?"+tc.query, bytes.NewReader(tc.body)))
+	}
+
+	for _, outcome := range []string{ingestStored, ingestDecodeError, ingestAuthFailure} {
+		if got := deliveries(outcome) - before[outcome]; got != 1 {
+			t.Errorf("expected one %s delivery counted, got %v", outcome, got)
+		}
+	}
+	if last := testutil.ToFloat64(lastFlightIngested); time.Since(time.Unix(int64(last), 0)) > time.Minute {
+		t.Errorf("expected the last ingested flight to be recent, got %v", last)
+	}
+}
+
+func TestInstrumentHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/pilots/{id}/activity", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := InstrumentHandler(mux)
+
+	requests := func(route, method, code string) float64 {
+		return testutil.ToFloat64(httpRequests.WithLabelValues(route, method, code))
+	}
+	matched := requests("/pilots/{id}/activity", http.MethodGet, "418")
+	unmatched := requests("unmatched", "other", "404")
+
+	for _, path := range []string{"/pilots/1/activity", "/pilots/2/activity"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("BREW", "/coffee", nil))
+
+	if got := requests("/pilots/{id}/activity", http.MethodGet, "418") - matched; got != 2 {
+		t.Errorf("expected both requests counted under the route pattern, got %v", got)
+	}
+	if got := requests("unmatched", "other", "404") - unmatched; got != 1 {
+		t.Errorf("expected the unknown request counted as unmatched, got %v", got)
+	}
+}
@@ -0,0 +1,186 @@
+package fswebhook
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Notification types published on the notification bus.
+const (
+	NotificationFlightStored         = "flight.stored"
+	NotificationRecordBroken         = "record.broken"
+	NotificationGroupFlightDetected  = "group_flight.detected"
+	NotificationGroupFlightCompleted = "group_flight.completed"
+	NotificationWeekClosed           = "week.closed"
+)
+
+// notificationTypes lists every notification type, for validating subscriptions.
+var notificationTypes = []string{
+	NotificationFlightStored,
+	NotificationRecordBroken,
+	NotificationGroupFlightDetected,
+	NotificationGroupFlightCompleted,
+	NotificationWeekClosed,
+}
+
+// Notification struct to hold something worth telling the outside world about
+type Notification struct {
+	ID   int64     `json:"id"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	Data any       `json:"data"`
+}
+
+// notificationBus fans notifications out to every subscriber. Publishing never blocks: a
+// subscriber that falls too far behind misses notifications rather than stalling ingest. A
+// durable subscriber has a backlog in memory to fall back on first.
+type notificationBus struct {
+	mu          sync.Mutex
+	lastID      int64
+	nextSub     int
+	subscribers map[int]*subscriber
+}
+
+// subscriber struct to hold a subscription to the notification bus
+type subscriber struct {
+	ch      chan Notification
+	durable bool
+	backlog []Notification // notifications waiting for room in ch, guarded by the bus
+	wake    chan struct{}
+	done    chan struct{}
+}
+
+// Notification IDs start from the clock so they keep increasing across restarts. Only the
+// IDs carry over: a live feed client resuming from before a restart is told to reset.
+var notifications = &notificationBus{
+	lastID:      time.Now().UnixMilli(),
+	subscribers: make(map[int]*subscriber),
+}
+
+// Subscribe returns a channel receiving every notification published from now on, buffering
+// up to buffer of them, and a function that unsubscribes and closes the channel.
+func Subscribe(buffer int) (<-chan Notification, func()) {
+	return notifications.subscribe(buffer, false)
+}
+
+// durableBacklogSize is how many notifications may wait for a durable subscriber beyond its
+// buffer before further ones are dropped.
+const durableBacklogSize = 1000
+
+// SubscribeDurable is like Subscribe, but up to durableBacklogSize notifications that do not fit
+// in the buffer wait for room rather than being dropped. It is meant for notifiers such as
+// Discord, which may spend a while retrying a single post. The backlog is lost on restart.
+func SubscribeDurable(buffer int) (<-chan Notification, func()) {
+	return notifications.subscribe(buffer, true)
+}
+
+func (b *notificationBus) subscribe(buffer int, durable bool) (<-chan Notification, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.nextSub
+	b.nextSub++
+	s := &subscriber{ch: make(chan Notification, buffer), durable: durable}
+	if durable {
+		s.wake = make(chan struct{}, 1)
+		s.done = make(chan struct{})
+		go b.drain(s)
+	}
+	b.subscribers[id] = s
+
+	var once sync.Once
+	return s.ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.subscribers, id)
+			if durable {
+				close(s.done) // drain closes the channel once it stops sending
+			} else {
+				close(s.ch)
+			}
+		})
+	}
+}
+
+// drain moves a durable subscriber's backlog into its channel, in order, as room frees up.
+func (b *notificationBus) drain(s *subscriber) {
+	defer close(s.ch)
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.wake:
+		}
+		for {
+			b.mu.Lock()
+			if len(s.backlog) == 0 {
+				b.mu.Unlock()
+				break
+			}
+			n := s.backlog[0]
+			b.mu.Unlock()
+
+			select {
+			case s.ch <- n:
+			case <-s.done:
+				return
+			}
+			b.mu.Lock()
+			s.backlog = s.backlog[1:]
+			b.mu.Unlock()
+		}
+	}
+}
+
+func (b *notificationBus) publish(typ string, data any) Notification {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastID++
+	n := Notification{ID: b.lastID, Type: typ, Time: time.Now().UTC(), Data: data}
+	for _, s := range b.subscribers {
+		// Anything already queued has to go first.
+		if len(s.backlog) == 0 {
+			select {
+			case s.ch <- n:
+				continue
+			default:
+			}
+		}
+		if !s.durable || len(s.backlog) >= durableBacklogSize {
+			slog.Warn("Dropping notification for a slow subscriber", "type", n.Type, "notification_id", n.ID, "durable", s.durable)
+			continue
+		}
+		s.backlog = append(s.backlog, n)
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+	return n
+}
+
+// resumeAfter makes sure the next notification ID is above id.
+func (b *notificationBus) resumeAfter(id int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastID = max(b.lastID, id)
+}
+
+// publish sends a notification to every subscriber of the notification bus.
+func publish(typ string, data any) Notification {
+	return notifications.publish(typ, data)
+}
+
+// markNotified records that the notification identified by key went out and reports
+// whether this is the first time, so periodic jobs announce everything exactly once.
+func markNotified(ctx context.Context, key string) (bool, error) {
+	res, err := db.ExecContext(ctx, `INSERT OR IGNORE INTO sent_notifications (key, sent_at) VALUES (?, ?)`,
+		key, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
@@ -0,0 +1,188 @@
+package fswebhook
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// receiveNotifications drains the notifications already waiting on ch.
+func receiveNotifications(ch <-chan Notification) []Notification {
+	var received []Notification
+	for {
+		select {
+		case n, ok := <-ch:
+			if !ok {
+				return received
+			}
+			received = append(received, n)
+		default:
+			return received
+		}
+	}
+}
+
+func clearSentNotifications(t *testing.T) {
+	t.Helper()
+	if _, err := db.Exec(`DELETE FROM sent_notifications`); err != nil {
+		t.Fatalf("Failed to clear sent_notifications table: %v", err)
+	}
+	t.Cleanup(func() { db.Exec(`DELETE FROM sent_notifications`) })
+}
+
+func TestNotificationBus(t *testing.T) {
+	first, unsubscribeFirst := Subscribe(10)
+	second, unsubscribeSecond := Subscribe(10)
+	defer unsubscribeSecond()
+
+	publish(NotificationFlightStored, FlightData{ID: 1})
+	unsubscribeFirst()
+	publish(NotificationFlightStored, FlightData{ID: 2})
+
+	if got := receiveNotifications(first); len(got) != 1 || got[0].Data.(FlightData).ID != 1 {
+		t.Errorf("expected only the notification published while subscribed, got %+v", got)
+	}
+	got := receiveNotifications(second)
+	if len(got) != 2 || got[1].ID <= got[0].ID {
+		t.Errorf("expected 2 notifications with increasing IDs, got %+v", got)
+	}
+	unsubscribeFirst() // unsubscribing twice is harmless
+}
+
+func TestDurableSubscriber(t *testing.T) {
+	ch, unsubscribe := SubscribeDurable(1)
+	defer unsubscribe()
+
+	// The third notification would be dropped for a plain subscriber with a buffer of one.
+	for id := 1; id <= 3; id++ {
+		publish(NotificationFlightStored, FlightData{ID: id})
+	}
+	for want := 1; want <= 3; want++ {
+		select {
+		case n := <-ch:
+			if got := n.Data.(FlightData).ID; got != want {
+				t.Fatalf("expected flight %d next, got %d", want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for flight %d", want)
+		}
+	}
+
+	unsubscribe()
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Error("expected no more notifications after unsubscribing")
+		}
+	case <-time.After(time.Second):
+		t.Error("expected the channel to be closed after unsubscribing")
+	}
+}
+
+func TestDurableSubscriberBacklogIsCapped(t *testing.T) {
+	ch, unsubscribe := SubscribeDurable(1)
+	defer unsubscribe()
+
+	for id := 1; id <= 1+durableBacklogSize+5; id++ {
+		publish(NotificationFlightStored, FlightData{ID: id})
+	}
+	received := 0
+	for {
+		select {
+		case <-ch:
+			received++
+			continue
+		case <-time.After(100 * time.Millisecond):
+		}
+		break
+	}
+	if received != 1+durableBacklogSize {
+		t.Errorf("expected the buffer and a full backlog delivered and the rest dropped, got %d", received)
+	}
+}
+
+func TestFindBrokenRecords(t *testing.T) {
+	setupTestDB(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	insertTestFlights(t,
+		testFlight{FlightID: 1, PilotID: 1, PilotName: "Kip", LandingRate: -100, Distance: 500, Duration: 2 * time.Hour, Arrival: now.Add(-48 * time.Hour)},
+		testFlight{FlightID: 2, PilotID: 2, PilotName: "Ace", LandingRate: -30, Distance: 1000, Duration: 5 * time.Hour, Arrival: now.Add(-24 * time.Hour)},
+		testFlight{FlightID: 3, PilotID: 1, PilotName: "Kip", LandingRate: -50, Distance: 2000, Duration: time.Hour, Arrival: now},
+	)
+
+	flight := FlightData{ID: 3, User: User{ID: 1, Name: "Kip"}, Arrival: Arrival{LandingRate: -50}, Distance: Distance{NM: 2000}}
+	broken, err := findBrokenRecords(context.Background(), flight, time.Hour.Seconds())
+	if err != nil {
+		t.Fatalf("findBrokenRecords returned error: %v", err)
+	}
+	found := make(map[string]string)
+	for _, r := range broken {
+		found[r.Metric] = r.Scope
+	}
+	if len(broken) != 2 || found["landing_rate"] != RecordPersonal || found["distance"] != RecordAirline {
+		t.Errorf("expected a personal landing record and an airline distance record, got %+v", broken)
+	}
+
+	// A pilot's first flight sets no personal records.
+	insertTestFlights(t, testFlight{FlightID: 4, PilotID: 3, PilotName: "New", LandingRate: -200, Distance: 100, Duration: time.Hour, Arrival: now})
+	flight = FlightData{ID: 4, User: User{ID: 3, Name: "New"}, Arrival: Arrival{LandingRate: -200}, Distance: Distance{NM: 100}}
+	if broken, err := findBrokenRecords(context.Background(), flight, time.Hour.Seconds()); err != nil || len(broken) != 0 {
+		t.Errorf("expected no records for a first flight, got %+v (%v)", broken, err)
+	}
+}
+
+func TestAnnounceCompletedGroupFlights(t *testing.T) {
+	setupGroupFlightTables(t)
+	clearSentNotifications(t)
+	ch, unsubscribe := Subscribe(10)
+	defer unsubscribe()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	insertTestGroupFlight(t, 100, 1, 10, 5, "KJFK", "KBOS", now.Add(-2*time.Hour))
+	// Still arriving: more pilots could join this one.
+	insertTestGroupFlight(t, 200, 2, 20, 5, "KBOS", "KPHL", now.Add(-10*time.Minute))
+	if _, err := DetectGroupFlights(context.Background(), now.Add(-24*time.Hour)); err != nil {
+		t.Fatalf("DetectGroupFlights returned error: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := announceCompletedGroupFlights(context.Background(), now); err != nil {
+			t.Fatalf("announceCompletedGroupFlights returned error: %v", err)
+		}
+	}
+	byType := make(map[string][]GroupFlightDetail)
+	for _, n := range receiveNotifications(ch) {
+		byType[n.Type] = append(byType[n.Type], n.Data.(GroupFlightDetail))
+	}
+	if len(byType[NotificationGroupFlightDetected]) != 2 {
+		t.Errorf("expected both group flights announced when detected, got %d", len(byType[NotificationGroupFlightDetected]))
+	}
+	completed := byType[NotificationGroupFlightCompleted]
+	if len(completed) != 1 {
+		t.Fatalf("expected one group flight completed notification, got %d", len(completed))
+	}
+	if completed[0].DepartureICAO != "KJFK" || len(completed[0].Pilots) != 6 {
+		t.Errorf("expected the full KJFK-KBOS roster, got %+v", completed[0])
+	}
+}
+
+func TestWeeklyDigestJob(t *testing.T) {
+	setupTestDB(t)
+	clearSentNotifications(t)
+	ch, unsubscribe := Subscribe(10)
+	defer unsubscribe()
+
+	for i := 0; i < 2; i++ {
+		if err := WeeklyDigestJob(context.Background()); err != nil {
+			t.Fatalf("WeeklyDigestJob returned error: %v", err)
+		}
+	}
+	got := receiveNotifications(ch)
+	if len(got) != 1 || got[0].Type != NotificationWeekClosed {
+		t.Fatalf("expected one week closed notification, got %+v", got)
+	}
+	week := getWeeklyDateRanges(1)[0]
+	if report := got[0].Data.(WeeklyReport); !report.StartDate.Equal(week[0]) {
+		t.Errorf("expected the digest for the week starting %v, got %v", week[0], report.StartDate)
+	}
+}
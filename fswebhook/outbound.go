@@ -0,0 +1,96 @@
+package fswebhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// retryPolicy controls how often an outbound delivery is attempted.
+type retryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration // wait before the first retry, doubled after each failure
+}
+
+// permanentError marks a failed delivery that retrying will not fix.
+type permanentError struct{ error }
+
+// retryableError is a failed delivery worth trying again, after RetryAfter if the receiver asked for a pause.
+type retryableError struct {
+	error
+	RetryAfter time.Duration
+}
+
+// maxBackoff is the longest wait between attempts, the one before the last. A receiver asking
+// for a longer pause gets this instead, so it cannot hold a delivery, or shutdown, for hours.
+func (p retryPolicy) maxBackoff() time.Duration {
+	return p.Backoff << max(p.MaxAttempts-2, 0)
+}
+
+// do calls attempt until it succeeds, fails permanently or runs out of attempts.
+func (p retryPolicy) do(ctx context.Context, attempt func(n int) error) error {
+	backoff := p.Backoff
+	for n := 1; ; n++ {
+		err := attempt(n)
+		if err == nil {
+			return nil
+		}
+		var permanent permanentError
+		if errors.As(err, &permanent) || n >= p.MaxAttempts {
+			return fmt.Errorf("attempt %d: %w", n, err)
+		}
+
+		wait := backoff
+		var retryable retryableError
+		if errors.As(err, &retryable) && retryable.RetryAfter > 0 {
+			wait = min(retryable.RetryAfter, p.maxBackoff())
+		}
+		backoff *= 2
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// postJSON makes a single POST of body to url and classifies the outcome: rate limiting and
+// server errors are retryable, any other non-2xx response is permanent. The response status
+// is returned whenever there was one.
+func postJSON(ctx context.Context, client *http.Client, url string, body []byte, header http.Header) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, permanentError{err}
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, retryableError{error: err}
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return resp.StatusCode, nil
+	case resp.StatusCode == http.StatusTooManyRequests:
+		var retryAfter time.Duration
+		if s, err := strconv.ParseFloat(resp.Header.Get("Retry-After"), 64); err == nil {
+			retryAfter = time.Duration(s * float64(time.Second))
+		}
+		return resp.StatusCode, retryableError{error: fmt.Errorf("rate limited"), RetryAfter: retryAfter}
+	case resp.StatusCode >= 500:
+		return resp.StatusCode, retryableError{error: fmt.Errorf("receiver returned %s", resp.Status)}
+	default:
+		return resp.StatusCode, permanentError{fmt.Errorf("receiver returned %s: %s", resp.Status, respBody)}
+	}
+}
@@ -0,0 +1,108 @@
+package fswebhook
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+)
+
+// Record scopes: a pilot's own best, or the best anyone in the airline has flown.
+const (
+	RecordPersonal = "personal"
+	RecordAirline  = "airline"
+)
+
+// RecordBroken struct to hold a flight that beat a previous best
+type RecordBroken struct {
+	Scope         string  `json:"scope"`
+	Metric        string  `json:"metric"` // landing_rate, distance or flight_hours
+	Value         float64 `json:"value"`
+	Previous      float64 `json:"previous"`
+	FlightID      int     `json:"flightid"`
+	PilotID       int     `json:"pilot_id"`
+	PilotName     string  `json:"pilot_name"`
+	AircraftName  string  `json:"aircraft_name"`
+	DepartureICAO string  `json:"departure_icao"`
+	ArrivalICAO   string  `json:"arrival_icao"`
+}
+
+// recordMetrics are the flight values records are kept for. Only touchdowns with a negative
+// landing rate count towards the softest landing; anything else is a data glitch.
+var recordMetrics = []struct {
+	Name string
+	Best string // aggregate over the flights table returning the previous best
+}{
+	{"landing_rate", `MAX(CASE WHEN landing_rate < 0 THEN landing_rate END)`},
+	{"distance", `MAX(distance)`},
+	{"flight_hours", `MAX("time") / 3600.0`},
+}
+
+// findBrokenRecords compares a stored flight against every other flight on record. A flight
+// setting an airline record is not also reported as a personal one, and a pilot's first
+// flight sets no personal records.
+func findBrokenRecords(ctx context.Context, flight FlightData, durationSeconds float64) ([]RecordBroken, error) {
+	values := map[string]float64{
+		"landing_rate": float64(flight.Arrival.LandingRate),
+		"distance":     float64(flight.Distance.NM),
+		"flight_hours": durationSeconds / 3600,
+	}
+
+	var broken []RecordBroken
+	for _, m := range recordMetrics {
+		value := values[m.Name]
+		if m.Name == "landing_rate" && value >= 0 {
+			continue
+		}
+		for _, scope := range []string{RecordAirline, RecordPersonal} {
+			var previous sql.NullFloat64
+			err := db.QueryRowContext(ctx, `
+				SELECT `+m.Best+` FROM flights
+				WHERE flightid != ? AND (? = 0 OR pilotid = ?)`,
+				flight.ID, scope == RecordPersonal, flight.User.ID).Scan(&previous)
+			if err != nil {
+				return nil, err
+			}
+			if !previous.Valid || value <= previous.Float64 {
+				continue
+			}
+			broken = append(broken, RecordBroken{
+				Scope:         scope,
+				Metric:        m.Name,
+				Value:         value,
+				Previous:      previous.Float64,
+				FlightID:      flight.ID,
+				PilotID:       flight.User.ID,
+				PilotName:     flight.User.Name,
+				AircraftName:  flight.Aircraft.Name,
+				DepartureICAO: flight.Departure.Airport.ICAO,
+				ArrivalICAO:   flight.Arrival.Airport.ICAO,
+			})
+			break
+		}
+	}
+	return broken, nil
+}
+
+// publishFlightNotifications announces a freshly stored flight and any records it broke. Each
+// record is announced once, even if the flight is delivered twice at the same time.
+func publishFlightNotifications(ctx context.Context, flight FlightData, durationSeconds float64) error {
+	publish(NotificationFlightStored, flight)
+
+	broken, err := findBrokenRecords(ctx, flight, durationSeconds)
+	if err != nil {
+		return err
+	}
+	for _, r := range broken {
+		first, err := markNotified(ctx, fmt.Sprintf("record:%d:%s:%s", r.FlightID, r.Scope, r.Metric))
+		if err != nil {
+			return err
+		}
+		if !first {
+			continue
+		}
+		slog.InfoContext(ctx, "Flight broke a record", "flight_id", r.FlightID, "scope", r.Scope, "metric", r.Metric, "value", r.Value, "previous", r.Previous)
+		publish(NotificationRecordBroken, r)
+	}
+	return nil
+}
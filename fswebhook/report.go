@@ -0,0 +1,159 @@
+package fswebhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Report output formats.
+const (
+	ReportText     = "text"
+	ReportMarkdown = "markdown"
+	ReportJSON     = "json"
+)
+
+// reportBoard is one of the leaderboards of a WeeklyReport.
+type reportBoard struct {
+	metric string
+	title  string
+	order  string // how the board is sorted, for the text heading
+	pilots func(WeeklyReport) []PilotStats
+	value  func(PilotStats) string
+}
+
+var reportBoards = []reportBoard{
+	{"landing", "Landing Rate", "Highest to Lowest",
+		func(r WeeklyReport) []PilotStats { return r.TopLandingRate },
+		func(p PilotStats) string { return fmt.Sprintf("%.0f fpm", p.AverageLandingRate) }},
+	{"distance", "Distance", "Highest to Lowest",
+		func(r WeeklyReport) []PilotStats { return r.TopDistance },
+		func(p PilotStats) string { return fmt.Sprintf("%d nm", p.TotalDistance) }},
+	{"flights", "Flights", "Highest to Lowest",
+		func(r WeeklyReport) []PilotStats { return r.TopFlights },
+		func(p PilotStats) string { return fmt.Sprintf("%d flights", p.TotalFlights) }},
+	{"hours", "Hours", "Highest to Lowest",
+		func(r WeeklyReport) []PilotStats { return r.TopHours },
+		func(p PilotStats) string { return fmt.Sprintf("%.1f h", p.TotalHoursFlown) }},
+	{"efficiency", "Fuel Efficiency", "Most to Least Efficient",
+		func(r WeeklyReport) []PilotStats { return r.TopEfficiency },
+		func(p PilotStats) string { return fmt.Sprintf("%.2f× type average fuel", p.FuelEfficiency) }},
+}
+
+// ReportOptions struct to hold how a report is rendered
+type ReportOptions struct {
+	Metric string // one board by metric name, or every board when empty or "all"
+	Format string // ReportText, ReportMarkdown or ReportJSON
+	Period string // adjective for the headings, such as "Weekly"; may be empty
+}
+
+// ReportBoard struct to hold a single leaderboard of a report, as rendered in JSON
+type ReportBoard struct {
+	StartDate time.Time    `json:"start_date"`
+	EndDate   time.Time    `json:"end_date"`
+	Metric    string       `json:"metric"`
+	Pilots    []PilotStats `json:"pilots"`
+}
+
+// reportMetricNames lists the metrics a report can be limited to.
+func reportMetricNames() string {
+	names := []string{"all"}
+	for _, b := range reportBoards {
+		names = append(names, b.metric)
+	}
+	return strings.Join(names, ", ")
+}
+
+// Validate checks the metric and format are known.
+func (o ReportOptions) Validate() error {
+	if _, err := o.boards(); err != nil {
+		return err
+	}
+	switch o.Format {
+	case ReportText, ReportMarkdown, ReportJSON:
+		return nil
+	}
+	return fmt.Errorf("unknown format %q, expected text, markdown or json", o.Format)
+}
+
+func (o ReportOptions) boards() ([]reportBoard, error) {
+	if o.Metric == "" || o.Metric == "all" {
+		return reportBoards, nil
+	}
+	for _, b := range reportBoards {
+		if b.metric == o.Metric {
+			return []reportBoard{b}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown metric %q, expected one of %s", o.Metric, reportMetricNames())
+}
+
+// WriteReport renders the leaderboards of report in the requested format. The text format
+// follows top10-weekly.py; Markdown is meant for pasting into Discord.
+func WriteReport(w io.Writer, report WeeklyReport, opts ReportOptions) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	boards, _ := opts.boards()
+
+	if opts.Format == ReportJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if len(boards) > 1 {
+			return enc.Encode(report)
+		}
+		return enc.Encode(ReportBoard{
+			StartDate: report.StartDate,
+			EndDate:   report.EndDate,
+			Metric:    boards[0].metric,
+			Pilots:    boards[0].pilots(report),
+		})
+	}
+
+	// Reports run up to, not including, their end date.
+	dates := fmt.Sprintf("%s to %s", report.StartDate.Format(time.DateOnly), report.EndDate.AddDate(0, 0, -1).Format(time.DateOnly))
+	var b strings.Builder
+	for i, board := range boards {
+		// Fields drops the gap left by an empty period.
+		title := strings.Join(strings.Fields(fmt.Sprintf("Top %d %s %s", LeaderboardSettings.Size, opts.Period, board.title)), " ")
+		pilots := board.pilots(report)
+
+		if opts.Format == ReportMarkdown {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(&b, "### %s\n*%s*\n", title, dates)
+			if len(pilots) == 0 {
+				b.WriteString("No qualifying pilots\n")
+			}
+			for rank, p := range pilots {
+				fmt.Fprintf(&b, "%d. **%s**: %s (%d flights, %d nm, %.1f h)\n", rank+1,
+					markdownEscaper.Replace(p.PilotName), board.value(p), p.TotalFlights, p.TotalDistance, p.TotalHoursFlown)
+			}
+			continue
+		}
+
+		fmt.Fprintf(&b, "\n--- %s Report (%s) ---\n%s\n\n", title, board.order, dates)
+		if len(pilots) == 0 {
+			b.WriteString("No qualifying pilots\n")
+		}
+		for _, p := range pilots {
+			fmt.Fprintf(&b, "Pilot: %s (%d)\n", p.PilotName, p.PilotID)
+			fmt.Fprintf(&b, "  Avg. Landing Rate: %.2f fpm\n", p.AverageLandingRate)
+			fmt.Fprintf(&b, "  Total Flights: %d\n", p.TotalFlights)
+			fmt.Fprintf(&b, "  Total Distance: %d nm\n", p.TotalDistance)
+			fmt.Fprintf(&b, "  Total Hours: %.2f hrs\n", p.TotalHoursFlown)
+			if board.metric == "efficiency" {
+				fmt.Fprintf(&b, "  Fuel Efficiency: %s\n", board.value(p))
+			}
+			b.WriteString("\n")
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// markdownEscaper keeps pilot names from being read as Discord formatting.
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `_`, `\_`, "`", "\\`", `~`, `\~`, `|`, `\|`)
@@ -0,0 +1,71 @@
+package fswebhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteReport(t *testing.T) {
+	start := time.Date(2025, 7, 14, 0, 0, 0, 0, time.UTC)
+	pilots := []PilotStats{
+		{PilotID: 7, PilotName: "Alice", AverageLandingRate: -85.456, TotalFlights: 12, TotalDistance: 4321, TotalHoursFlown: 15.5},
+		{PilotID: 8, PilotName: "bob_the*pilot", AverageLandingRate: -120, TotalFlights: 10, TotalDistance: 2000, TotalHoursFlown: 9.25},
+	}
+	report := WeeklyReport{StartDate: start, EndDate: start.AddDate(0, 0, 7), TopLandingRate: pilots, TopDistance: pilots}
+
+	render := func(opts ReportOptions) string {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := WriteReport(&buf, report, opts); err != nil {
+			t.Fatalf("WriteReport returned error: %v", err)
+		}
+		return buf.String()
+	}
+
+	text := render(ReportOptions{Metric: "landing", Format: ReportText, Period: "Weekly"})
+	want := `
+--- Top 10 Weekly Landing Rate Report (Highest to Lowest) ---
+2025-07-14 to 2025-07-20
+
+Pilot: Alice (7)
+  Avg. Landing Rate: -85.46 fpm
+  Total Flights: 12
+  Total Distance: 4321 nm
+  Total Hours: 15.50 hrs
+
+`
+	if !strings.HasPrefix(text, want) {
+		t.Errorf("unexpected text report:\n%s", text)
+	}
+
+	markdown := render(ReportOptions{Metric: "distance", Format: ReportMarkdown})
+	want = "### Top 10 Distance\n*2025-07-14 to 2025-07-20*\n" +
+		"1. **Alice**: 4321 nm (12 flights, 4321 nm, 15.5 h)\n" +
+		"2. **bob\\_the\\*pilot**: 2000 nm (10 flights, 2000 nm, 9.2 h)\n"
+	if markdown != want {
+		t.Errorf("unexpected markdown report:\n%s", markdown)
+	}
+
+	// Every board is rendered without a metric, including the empty ones.
+	all := render(ReportOptions{Format: ReportMarkdown})
+	if strings.Count(all, "### ") != len(reportBoards) || !strings.Contains(all, "### Top 10 Hours\n*2025-07-14 to 2025-07-20*\nNo qualifying pilots\n") {
+		t.Errorf("unexpected full markdown report:\n%s", all)
+	}
+
+	var board ReportBoard
+	if err := json.Unmarshal([]byte(render(ReportOptions{Metric: "landing", Format: ReportJSON})), &board); err != nil {
+		t.Fatalf("Failed to decode JSON report: %v", err)
+	}
+	if board.Metric != "landing" || len(board.Pilots) != 2 || !board.StartDate.Equal(start) {
+		t.Errorf("unexpected JSON report %+v", board)
+	}
+
+	for _, opts := range []ReportOptions{{Metric: "butter", Format: ReportText}, {Format: "html"}} {
+		if err := WriteReport(&bytes.Buffer{}, report, opts); err == nil {
+			t.Errorf("expected an error for %+v", opts)
+		}
+	}
+}
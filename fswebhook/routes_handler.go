@@ -0,0 +1,179 @@
+package fswebhook
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RouteLanding struct to hold the best landing flown into a route's destination
+type RouteLanding struct {
+	PilotName   string  `json:"pilot_name"`
+	LandingRate float64 `json:"landing_rate"`
+}
+
+// RouteStats struct to hold aggregated data for a city pair
+type RouteStats struct {
+	DepartureICAO       string        `json:"departure_icao"`
+	ArrivalICAO         string        `json:"arrival_icao"`
+	TotalFlights        int           `json:"total_flights"`
+	AverageBlockMinutes float64       `json:"average_block_minutes"`
+	AverageDistance     float64       `json:"average_distance_nm"`
+	BestLanding         *RouteLanding `json:"best_landing,omitempty"`
+	FirstFlown          time.Time     `json:"first_flown"`
+	LastFlown           time.Time     `json:"last_flown"`
+}
+
+// routeQuery describes which city pairs getRouteStats returns.
+type routeQuery struct {
+	Start, End time.Time
+	Airport    string    // optional, matches either end of the route
+	FirstSince time.Time // optional, only routes first flown at or after this time
+	Limit      int
+}
+
+// defaultListLimit is the number of rows list endpoints return when the request does not set a limit.
+const defaultListLimit = 50
+
+// getRouteStats aggregates flights per departure/arrival pair, most flown first.
+func getRouteStats(ctx context.Context, q routeQuery) ([]RouteStats, error) {
+	rows, err := db.QueryContext(ctx, `
+		WITH route_flights AS (
+			SELECT departure_icao,
+				arrival_icao,
+				pilotname,
+				landing_rate,
+				distance,
+				time,
+				arrival_time,
+				row_number() OVER (PARTITION BY departure_icao, arrival_icao ORDER BY landing_rate DESC) AS landing_rank
+			FROM flights
+			WHERE datetime(arrival_time) >= datetime(?) AND datetime(arrival_time) < datetime(?)
+				AND departure_icao != '' AND arrival_icao != ''
+				AND (? = '' OR departure_icao = ? OR arrival_icao = ?)
+		)
+		SELECT departure_icao,
+			arrival_icao,
+			COUNT(*) AS total_flights,
+			AVG(time) / 60.0,
+			AVG(distance),
+			MAX(CASE WHEN landing_rank = 1 THEN pilotname END),
+			MAX(CASE WHEN landing_rank = 1 THEN landing_rate END),
+			MIN(arrival_time) AS first_flown,
+			MAX(arrival_time)
+		FROM route_flights
+		GROUP BY departure_icao, arrival_icao
+		HAVING datetime(first_flown) >= datetime(?)
+		ORDER BY total_flights DESC, first_flown DESC
+		LIMIT ?`,
+		sqlTime(q.Start), sqlTime(q.End), q.Airport, q.Airport, q.Airport, sqlTime(q.FirstSince), q.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []RouteStats
+	for rows.Next() {
+		var (
+			rs                    RouteStats
+			bestPilot             sql.NullString
+			bestLanding           sql.NullFloat64
+			firstFlown, lastFlown string
+		)
+		if err := rows.Scan(&rs.DepartureICAO, &rs.ArrivalICAO, &rs.TotalFlights, &rs.AverageBlockMinutes,
+			&rs.AverageDistance, &bestPilot, &bestLanding, &firstFlown, &lastFlown); err != nil {
+			slog.Error("Error scanning route stats", "err", err)
+			return nil, err
+		}
+		if bestPilot.Valid && bestLanding.Valid {
+			rs.BestLanding = &RouteLanding{PilotName: bestPilot.String, LandingRate: bestLanding.Float64}
+		}
+		if rs.FirstFlown, err = parseFlightTime(firstFlown); err != nil {
+			slog.Warn("Error parsing first flown time", "departure", rs.DepartureICAO, "arrival", rs.ArrivalICAO, "err", err)
+		}
+		if rs.LastFlown, err = parseFlightTime(lastFlown); err != nil {
+			slog.Warn("Error parsing last flown time", "departure", rs.DepartureICAO, "arrival", rs.ArrivalICAO, "err", err)
+		}
+		stats = append(stats, rs)
+	}
+	return stats, rows.Err()
+}
+
+// limitFromRequest reads the "limit" query parameter, falling back to def when it is absent.
+func limitFromRequest(r *http.Request, def int) (int, bool) {
+	s := r.URL.Query().Get("limit")
+	if s == "" {
+		return def, true
+	}
+	limit, err := strconv.Atoi(s)
+	if err != nil || limit < 1 || limit > 1000 {
+		return 0, false
+	}
+	return limit, true
+}
+
+// RoutesHandler returns the most flown city pairs for the requested period.
+// The optional "airport" parameter limits the list to routes touching that airport.
+func RoutesHandler(w http.ResponseWriter, r *http.Request) {
+	start, end, err := periodFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, ok := limitFromRequest(r, defaultListLimit)
+	if !ok {
+		http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+		return
+	}
+
+	stats, err := getRouteStats(r.Context(), routeQuery{
+		Start:   start,
+		End:     end,
+		Airport: strings.ToUpper(r.URL.Query().Get("airport")),
+		Limit:   limit,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if stats == nil {
+		stats = []RouteStats{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// NewRoutesHandler returns the routes flown for the first time during the current week.
+func NewRoutesHandler(w http.ResponseWriter, r *http.Request) {
+	limit, ok := limitFromRequest(r, defaultListLimit)
+	if !ok {
+		http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+		return
+	}
+
+	// The current week started where the most recently completed one ended.
+	weekStart := getWeeklyDateRanges(1)[0][1]
+
+	stats, err := getRouteStats(r.Context(), routeQuery{
+		Start:      time.Time{},
+		End:        time.Now().UTC().AddDate(0, 0, 1),
+		FirstSince: weekStart,
+		Limit:      limit,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if stats == nil {
+		stats = []RouteStats{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
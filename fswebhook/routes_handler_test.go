@@ -0,0 +1,76 @@
+package fswebhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRoutesHandlers(t *testing.T) {
+	setupTestDB(t)
+
+	now := time.Now().UTC()
+	old := now.AddDate(0, 0, -30)
+	insertTestFlights(t,
+		testFlight{FlightID: 1, PilotID: 1, PilotName: "Alice", LandingRate: -120, Distance: 180,
+			Duration: time.Hour, DepartureICAO: "KJFK", ArrivalICAO: "KBOS", Arrival: old},
+		testFlight{FlightID: 2, PilotID: 2, PilotName: "Bob", LandingRate: -80, Distance: 190,
+			Duration: 2 * time.Hour, DepartureICAO: "KJFK", ArrivalICAO: "KBOS", Arrival: now.Add(-time.Hour)},
+		testFlight{FlightID: 3, PilotID: 2, PilotName: "Bob", LandingRate: -300, Distance: 2100,
+			Duration: 5 * time.Hour, DepartureICAO: "KBOS", ArrivalICAO: "KSFO", Arrival: now.Add(-time.Minute)},
+	)
+
+	rr := httptest.NewRecorder()
+	RoutesHandler(rr, httptest.NewRequest(http.MethodGet, "/routes", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var routes []RouteStats
+	if err := json.NewDecoder(rr.Body).Decode(&routes); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(routes) != 2 {
+		t.Fatalf("expected 2 routes, got %d", len(routes))
+	}
+	jfkBos := routes[0]
+	if jfkBos.DepartureICAO != "KJFK" || jfkBos.ArrivalICAO != "KBOS" || jfkBos.TotalFlights != 2 {
+		t.Errorf("expected KJFK-KBOS with 2 flights first, got %+v", jfkBos)
+	}
+	if jfkBos.AverageBlockMinutes != 90 {
+		t.Errorf("expected 90 minute average block time, got %f", jfkBos.AverageBlockMinutes)
+	}
+	if jfkBos.AverageDistance != 185 {
+		t.Errorf("expected 185nm average distance, got %f", jfkBos.AverageDistance)
+	}
+	if jfkBos.BestLanding == nil || jfkBos.BestLanding.PilotName != "Bob" || jfkBos.BestLanding.LandingRate != -80 {
+		t.Errorf("expected Bob's -80 fpm as best landing, got %+v", jfkBos.BestLanding)
+	}
+	if !jfkBos.FirstFlown.Equal(old.Truncate(time.Second)) {
+		t.Errorf("expected first flown %v, got %v", old, jfkBos.FirstFlown)
+	}
+
+	rr = httptest.NewRecorder()
+	RoutesHandler(rr, httptest.NewRequest(http.MethodGet, "/routes?limit=0", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid limit, got %v", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	NewRoutesHandler(rr, httptest.NewRequest(http.MethodGet, "/routes/new", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	routes = nil
+	if err := json.NewDecoder(rr.Body).Decode(&routes); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	// KJFK-KBOS was first flown a month ago, so it must not show up as new.
+	for _, route := range routes {
+		if route.DepartureICAO == "KJFK" {
+			t.Errorf("expected KJFK-KBOS not to be a new route, got %+v", route)
+		}
+	}
+}
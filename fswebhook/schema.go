@@ -0,0 +1,186 @@
+package fswebhook
+
+import (
+	"fmt"
+)
+
+// migrations holds the schema changes applied by InitDB, in order. The database's
+// user_version records how many have already run, so only ever append to this list.
+var migrations = []string{
+	// 1: the flights table, as created by init_db.py.
+	`CREATE TABLE IF NOT EXISTS flights (
+		flightid INTEGER PRIMARY KEY,
+		pilotid INTEGER,
+		pilotname TEXT,
+		landing_rate REAL,
+		distance INTEGER,
+		"time" INTEGER,
+		aircraft_icao TEXT,
+		aircraft_name TEXT,
+		departure_icao TEXT,
+		arrival_icao TEXT,
+		fuel_used REAL,
+		departure_time DATETIME,
+		arrival_time DATETIME
+	)`,
+
+	// 2: badges awarded by the achievements engine.
+	`CREATE TABLE IF NOT EXISTS pilot_achievements (
+		pilotid INTEGER NOT NULL,
+		achievement_id TEXT NOT NULL,
+		flightid INTEGER,
+		awarded_at DATETIME NOT NULL,
+		PRIMARY KEY (pilotid, achievement_id)
+	)`,
+
+	// 3: pilots whose flights are used to find group flights.
+	`CREATE TABLE IF NOT EXISTS group_flight_leaders (
+		pilotid INTEGER PRIMARY KEY,
+		added_at DATETIME NOT NULL
+	)`,
+
+	// 4: group flights found by clustering arrivals, and the flights that make them up.
+	`CREATE TABLE IF NOT EXISTS group_flights (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		departure_icao TEXT NOT NULL,
+		arrival_icao TEXT NOT NULL,
+		first_arrival DATETIME NOT NULL,
+		last_arrival DATETIME NOT NULL,
+		total_pilots INTEGER NOT NULL,
+		leader_pilotid INTEGER,
+		detected_at DATETIME NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS group_flight_members (
+		group_flight_id INTEGER NOT NULL REFERENCES group_flights (id) ON DELETE CASCADE,
+		flightid INTEGER NOT NULL,
+		PRIMARY KEY (group_flight_id, flightid)
+	);
+	CREATE INDEX IF NOT EXISTS idx_group_flight_members_flightid ON group_flight_members (flightid);`,
+
+	// 5: scheduled group flight events, RSVPs and the flights that attended them.
+	`CREATE TABLE IF NOT EXISTS events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		title TEXT NOT NULL,
+		departure_icao TEXT NOT NULL,
+		arrival_icao TEXT NOT NULL,
+		planned_departure DATETIME NOT NULL,
+		host_pilotid INTEGER,
+		window_minutes INTEGER NOT NULL,
+		created_at DATETIME NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS event_rsvps (
+		event_id INTEGER NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+		pilotid INTEGER NOT NULL,
+		pilotname TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		PRIMARY KEY (event_id, pilotid)
+	);
+	CREATE TABLE IF NOT EXISTS event_attendance (
+		event_id INTEGER NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+		flightid INTEGER NOT NULL,
+		pilotid INTEGER NOT NULL,
+		PRIMARY KEY (event_id, flightid)
+	);`,
+
+	// 6: notifications periodic jobs have already sent. Group flights detected before
+	// notifications existed are marked as sent so they are not all announced at once.
+	`CREATE TABLE IF NOT EXISTS sent_notifications (
+		key TEXT PRIMARY KEY,
+		sent_at DATETIME NOT NULL
+	);
+	INSERT OR IGNORE INTO sent_notifications (key, sent_at)
+		SELECT 'group_flight:' || id, detected_at FROM group_flights;`,
+
+	// 7: outbound webhook subscribers and the log of deliveries made to them.
+	`CREATE TABLE IF NOT EXISTS webhook_subscribers (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		url TEXT NOT NULL,
+		events TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		enabled INTEGER NOT NULL DEFAULT 1,
+		consecutive_failures INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		subscriber_id INTEGER NOT NULL,
+		notification_id INTEGER NOT NULL,
+		event_type TEXT NOT NULL,
+		attempt INTEGER NOT NULL,
+		status_code INTEGER,
+		error TEXT,
+		delivered_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_subscriber ON webhook_deliveries (subscriber_id, id);`,
+
+	// 8: flights that failed validation, with the delivery or import they came from.
+	`CREATE TABLE IF NOT EXISTS ingest_rejections (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		received_at DATETIME NOT NULL,
+		source TEXT NOT NULL,
+		request_id TEXT NOT NULL DEFAULT '',
+		flightid INTEGER NOT NULL,
+		pilotid INTEGER NOT NULL,
+		reason TEXT NOT NULL,
+		field TEXT NOT NULL DEFAULT '',
+		detail TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_ingest_rejections_reason ON ingest_rejections (reason, id);
+	CREATE INDEX IF NOT EXISTS idx_ingest_rejections_pilot ON ingest_rejections (pilotid, id);`,
+
+	// 9: the last week that closed before the weekly digest existed is marked as announced,
+	// so the first deploy does not post a week that may be long over. As in
+	// getWeeklyDateRanges, that week ends on the most recent Saturday.
+	`INSERT OR IGNORE INTO sent_notifications (key, sent_at)
+		VALUES ('week:' || date('now', '-6 days', 'weekday 6', '-7 days'), strftime('%Y-%m-%dT%H:%M:%SZ', 'now'));`,
+
+	// 10: a flight is kept once per source and reason, however often it is rejected; the sync
+	// refetches rejected flights every time it runs.
+	`DELETE FROM ingest_rejections WHERE id NOT IN (
+		SELECT MAX(id) FROM ingest_rejections GROUP BY source, flightid, reason);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_ingest_rejections_flight ON ingest_rejections (source, flightid, reason);`,
+
+	// 11: KipOnTheGround led every group flight before leaders were configured, so keeps leading
+	// them. A list that was already in use counts as seeded, so the configured leaders are not
+	// added to it again.
+	`INSERT OR IGNORE INTO sent_notifications (key, sent_at)
+		SELECT 'seed:group_flight_leaders', strftime('%Y-%m-%dT%H:%M:%SZ', 'now')
+		WHERE EXISTS (SELECT 1 FROM group_flight_leaders);
+	INSERT OR IGNORE INTO group_flight_leaders (pilotid, added_at)
+		SELECT DISTINCT pilotid, strftime('%Y-%m-%dT%H:%M:%SZ', 'now') FROM flights WHERE pilotname = 'KipOnTheGround';`,
+}
+
+// schemaVersion returns the number of migrations applied to the database.
+func schemaVersion() (int, error) {
+	var version int
+	err := db.QueryRow(`PRAGMA user_version`).Scan(&version)
+	return version, err
+}
+
+// migrate applies any migrations the database has not seen yet.
+func migrate() error {
+	version, err := schemaVersion()
+	if err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("applying migration %d: %w", i+1, err)
+		}
+		// PRAGMA does not take bound parameters.
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("recording migration %d: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
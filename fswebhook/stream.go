@@ -0,0 +1,206 @@
+package fswebhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// streamHistorySize is how many notifications are kept for clients resuming with Last-Event-ID.
+const streamHistorySize = 256
+
+// streamResetEvent is sent instead of the missed notifications to a client resuming from
+// before the history kept in memory, such as one that was connected before a restart. It
+// should reload whatever it shows.
+const streamResetEvent = "reset"
+
+// streamClientBuffer is how far a live feed client may fall behind before it is disconnected.
+// Its EventSource reconnects and catches up from the history.
+const streamClientBuffer = 64
+
+// StreamBroker fans notifications out to live feed clients over Server-Sent Events.
+type StreamBroker struct {
+	Heartbeat time.Duration // interval of the comments that keep idle connections open
+
+	mu      sync.Mutex
+	clients map[chan Notification]bool
+	history []Notification
+}
+
+// NewStreamBroker returns a broker with no clients yet.
+func NewStreamBroker() *StreamBroker {
+	return &StreamBroker{
+		Heartbeat: 15 * time.Second,
+		clients:   make(map[chan Notification]bool),
+	}
+}
+
+// Run forwards every notification received to the connected clients until the channel is
+// closed or ctx is cancelled, then disconnects them.
+func (b *StreamBroker) Run(ctx context.Context, notifications <-chan Notification) {
+	defer b.closeAll()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n, ok := <-notifications:
+			if !ok {
+				return
+			}
+			b.broadcast(n)
+		}
+	}
+}
+
+func (b *StreamBroker) broadcast(n Notification) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.history = append(b.history, n)
+	if len(b.history) > streamHistorySize {
+		b.history = b.history[len(b.history)-streamHistorySize:]
+	}
+	for ch := range b.clients {
+		select {
+		case ch <- n:
+		default:
+			delete(b.clients, ch)
+			close(ch)
+		}
+	}
+}
+
+func (b *StreamBroker) closeAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.clients {
+		delete(b.clients, ch)
+		close(ch)
+	}
+}
+
+// subscribe registers a client and returns the notifications it missed after lastID. If the
+// history does not reach back to lastID, it reports the client as stale with the latest ID
+// instead, or 0 if there is none yet.
+func (b *StreamBroker) subscribe(lastID int64) (ch chan Notification, missed []Notification, stale bool, latest int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch = make(chan Notification, streamClientBuffer)
+	b.clients[ch] = true
+
+	if lastID <= 0 {
+		return ch, nil, false, 0
+	}
+	if len(b.history) == 0 {
+		return ch, nil, true, 0
+	}
+	if first, last := b.history[0].ID, b.history[len(b.history)-1].ID; lastID < first-1 || lastID > last {
+		return ch, nil, true, last
+	}
+	for _, n := range b.history {
+		if n.ID > lastID {
+			missed = append(missed, n)
+		}
+	}
+	return ch, missed, false, 0
+}
+
+func (b *StreamBroker) unsubscribe(ch chan Notification) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.clients[ch] {
+		delete(b.clients, ch)
+		close(ch)
+	}
+}
+
+// ServeHTTP streams notifications to the client as Server-Sent Events, each event named after
+// the notification type with its data as JSON. Clients resume with the Last-Event-ID header, or
+// the lastEventId query parameter where they cannot set headers. Only the last
+// streamHistorySize notifications are kept, in memory, so a client resuming from further back
+// or from before a restart gets a "reset" event instead. The optional "types" parameter takes
+// a comma-separated list of notification types to receive.
+func (b *StreamBroker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	var types []string
+	if s := r.URL.Query().Get("types"); s != "" {
+		types = strings.Split(s, ",")
+		for _, t := range types {
+			if !slices.Contains(notificationTypes, t) {
+				http.Error(w, "Unknown type "+strconv.Quote(t)+", expected one of "+strings.Join(notificationTypes, ", "), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	lastID, _ := strconv.ParseInt(lastEventID, 10, 64)
+
+	ch, missed, stale, latest := b.subscribe(lastID)
+	defer b.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	fmt.Fprint(w, "retry: 5000\n\n")
+	if stale {
+		// Moving the client's last event ID on keeps it from being reset again on reconnecting.
+		if latest != 0 {
+			fmt.Fprintf(w, "id: %d\n", latest)
+		}
+		fmt.Fprintf(w, "event: %s\ndata: {}\n\n", streamResetEvent)
+	}
+
+	send := func(n Notification) error {
+		if types != nil && !slices.Contains(types, n.Type) {
+			return nil
+		}
+		data, err := json.Marshal(n.Data)
+		if err != nil {
+			slog.Error("Error encoding notification", "type", n.Type, "notification_id", n.ID, "err", err)
+			return nil
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", n.ID, n.Type, data)
+		return err
+	}
+	for _, n := range missed {
+		if err := send(n); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(b.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case n, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := send(n); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,140 @@
+package fswebhook
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// streamEvent is one Server-Sent Event read from the live feed.
+type streamEvent struct {
+	id, event, data string
+}
+
+// readStreamEvent reads the next event, skipping comments and the retry field.
+func readStreamEvent(t *testing.T, r *bufio.Reader) streamEvent {
+	t.Helper()
+	var e streamEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if e.id != "" || e.event != "" {
+				return e
+			}
+		case strings.HasPrefix(line, ":"):
+			e.event = "heartbeat"
+		case strings.HasPrefix(line, "id: "):
+			e.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			e.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			e.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+// connectStream opens the live feed and waits until the broker has registered the client.
+func connectStream(t *testing.T, b *StreamBroker, url, lastEventID string) *bufio.Reader {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	b.mu.Lock()
+	clients := len(b.clients)
+	b.mu.Unlock()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	for deadline := time.Now().Add(time.Second); ; {
+		b.mu.Lock()
+		registered := len(b.clients) > clients
+		b.mu.Unlock()
+		if registered {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("client was never registered")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+func TestStreamBroker(t *testing.T) {
+	b := NewStreamBroker()
+	b.Heartbeat = 50 * time.Millisecond
+	notifications := make(chan Notification)
+	server := httptest.NewServer(b)
+	defer server.Close()
+	// Stopping the broker disconnects the clients, which lets the server close.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Run(ctx, notifications)
+
+	first, second := connectStream(t, b, server.URL, ""), connectStream(t, b, server.URL, "")
+	notifications <- Notification{ID: 100, Type: NotificationFlightStored, Data: FlightData{ID: 7}}
+	notifications <- Notification{ID: 101, Type: NotificationGroupFlightCompleted, Data: GroupFlightDetail{}}
+
+	for _, r := range []*bufio.Reader{first, second} {
+		e := readStreamEvent(t, r)
+		if e.id != "100" || e.event != NotificationFlightStored || !strings.Contains(e.data, `"id":7`) {
+			t.Errorf("unexpected first event %+v", e)
+		}
+		if e := readStreamEvent(t, r); e.id != "101" || e.event != NotificationGroupFlightCompleted {
+			t.Errorf("unexpected second event %+v", e)
+		}
+	}
+	if e := readStreamEvent(t, first); e.event != "heartbeat" {
+		t.Errorf("expected a heartbeat on an idle stream, got %+v", e)
+	}
+
+	// A reconnecting client only receives what it missed.
+	resumed := connectStream(t, b, server.URL, "100")
+	if e := readStreamEvent(t, resumed); e.id != "101" {
+		t.Errorf("expected to resume from event 101, got %+v", e)
+	}
+
+	// A client resuming from before the history, or from a previous run, is told to reset.
+	for _, lastEventID := range []string{"50", "500"} {
+		stale := connectStream(t, b, server.URL, lastEventID)
+		if e := readStreamEvent(t, stale); e.event != streamResetEvent || e.id != "101" {
+			t.Errorf("%s: expected a reset to event 101, got %+v", lastEventID, e)
+		}
+	}
+
+	// Clients filtering by type skip the rest.
+	filtered := connectStream(t, b, server.URL+"?types="+NotificationGroupFlightCompleted, "")
+	notifications <- Notification{ID: 102, Type: NotificationFlightStored, Data: FlightData{ID: 8}}
+	notifications <- Notification{ID: 103, Type: NotificationGroupFlightCompleted, Data: GroupFlightDetail{}}
+	e := readStreamEvent(t, filtered)
+	for e.event == "heartbeat" {
+		e = readStreamEvent(t, filtered)
+	}
+	if e.id != "103" {
+		t.Errorf("expected only group flights, got %+v", e)
+	}
+}
+
+func TestStreamBrokerRejectsUnknownTypes(t *testing.T) {
+	rr := httptest.NewRecorder()
+	NewStreamBroker().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/events/stream?types=flight.landed", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", rr.Code)
+	}
+}
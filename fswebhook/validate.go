@@ -0,0 +1,269 @@
+package fswebhook
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RejectionReason says why a flight was not stored.
+type RejectionReason string
+
+// Reasons a flight is rejected, checked in this order.
+const (
+	RejectMissingField           RejectionReason = "missing_field"
+	RejectInvalidTime            RejectionReason = "invalid_time"
+	RejectArrivalBeforeDeparture RejectionReason = "arrival_before_departure"
+	RejectTooShort               RejectionReason = "too_short"
+	RejectImplausibleSpeed       RejectionReason = "implausible_speed"
+	RejectDistanceMismatch       RejectionReason = "distance_mismatch"
+)
+
+// ingestOutcome is the webhook delivery outcome counted for each reason. Reasons the webhook
+// checked before keep their metric labels; the rest are labelled with the reason itself.
+func (r RejectionReason) ingestOutcome() string {
+	switch r {
+	case RejectMissingField:
+		return ingestMissingFields
+	case RejectInvalidTime:
+		return ingestBadTime
+	case RejectTooShort:
+		return ingestShortFlight
+	}
+	return string(r)
+}
+
+// Rejection struct to hold why a flight failed validation
+type Rejection struct {
+	Reason RejectionReason `json:"reason"`
+	Field  string          `json:"field,omitempty"` // the offending field, in the webhook's naming
+	Detail string          `json:"detail"`
+}
+
+func (r *Rejection) Error() string {
+	return fmt.Sprintf("%s: %s", r.Reason, r.Detail)
+}
+
+// minDetourBaseNM is the great-circle distance below which the detour allowed by
+// IngestOptions.MaxDistanceRatio stops shrinking, leaving room for circuits and local flights
+// that end where they began.
+const minDetourBaseNM = 50
+
+// earthRadiusNM is the mean radius of the Earth in nautical miles.
+const earthRadiusNM = 3440.065
+
+// greatCircleNM returns the great-circle distance between two points in nautical miles.
+func greatCircleNM(from, to Coordinates) float64 {
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := rad(to.Lat - from.Lat)
+	dLng := rad(to.Lng - from.Lng)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(rad(from.Lat))*math.Cos(rad(to.Lat))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusNM * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// ValidateFlight checks a flight against the ingest thresholds in opts and returns why it
+// should be rejected, or nil if it can be stored. Flights from the FSHub API carry no airport
+// coordinates, so the distance check only applies when both are known.
+func ValidateFlight(flight FlightData, opts IngestOptions) *Rejection {
+	missing := func(field string) *Rejection {
+		return &Rejection{Reason: RejectMissingField, Field: field, Detail: field + " is missing"}
+	}
+	switch {
+	case flight.ID == 0:
+		return missing("id")
+	case flight.User.ID == 0:
+		return missing("user.id")
+	case flight.User.Name == "":
+		return missing("user.name")
+	case flight.Aircraft.ICAO == "":
+		return missing("aircraft.icao")
+	case flight.Departure.Airport.ICAO == "":
+		return missing("departure.airport.icao")
+	case flight.Arrival.Airport.ICAO == "":
+		return missing("arrival.airport.icao")
+	case flight.Departure.DateTime == "":
+		return missing("departure.datetime")
+	case flight.Arrival.DateTime == "":
+		return missing("arrival.datetime")
+	}
+
+	departure, err := parseFlightTime(flight.Departure.DateTime)
+	if err != nil {
+		return &Rejection{Reason: RejectInvalidTime, Field: "departure.datetime",
+			Detail: fmt.Sprintf("cannot parse departure time %q", flight.Departure.DateTime)}
+	}
+	arrival, err := parseFlightTime(flight.Arrival.DateTime)
+	if err != nil {
+		return &Rejection{Reason: RejectInvalidTime, Field: "arrival.datetime",
+			Detail: fmt.Sprintf("cannot parse arrival time %q", flight.Arrival.DateTime)}
+	}
+	duration := arrival.Sub(departure)
+	if duration < 0 {
+		return &Rejection{Reason: RejectArrivalBeforeDeparture, Field: "arrival.datetime",
+			Detail: fmt.Sprintf("arrival %s is before departure %s", flight.Arrival.DateTime, flight.Departure.DateTime)}
+	}
+	if duration < opts.MinFlightDuration {
+		return &Rejection{Reason: RejectTooShort, Field: "arrival.datetime",
+			Detail: fmt.Sprintf("flight took %v, less than the minimum %v", duration, opts.MinFlightDuration)}
+	}
+
+	distance := float64(flight.Distance.NM)
+	if hours := duration.Hours(); opts.MaxGroundSpeed > 0 && hours > 0 {
+		if speed := distance / hours; speed > opts.MaxGroundSpeed {
+			return &Rejection{Reason: RejectImplausibleSpeed, Field: "distance.nm",
+				Detail: fmt.Sprintf("average ground speed %.0f kt is above %.0f kt", speed, opts.MaxGroundSpeed)}
+		}
+	}
+
+	from, to := flight.Departure.Airport.Locale, flight.Arrival.Airport.Locale
+	if from == nil || from.GPS == nil || to == nil || to.GPS == nil {
+		return nil
+	}
+	direct := greatCircleNM(*from.GPS, *to.GPS)
+	if opts.MinDistanceRatio > 0 && distance < direct*opts.MinDistanceRatio {
+		return &Rejection{Reason: RejectDistanceMismatch, Field: "distance.nm",
+			Detail: fmt.Sprintf("flew %.0f nm between airports %.0f nm apart", distance, direct)}
+	}
+	if opts.MaxDistanceRatio > 0 && distance > math.Max(direct, minDetourBaseNM)*opts.MaxDistanceRatio {
+		return &Rejection{Reason: RejectDistanceMismatch, Field: "distance.nm",
+			Detail: fmt.Sprintf("flew %.0f nm between airports %.0f nm apart, more than %g times as far",
+				distance, direct, opts.MaxDistanceRatio)}
+	}
+	return nil
+}
+
+// Sources of rejected flights.
+const (
+	sourceWebhook = "webhook"
+	sourceReplay  = "replay"
+	sourceImport  = "import"
+	sourceSync    = "sync"
+)
+
+// dbExecer is satisfied by both *sql.DB and *sql.Tx.
+type dbExecer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// recordRejection logs a rejected flight and keeps it in ingest_rejections, along with the
+// request ID of the delivery that carried it. A flight rejected again from the same source for
+// the same reason, as the sync does each time it refetches it, updates the rejection on record.
+func recordRejection(ctx context.Context, exec dbExecer, source string, flight FlightData, rejection *Rejection) {
+	slog.WarnContext(ctx, "Rejected flight", "flight_id", flight.ID, "pilot_id", flight.User.ID, "source", source,
+		"reason", rejection.Reason, "field", rejection.Field, "detail", rejection.Detail)
+	_, err := exec.ExecContext(context.WithoutCancel(ctx), `
+		INSERT INTO ingest_rejections (received_at, source, request_id, flightid, pilotid, reason, field, detail)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (source, flightid, reason) DO UPDATE SET
+			received_at = excluded.received_at, request_id = excluded.request_id,
+			pilotid = excluded.pilotid, field = excluded.field, detail = excluded.detail`,
+		sqlTime(time.Now()), source, RequestID(ctx), flight.ID, flight.User.ID,
+		rejection.Reason, rejection.Field, rejection.Detail)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error recording rejected flight", "flight_id", flight.ID, "err", err)
+	}
+}
+
+// IngestRejection struct to hold a recorded rejection
+type IngestRejection struct {
+	ID         int64           `json:"id"`
+	ReceivedAt time.Time       `json:"received_at"`
+	Source     string          `json:"source"`
+	RequestID  string          `json:"request_id,omitempty"`
+	FlightID   int             `json:"flight_id"`
+	PilotID    int             `json:"pilot_id"`
+	Reason     RejectionReason `json:"reason"`
+	Field      string          `json:"field,omitempty"`
+	Detail     string          `json:"detail"`
+}
+
+// rejectionQuery struct to hold the filters for listing rejections
+type rejectionQuery struct {
+	Reason   string
+	PilotID  int
+	FlightID int
+	Limit    int
+}
+
+// getIngestRejections returns the most recent rejections matching q.
+func getIngestRejections(ctx context.Context, q rejectionQuery) ([]IngestRejection, error) {
+	query := `
+		SELECT id, received_at, source, request_id, flightid, pilotid, reason, field, detail
+		FROM ingest_rejections
+		WHERE 1 = 1`
+	var args []any
+	if q.Reason != "" {
+		query += ` AND reason = ?`
+		args = append(args, q.Reason)
+	}
+	if q.PilotID != 0 {
+		query += ` AND pilotid = ?`
+		args = append(args, q.PilotID)
+	}
+	if q.FlightID != 0 {
+		query += ` AND flightid = ?`
+		args = append(args, q.FlightID)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, q.Limit)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rejections := []IngestRejection{}
+	for rows.Next() {
+		var r IngestRejection
+		var receivedAt string
+		if err := rows.Scan(&r.ID, &receivedAt, &r.Source, &r.RequestID, &r.FlightID, &r.PilotID,
+			&r.Reason, &r.Field, &r.Detail); err != nil {
+			return nil, err
+		}
+		if r.ReceivedAt, err = parseFlightTime(receivedAt); err != nil {
+			return nil, err
+		}
+		rejections = append(rejections, r)
+	}
+	return rejections, rows.Err()
+}
+
+// IngestRejectionsAdminHandler lists the most recent rejected flights, newest first. It can be
+// filtered by "reason", "pilot" and "flight", and takes a "limit".
+func IngestRejectionsAdminHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	limit, ok := limitFromRequest(r, defaultListLimit)
+	if !ok {
+		http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+		return
+	}
+	q := rejectionQuery{Reason: r.URL.Query().Get("reason"), Limit: limit}
+	for param, id := range map[string]*int{"pilot": &q.PilotID, "flight": &q.FlightID} {
+		if s := r.URL.Query().Get(param); s != "" {
+			var err error
+			if *id, err = strconv.Atoi(s); err != nil || *id < 1 {
+				http.Error(w, fmt.Sprintf("invalid %s ID %q", param, s), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	rejections, err := getIngestRejections(r.Context(), q)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error querying rejected flights", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rejections)
+}
@@ -0,0 +1,191 @@
+package fswebhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// exampleFlight returns the flight from the example flight completed event.
+func exampleFlight(t *testing.T) FlightData {
+	t.Helper()
+	jsonData, err := os.ReadFile(filepath.Join("testdata", "flight.completed.example.json"))
+	if err != nil {
+		t.Fatalf("Failed to read example JSON file: %v", err)
+	}
+	var event FlightCompletedEvent
+	if err := json.Unmarshal(jsonData, &event); err != nil {
+		t.Fatalf("Failed to unmarshal example JSON: %v", err)
+	}
+	return event.Data
+}
+
+func TestGreatCircleNM(t *testing.T) {
+	// KMYR to KATL, as listed in the example event.
+	got := greatCircleNM(Coordinates{Lat: 33.679749, Lng: -78.928337}, Coordinates{Lat: 33.640446, Lng: -84.426941})
+	if math.Abs(got-274.4) > 1 {
+		t.Errorf("expected about 274 nm, got %.1f", got)
+	}
+}
+
+func TestValidateFlight(t *testing.T) {
+	opts := IngestOptions{MinFlightDuration: 5 * time.Minute, MaxGroundSpeed: 1200, MinDistanceRatio: 0.9, MaxDistanceRatio: 5}
+	tests := []struct {
+		name   string
+		modify func(f *FlightData)
+		opts   func(o *IngestOptions)
+		reason RejectionReason
+		field  string
+	}{
+		{name: "valid", modify: func(f *FlightData) {}},
+		{name: "no pilot", modify: func(f *FlightData) { f.User.ID = 0 }, reason: RejectMissingField, field: "user.id"},
+		{name: "no pilot name", modify: func(f *FlightData) { f.User.Name = "" }, reason: RejectMissingField, field: "user.name"},
+		{name: "no aircraft", modify: func(f *FlightData) { f.Aircraft.ICAO = "" }, reason: RejectMissingField, field: "aircraft.icao"},
+		{name: "no arrival airport", modify: func(f *FlightData) { f.Arrival.Airport.ICAO = "" }, reason: RejectMissingField, field: "arrival.airport.icao"},
+		{name: "no departure time", modify: func(f *FlightData) { f.Departure.DateTime = "" }, reason: RejectMissingField, field: "departure.datetime"},
+		{name: "unreadable time", modify: func(f *FlightData) { f.Arrival.DateTime = "invalid-time" }, reason: RejectInvalidTime, field: "arrival.datetime"},
+		{
+			name:   "arrival before departure",
+			modify: func(f *FlightData) { f.Arrival.DateTime = "2025-07-24T20:00:00Z" },
+			reason: RejectArrivalBeforeDeparture, field: "arrival.datetime",
+		},
+		{
+			name:   "too short",
+			modify: func(f *FlightData) { f.Arrival.DateTime = "2025-07-24T21:35:00Z" },
+			reason: RejectTooShort, field: "arrival.datetime",
+		},
+		{
+			name:   "too short for a longer minimum",
+			modify: func(f *FlightData) {},
+			opts:   func(o *IngestOptions) { o.MinFlightDuration = time.Hour },
+			reason: RejectTooShort, field: "arrival.datetime",
+		},
+		{
+			// 352 nm in 10 minutes.
+			name:   "too fast",
+			modify: func(f *FlightData) { f.Arrival.DateTime = "2025-07-24T21:42:49Z" },
+			reason: RejectImplausibleSpeed, field: "distance.nm",
+		},
+		{
+			name:   "fast enough with the check off",
+			modify: func(f *FlightData) { f.Arrival.DateTime = "2025-07-24T21:42:49Z" },
+			opts:   func(o *IngestOptions) { o.MaxGroundSpeed = 0 },
+		},
+		{name: "shorter than the airports are apart", modify: func(f *FlightData) { f.Distance.NM = 200 }, reason: RejectDistanceMismatch, field: "distance.nm"},
+		{
+			name:   "far longer than the airports are apart",
+			modify: func(f *FlightData) { f.Distance.NM = 1500 },
+			opts:   func(o *IngestOptions) { o.MaxGroundSpeed = 0 },
+			reason: RejectDistanceMismatch, field: "distance.nm",
+		},
+		{
+			name:   "no coordinates to compare",
+			modify: func(f *FlightData) { f.Distance.NM = 200; f.Arrival.Airport.Locale = nil },
+		},
+		{
+			// A circuit ends where it began, far longer than the great circle.
+			name: "circuit",
+			modify: func(f *FlightData) {
+				f.Arrival.Airport = f.Departure.Airport
+				f.Distance.NM = 40
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flight := exampleFlight(t)
+			tt.modify(&flight)
+			o := opts
+			if tt.opts != nil {
+				tt.opts(&o)
+			}
+			rejection := ValidateFlight(flight, o)
+			if tt.reason == "" {
+				if rejection != nil {
+					t.Errorf("expected the flight to be valid, got %v", rejection)
+				}
+				return
+			}
+			if rejection == nil || rejection.Reason != tt.reason || rejection.Field != tt.field {
+				t.Errorf("expected %s on %s, got %+v", tt.reason, tt.field, rejection)
+			}
+		})
+	}
+}
+
+func TestIngestRejections(t *testing.T) {
+	setupTestDB(t)
+	t.Setenv("WEBHOOK_SECRET", "")
+	t.Setenv("ADMIN_TOKEN", "admin-secret")
+	if _, err := db.Exec(`DELETE FROM ingest_rejections`); err != nil {
+		t.Fatal(err)
+	}
+
+	// A delivery with an impossible distance is acknowledged with the reason and recorded.
+	flight := exampleFlight(t)
+	flight.Distance.NM = 100
+	body, _ := json.Marshal(FlightCompletedEvent{Data: flight})
+	req := httptest.NewRequest(http.MethodPost, "/webhook/flight-completed", bytes.NewReader(body))
+	rr := httptest.NewRecorder()
+	RequestLogger(http.HandlerFunc(FlightCompletedHandler)).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	var rejection Rejection
+	if err := json.NewDecoder(rr.Body).Decode(&rejection); err != nil || rejection.Reason != RejectDistanceMismatch {
+		t.Errorf("expected a distance mismatch in the response, got %+v (%v)", rejection, err)
+	}
+
+	// Imported flights are recorded too, once however often they are rejected.
+	for i := 0; i < 2; i++ {
+		if _, err := storeAPIFlights(context.Background(), sourceImport, []APIFlight{{ID: 5, User: User{ID: 8, Name: "Bob"}}}); err != nil {
+			t.Fatalf("storeAPIFlights returned error: %v", err)
+		}
+	}
+
+	list := func(query string) []IngestRejection {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/admin/rejections"+query, nil)
+		req.Header.Set("Authorization", "Bearer admin-secret")
+		rr := httptest.NewRecorder()
+		IngestRejectionsAdminHandler(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", query, rr.Code)
+		}
+		var rejections []IngestRejection
+		if err := json.NewDecoder(rr.Body).Decode(&rejections); err != nil {
+			t.Fatalf("Failed to decode rejections: %v", err)
+		}
+		return rejections
+	}
+
+	all := list("")
+	if len(all) != 2 || all[0].FlightID != 5 || all[0].Source != sourceImport || all[0].Reason != RejectMissingField {
+		t.Fatalf("unexpected rejections %+v", all)
+	}
+	webhook := all[1]
+	if webhook.FlightID != flight.ID || webhook.PilotID != 25104 || webhook.Source != sourceWebhook ||
+		webhook.RequestID != rr.Header().Get(requestIDHeader) || webhook.RequestID == "" {
+		t.Errorf("unexpected webhook rejection %+v", webhook)
+	}
+	if got := list("?reason=distance_mismatch&pilot=25104"); len(got) != 1 || got[0].ID != webhook.ID {
+		t.Errorf("unexpected filtered rejections %+v", got)
+	}
+	if got := list("?pilot=8&reason=too_short"); len(got) != 0 {
+		t.Errorf("expected no rejections, got %+v", got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/rejections", nil)
+	rr = httptest.NewRecorder()
+	IngestRejectionsAdminHandler(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401 without the admin token, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,540 @@
+package fswebhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers sent with every webhook delivery. The signature is the hex HMAC-SHA256 of the
+// request body keyed with the subscriber's secret, prefixed with "sha256=".
+const (
+	webhookSignatureHeader = "X-Webhook-Signature-256"
+	webhookEventHeader     = "X-Webhook-Event"
+	webhookDeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// webhookDeliveriesKept is how many log entries are kept per subscriber.
+const webhookDeliveriesKept = 500
+
+// WebhookSubscriber struct to hold an outside tool receiving our notifications
+type WebhookSubscriber struct {
+	ID                  int64     `json:"id"`
+	URL                 string    `json:"url"`
+	Events              []string  `json:"events"` // notification types delivered, every type when empty
+	Secret              string    `json:"secret,omitempty"`
+	Enabled             bool      `json:"enabled"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+// WebhookDelivery struct to hold one attempt at delivering a notification to a subscriber
+type WebhookDelivery struct {
+	ID             int64     `json:"id"`
+	NotificationID int64     `json:"notification_id"`
+	EventType      string    `json:"event_type"`
+	Attempt        int       `json:"attempt"` // 0 when the notification was dropped unattempted
+	StatusCode     int       `json:"status_code,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	DeliveredAt    time.Time `json:"delivered_at"`
+}
+
+// wants reports whether the subscriber asked for notifications of the given type.
+func (s WebhookSubscriber) wants(typ string) bool {
+	return len(s.Events) == 0 || slices.Contains(s.Events, typ)
+}
+
+// signWebhook returns the signature header value for body.
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+const webhookSubscriberColumns = `id, url, events, secret, enabled, consecutive_failures, created_at`
+
+func scanWebhookSubscriber(row interface{ Scan(...any) error }) (WebhookSubscriber, error) {
+	var s WebhookSubscriber
+	var events, createdAt string
+	if err := row.Scan(&s.ID, &s.URL, &events, &s.Secret, &s.Enabled, &s.ConsecutiveFailures, &createdAt); err != nil {
+		return s, err
+	}
+	s.Events = []string{}
+	if events != "" {
+		s.Events = strings.Split(events, ",")
+	}
+	s.CreatedAt, _ = parseFlightTime(createdAt)
+	return s, nil
+}
+
+// getWebhookSubscribers lists the registered subscribers, optionally only the enabled ones.
+func getWebhookSubscribers(ctx context.Context, enabledOnly bool) ([]WebhookSubscriber, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+webhookSubscriberColumns+` FROM webhook_subscribers
+		WHERE ? = 0 OR enabled = 1
+		ORDER BY id`, enabledOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscribers := []WebhookSubscriber{}
+	for rows.Next() {
+		s, err := scanWebhookSubscriber(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscribers = append(subscribers, s)
+	}
+	return subscribers, rows.Err()
+}
+
+// getWebhookSubscriber loads one subscriber, returning sql.ErrNoRows for unknown ids.
+func getWebhookSubscriber(ctx context.Context, id int64) (WebhookSubscriber, error) {
+	return scanWebhookSubscriber(db.QueryRowContext(ctx, `SELECT `+webhookSubscriberColumns+` FROM webhook_subscribers WHERE id = ?`, id))
+}
+
+// getWebhookDeliveries returns the most recent delivery attempts to a subscriber, newest first.
+func getWebhookDeliveries(ctx context.Context, subscriberID int64, limit int) ([]WebhookDelivery, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, notification_id, event_type, attempt, status_code, error, delivered_at
+		FROM webhook_deliveries
+		WHERE subscriber_id = ?
+		ORDER BY id DESC
+		LIMIT ?`, subscriberID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		var status sql.NullInt64
+		var deliveryErr sql.NullString
+		var deliveredAt string
+		if err := rows.Scan(&d.ID, &d.NotificationID, &d.EventType, &d.Attempt, &status, &deliveryErr, &deliveredAt); err != nil {
+			return nil, err
+		}
+		d.StatusCode = int(status.Int64)
+		d.Error = deliveryErr.String
+		d.DeliveredAt, _ = parseFlightTime(deliveredAt)
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// logWebhookDelivery records a delivery attempt, keeping only the latest entries per subscriber.
+func logWebhookDelivery(ctx context.Context, subscriberID int64, n Notification, attempt, status int, deliveryErr error) error {
+	var statusCode, errText any
+	if status != 0 {
+		statusCode = status
+	}
+	if deliveryErr != nil {
+		errText = deliveryErr.Error()
+	}
+	if _, err := db.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (subscriber_id, notification_id, event_type, attempt, status_code, error, delivered_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		subscriberID, n.ID, n.Type, attempt, statusCode, errText, time.Now().UTC().Format(time.RFC3339Nano)); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, `
+		DELETE FROM webhook_deliveries
+		WHERE subscriber_id = ?1 AND id <= (
+			SELECT id FROM webhook_deliveries WHERE subscriber_id = ?1 ORDER BY id DESC LIMIT 1 OFFSET ?2)`,
+		subscriberID, webhookDeliveriesKept)
+	return err
+}
+
+// ResumeNotificationIDs continues numbering notifications after the last one delivered to a
+// webhook subscriber, so X-Webhook-Delivery and the delivery log never reuse an ID after a
+// restart, even if the clock has gone back.
+func ResumeNotificationIDs(ctx context.Context) error {
+	var last sql.NullInt64
+	if err := db.QueryRowContext(ctx, `SELECT MAX(notification_id) FROM webhook_deliveries`).Scan(&last); err != nil {
+		return err
+	}
+	notifications.resumeAfter(last.Int64)
+	return nil
+}
+
+// webhookQueueSize is how many notifications may wait for a subscriber before further ones
+// are dropped for it, with the drop recorded in its delivery log.
+const webhookQueueSize = 100
+
+// errWebhookQueueFull is logged as the delivery of a notification dropped for a subscriber
+// that fell too far behind.
+var errWebhookQueueFull = errors.New("dropped: too many notifications waiting for this subscriber")
+
+// webhookJob struct to hold a notification waiting to be delivered to a subscriber
+type webhookJob struct {
+	ctx          context.Context
+	subscriberID int64
+	n            Notification
+	body         []byte
+}
+
+// WebhookDispatcher delivers notifications to the registered webhook subscribers. Each
+// subscriber has a worker delivering its notifications one at a time, in order.
+type WebhookDispatcher struct {
+	Client      *http.Client
+	MaxAttempts int
+	Backoff     time.Duration // wait before the first retry, doubled after each failure
+	MaxFailures int           // notifications in a row a subscriber may fail before it is disabled
+
+	mu      sync.Mutex
+	queues  map[int64]chan webhookJob // by subscriber ID
+	pending sync.WaitGroup            // deliveries queued or in progress
+	workers sync.WaitGroup
+}
+
+// NewWebhookDispatcher returns a dispatcher with the default retry and disabling policy.
+func NewWebhookDispatcher() *WebhookDispatcher {
+	return &WebhookDispatcher{
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts: 5,
+		Backoff:     2 * time.Second,
+		MaxFailures: 10,
+	}
+}
+
+// Run dispatches every notification received until the channel is closed or ctx is
+// cancelled, then waits for deliveries in flight.
+func (d *WebhookDispatcher) Run(ctx context.Context, notifications <-chan Notification) {
+	defer d.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n, ok := <-notifications:
+			if !ok {
+				return
+			}
+			d.Dispatch(ctx, n)
+		}
+	}
+}
+
+// Dispatch queues a notification for every enabled subscriber that wants it. Subscribers are
+// delivered to by their own workers, so one slow receiver does not hold up the rest; a
+// subscriber whose queue is full misses the notification, which shows in its delivery log.
+func (d *WebhookDispatcher) Dispatch(ctx context.Context, n Notification) {
+	subscribers, err := getWebhookSubscribers(ctx, true)
+	if err != nil {
+		slog.Error("Error loading webhook subscribers", "err", err)
+		return
+	}
+	body, err := json.Marshal(n)
+	if err != nil {
+		slog.Error("Error encoding notification", "type", n.Type, "notification_id", n.ID, "err", err)
+		return
+	}
+	for _, s := range subscribers {
+		if !s.wants(n.Type) {
+			continue
+		}
+		d.pending.Add(1)
+		select {
+		case d.queue(s.ID) <- webhookJob{ctx: ctx, subscriberID: s.ID, n: n, body: body}:
+		default:
+			d.pending.Done()
+			slog.Warn("Dropping notification for a webhook subscriber that is falling behind",
+				"type", n.Type, "notification_id", n.ID, "subscriber_id", s.ID)
+			if err := logWebhookDelivery(ctx, s.ID, n, 0, 0, errWebhookQueueFull); err != nil {
+				slog.Error("Error logging webhook delivery", "subscriber_id", s.ID, "err", err)
+			}
+		}
+	}
+}
+
+// queue returns the queue of the subscriber's worker, starting the worker if need be.
+func (d *WebhookDispatcher) queue(subscriberID int64) chan<- webhookJob {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if q, ok := d.queues[subscriberID]; ok {
+		return q
+	}
+	if d.queues == nil {
+		d.queues = make(map[int64]chan webhookJob)
+	}
+	q := make(chan webhookJob, webhookQueueSize)
+	d.queues[subscriberID] = q
+	d.workers.Add(1)
+	go func() {
+		defer d.workers.Done()
+		for job := range q {
+			d.work(job)
+			d.pending.Done()
+		}
+	}()
+	return q
+}
+
+// work delivers a queued notification to the subscriber as it is now, so deliveries stop
+// once it is disabled or deleted and use its current URL and secret.
+func (d *WebhookDispatcher) work(job webhookJob) {
+	// Deliveries queued before shutdown are not attempted, or they would count as failures.
+	if job.ctx.Err() != nil {
+		return
+	}
+	s, err := getWebhookSubscriber(job.ctx, job.subscriberID)
+	if err == sql.ErrNoRows {
+		return
+	}
+	if err != nil {
+		slog.Error("Error loading webhook subscriber", "subscriber_id", job.subscriberID, "err", err)
+		return
+	}
+	if s.Enabled && s.wants(job.n.Type) {
+		d.deliver(job.ctx, s, job.n, job.body)
+	}
+}
+
+// Wait blocks until every delivery queued so far has finished.
+func (d *WebhookDispatcher) Wait() {
+	d.pending.Wait()
+}
+
+// Close stops the workers once they are through their queues. Nothing may be dispatched after.
+func (d *WebhookDispatcher) Close() {
+	d.mu.Lock()
+	for id, q := range d.queues {
+		close(q)
+		delete(d.queues, id)
+	}
+	d.mu.Unlock()
+	d.workers.Wait()
+}
+
+func (d *WebhookDispatcher) deliver(ctx context.Context, s WebhookSubscriber, n Notification, body []byte) {
+	header := http.Header{}
+	header.Set(webhookEventHeader, n.Type)
+	header.Set(webhookDeliveryHeader, strconv.FormatInt(n.ID, 10))
+	header.Set(webhookSignatureHeader, signWebhook(s.Secret, body))
+
+	retry := retryPolicy{MaxAttempts: d.MaxAttempts, Backoff: d.Backoff}
+	err := retry.do(ctx, func(attempt int) error {
+		status, err := postJSON(ctx, d.Client, s.URL, body, header)
+		if logErr := logWebhookDelivery(ctx, s.ID, n, attempt, status, err); logErr != nil {
+			slog.Error("Error logging webhook delivery", "subscriber_id", s.ID, "err", logErr)
+		}
+		return err
+	})
+
+	if err == nil {
+		if _, err := db.ExecContext(ctx, `UPDATE webhook_subscribers SET consecutive_failures = 0 WHERE id = ?`, s.ID); err != nil {
+			slog.Error("Error resetting webhook subscriber failures", "subscriber_id", s.ID, "err", err)
+		}
+		return
+	}
+
+	slog.Warn("Error delivering notification to webhook subscriber", "type", n.Type, "notification_id", n.ID, "subscriber_id", s.ID, "err", err)
+	var enabled bool
+	err = db.QueryRowContext(ctx, `
+		UPDATE webhook_subscribers SET
+			consecutive_failures = consecutive_failures + 1,
+			enabled = consecutive_failures + 1 < ?
+		WHERE id = ?
+		RETURNING enabled`, d.MaxFailures, s.ID).Scan(&enabled)
+	if err != nil {
+		slog.Error("Error recording webhook subscriber failure", "subscriber_id", s.ID, "err", err)
+		return
+	}
+	if !enabled {
+		slog.Warn("Disabled webhook subscriber after repeated failures", "subscriber_id", s.ID, "url", s.URL, "failures", d.MaxFailures)
+	}
+}
+
+// webhookRequest struct to hold the body of a request registering or updating a subscriber
+type webhookRequest struct {
+	URL     string   `json:"url"`
+	Events  []string `json:"events"`
+	Secret  string   `json:"secret"`
+	Enabled *bool    `json:"enabled"`
+}
+
+// WebhooksAdminHandler lists (GET) or registers (POST) webhook subscribers. A subscriber is
+// registered with {"url": ..., "events": [...], "secret": ...}; leaving out the events subscribes
+// to every notification, and leaving out the secret generates one. The secret is only ever
+// returned in the response to the POST.
+func WebhooksAdminHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		subscribers, err := getWebhookSubscribers(r.Context(), false)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error querying webhook subscribers", "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		for i := range subscribers {
+			subscribers[i].Secret = ""
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(subscribers)
+
+	case http.MethodPost:
+		var req webhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			http.Error(w, "url must be an http or https URL", http.StatusBadRequest)
+			return
+		}
+		for _, e := range req.Events {
+			if !slices.Contains(notificationTypes, e) {
+				http.Error(w, "Unknown event "+strconv.Quote(e)+", expected one of "+strings.Join(notificationTypes, ", "), http.StatusBadRequest)
+				return
+			}
+		}
+		if req.Secret == "" {
+			secret := make([]byte, 32)
+			if _, err := rand.Read(secret); err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			req.Secret = hex.EncodeToString(secret)
+		} else if len(req.Secret) < 16 {
+			http.Error(w, "secret must be at least 16 characters", http.StatusBadRequest)
+			return
+		}
+
+		res, err := db.ExecContext(r.Context(), `
+			INSERT INTO webhook_subscribers (url, events, secret, created_at) VALUES (?, ?, ?, ?)`,
+			req.URL, strings.Join(req.Events, ","), req.Secret, time.Now().UTC().Format(time.RFC3339))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error registering webhook subscriber", "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		id, _ := res.LastInsertId()
+		slog.InfoContext(r.Context(), "Registered webhook subscriber", "subscriber_id", id, "url", req.URL)
+
+		subscriber, err := getWebhookSubscriber(r.Context(), id)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error querying webhook subscriber", "subscriber_id", id, "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(subscriber)
+
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+// webhookSubscriberFromRequest loads the subscriber in the {id} path segment, writing an error response if it cannot.
+func webhookSubscriberFromRequest(w http.ResponseWriter, r *http.Request) (WebhookSubscriber, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid webhook subscriber ID", http.StatusBadRequest)
+		return WebhookSubscriber{}, false
+	}
+	s, err := getWebhookSubscriber(r.Context(), id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Webhook subscriber not found", http.StatusNotFound)
+		return s, false
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error querying webhook subscriber", "subscriber_id", id, "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return s, false
+	}
+	return s, true
+}
+
+// WebhookAdminHandler shows (GET), re-enables or disables (PATCH {"enabled": true}) or deletes
+// (DELETE) the webhook subscriber in the {id} path segment. Re-enabling clears its failure count.
+func WebhookAdminHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	s, ok := webhookSubscriberFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPatch:
+		var req webhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+			http.Error(w, "Request body must be {\"enabled\": true|false}", http.StatusBadRequest)
+			return
+		}
+		if _, err := db.ExecContext(r.Context(), `UPDATE webhook_subscribers SET enabled = ?, consecutive_failures = 0 WHERE id = ?`, *req.Enabled, s.ID); err != nil {
+			slog.ErrorContext(r.Context(), "Error updating webhook subscriber", "subscriber_id", s.ID, "err", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		s.Enabled, s.ConsecutiveFailures = *req.Enabled, 0
+	case http.MethodDelete:
+		for _, query := range []string{
+			`DELETE FROM webhook_deliveries WHERE subscriber_id = ?`,
+			`DELETE FROM webhook_subscribers WHERE id = ?`,
+		} {
+			if _, err := db.ExecContext(r.Context(), query, s.ID); err != nil {
+				slog.ErrorContext(r.Context(), "Error deleting webhook subscriber", "subscriber_id", s.ID, "err", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
+		slog.InfoContext(r.Context(), "Deleted webhook subscriber", "subscriber_id", s.ID)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.Secret = ""
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+// WebhookDeliveriesAdminHandler returns the latest delivery attempts to the webhook
+// subscriber in the {id} path segment, newest first.
+func WebhookDeliveriesAdminHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	s, ok := webhookSubscriberFromRequest(w, r)
+	if !ok {
+		return
+	}
+	limit, ok := limitFromRequest(r, defaultListLimit)
+	if !ok {
+		http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+		return
+	}
+
+	deliveries, err := getWebhookDeliveries(r.Context(), s.ID, limit)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error querying webhook deliveries", "subscriber_id", s.ID, "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
@@ -0,0 +1,332 @@
+package fswebhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func setupWebhookTables(t *testing.T) {
+	t.Helper()
+	setupTestDB(t)
+	clear := func() {
+		for _, table := range []string{"webhook_subscribers", "webhook_deliveries"} {
+			if _, err := db.Exec(`DELETE FROM ` + table); err != nil {
+				t.Fatalf("Failed to clear %s table: %v", table, err)
+			}
+		}
+	}
+	clear()
+	t.Cleanup(clear)
+}
+
+func insertTestWebhook(t *testing.T, url, events, secret string) int64 {
+	t.Helper()
+	res, err := db.Exec(`INSERT INTO webhook_subscribers (url, events, secret, created_at) VALUES (?, ?, ?, ?)`,
+		url, events, secret, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		t.Fatalf("Failed to insert webhook subscriber: %v", err)
+	}
+	id, _ := res.LastInsertId()
+	return id
+}
+
+// webhookReceiver records the deliveries it receives, answering with status.
+type webhookReceiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rcv *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	rcv.requests = append(rcv.requests, r)
+	rcv.bodies = append(rcv.bodies, body)
+	w.WriteHeader(rcv.status)
+}
+
+func newTestWebhookDispatcher() *WebhookDispatcher {
+	d := NewWebhookDispatcher()
+	d.MaxAttempts = 2
+	d.Backoff = time.Millisecond
+	d.MaxFailures = 2
+	return d
+}
+
+func TestWebhookDispatcherDelivers(t *testing.T) {
+	setupWebhookTables(t)
+	records := &webhookReceiver{status: http.StatusOK}
+	everything := &webhookReceiver{status: http.StatusNoContent}
+	recordsServer, everythingServer := httptest.NewServer(records), httptest.NewServer(everything)
+	defer recordsServer.Close()
+	defer everythingServer.Close()
+
+	recordsID := insertTestWebhook(t, recordsServer.URL, "record.broken,week.closed", "records-secret-123")
+	everythingID := insertTestWebhook(t, everythingServer.URL, "", "everything-secret-123")
+
+	d := newTestWebhookDispatcher()
+	n := Notification{ID: 42, Type: NotificationFlightStored, Time: time.Now().UTC(), Data: FlightData{ID: 7}}
+	d.Dispatch(context.Background(), n)
+	d.Wait()
+
+	if len(records.requests) != 0 {
+		t.Errorf("expected no delivery to the record.broken subscriber, got %d", len(records.requests))
+	}
+	if len(everything.requests) != 1 {
+		t.Fatalf("expected one delivery to the catch-all subscriber, got %d", len(everything.requests))
+	}
+	req, body := everything.requests[0], everything.bodies[0]
+	if got, want := req.Header.Get(webhookSignatureHeader), signWebhook("everything-secret-123", body); got != want {
+		t.Errorf("expected signature %s, got %s", want, got)
+	}
+	if req.Header.Get(webhookEventHeader) != NotificationFlightStored || req.Header.Get(webhookDeliveryHeader) != "42" {
+		t.Errorf("unexpected delivery headers: %v", req.Header)
+	}
+	var received Notification
+	if err := json.Unmarshal(body, &received); err != nil || received.Type != NotificationFlightStored || received.ID != 42 {
+		t.Errorf("unexpected delivery body %s (%v)", body, err)
+	}
+
+	deliveries, err := getWebhookDeliveries(context.Background(), everythingID, 10)
+	if err != nil || len(deliveries) != 1 || deliveries[0].StatusCode != http.StatusNoContent || deliveries[0].Error != "" {
+		t.Errorf("expected one successful delivery logged, got %+v (%v)", deliveries, err)
+	}
+	if deliveries, _ := getWebhookDeliveries(context.Background(), recordsID, 10); len(deliveries) != 0 {
+		t.Errorf("expected nothing logged for the record.broken subscriber, got %+v", deliveries)
+	}
+}
+
+func TestWebhookDispatcherDisablesFailingSubscribers(t *testing.T) {
+	setupWebhookTables(t)
+	broken := &webhookReceiver{status: http.StatusInternalServerError}
+	server := httptest.NewServer(broken)
+	defer server.Close()
+	id := insertTestWebhook(t, server.URL, "", "broken-secret-12345")
+
+	d := newTestWebhookDispatcher()
+	for i := 1; i <= 3; i++ {
+		d.Dispatch(context.Background(), Notification{ID: int64(i), Type: NotificationWeekClosed})
+		d.Wait()
+	}
+
+	// Two notifications, each tried twice, before the subscriber is disabled.
+	if len(broken.requests) != 4 {
+		t.Errorf("expected 4 attempts before disabling, got %d", len(broken.requests))
+	}
+	s, err := getWebhookSubscriber(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Enabled || s.ConsecutiveFailures != 2 {
+		t.Errorf("expected the subscriber disabled after 2 failures, got %+v", s)
+	}
+	deliveries, err := getWebhookDeliveries(context.Background(), id, 10)
+	if err != nil || len(deliveries) != 4 || deliveries[0].StatusCode != http.StatusInternalServerError || deliveries[0].Attempt != 2 {
+		t.Errorf("expected 4 failed attempts logged, got %+v (%v)", deliveries, err)
+	}
+}
+
+func TestWebhookDispatcherSkipsQueuedDeliveriesOnceDisabled(t *testing.T) {
+	setupWebhookTables(t)
+	broken := &webhookReceiver{status: http.StatusInternalServerError}
+	server := httptest.NewServer(broken)
+	defer server.Close()
+	id := insertTestWebhook(t, server.URL, "", "broken-secret-12345")
+
+	// All three are queued before the first fails.
+	d := newTestWebhookDispatcher()
+	defer d.Close()
+	for i := 1; i <= 3; i++ {
+		d.Dispatch(context.Background(), Notification{ID: int64(i), Type: NotificationWeekClosed})
+	}
+	d.Wait()
+
+	if len(broken.requests) != 4 {
+		t.Errorf("expected the third notification skipped once the subscriber was disabled, got %d attempts", len(broken.requests))
+	}
+	deliveries, err := getWebhookDeliveries(context.Background(), id, 10)
+	if err != nil || len(deliveries) != 4 {
+		t.Errorf("expected 4 attempts logged, got %+v (%v)", deliveries, err)
+	}
+}
+
+func TestWebhookDispatcherLogsDroppedNotifications(t *testing.T) {
+	setupWebhookTables(t)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	id := insertTestWebhook(t, server.URL, "", "stalled-secret-1234")
+
+	// One delivery in progress and a full queue leave no room for the last notifications.
+	d := newTestWebhookDispatcher()
+	defer d.Close()
+	total := webhookQueueSize + 2
+	for i := 1; i <= total; i++ {
+		d.Dispatch(context.Background(), Notification{ID: int64(i), Type: NotificationFlightStored})
+	}
+	close(release)
+	d.Wait()
+
+	deliveries, err := getWebhookDeliveries(context.Background(), id, webhookDeliveriesKept)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dropped []int64
+	for _, delivery := range deliveries {
+		if delivery.Attempt == 0 {
+			dropped = append(dropped, delivery.NotificationID)
+			if delivery.Error != errWebhookQueueFull.Error() {
+				t.Errorf("expected the drop explained, got %q", delivery.Error)
+			}
+		}
+	}
+	if len(dropped) == 0 || dropped[0] <= webhookQueueSize || len(deliveries) != total {
+		t.Errorf("expected the last notifications logged as dropped and the rest delivered, got %v dropped of %d", dropped, len(deliveries))
+	}
+}
+
+func TestWebhookDispatcherCapsRetryAfter(t *testing.T) {
+	setupWebhookTables(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "86400")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	insertTestWebhook(t, server.URL, "", "limited-secret-1234")
+
+	d := newTestWebhookDispatcher()
+	defer d.Close()
+	d.Dispatch(context.Background(), Notification{ID: 1, Type: NotificationFlightStored})
+	done := make(chan struct{})
+	go func() {
+		d.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the receiver's day-long Retry-After capped to the largest backoff")
+	}
+}
+
+func TestWebhookDispatcherDeliversInOrder(t *testing.T) {
+	setupWebhookTables(t)
+	var mu sync.Mutex
+	var received []string
+	inFlight, maxInFlight := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		received = append(received, r.Header.Get(webhookDeliveryHeader))
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	defer server.Close()
+	insertTestWebhook(t, server.URL, "", "ordered-secret-1234")
+
+	d := newTestWebhookDispatcher()
+	defer d.Close()
+	for i := 1; i <= 3; i++ {
+		d.Dispatch(context.Background(), Notification{ID: int64(i), Type: NotificationFlightStored})
+	}
+	d.Wait()
+
+	if strings.Join(received, ",") != "1,2,3" || maxInFlight != 1 {
+		t.Errorf("expected deliveries 1,2,3 one at a time, got %v with up to %d at once", received, maxInFlight)
+	}
+}
+
+func TestResumeNotificationIDs(t *testing.T) {
+	setupWebhookTables(t)
+	last := notifications.publish(NotificationFlightStored, nil).ID + 1000
+	if _, err := db.Exec(`
+		INSERT INTO webhook_deliveries (subscriber_id, notification_id, event_type, attempt, delivered_at)
+		VALUES (1, ?, ?, 1, ?)`, last, NotificationFlightStored, time.Now().UTC().Format(time.RFC3339Nano)); err != nil {
+		t.Fatalf("Failed to insert webhook delivery: %v", err)
+	}
+	if err := ResumeNotificationIDs(context.Background()); err != nil {
+		t.Fatalf("ResumeNotificationIDs returned error: %v", err)
+	}
+	if n := publish(NotificationFlightStored, nil); n.ID <= last {
+		t.Errorf("expected a notification ID above %d, got %d", last, n.ID)
+	}
+}
+
+func TestWebhooksAdminHandler(t *testing.T) {
+	setupWebhookTables(t)
+	t.Setenv("ADMIN_TOKEN", "admin-secret")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/webhooks", WebhooksAdminHandler)
+	mux.HandleFunc("/admin/webhooks/{id}", WebhookAdminHandler)
+	mux.HandleFunc("/admin/webhooks/{id}/deliveries", WebhookDeliveriesAdminHandler)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer admin-secret")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for _, body := range []string{
+		`{"url": "ftp://bot.example.com/hook"}`,
+		`{"url": "https://bot.example.com/hook", "events": ["flight.landed"]}`,
+		`{"url": "https://bot.example.com/hook", "secret": "short"}`,
+	} {
+		if rr := do(http.MethodPost, "/admin/webhooks", body); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", body, rr.Code)
+		}
+	}
+
+	rr := do(http.MethodPost, "/admin/webhooks", `{"url": "https://bot.example.com/hook", "events": ["record.broken", "group_flight.detected"]}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var created WebhookSubscriber
+	if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(created.Secret) != 64 || !created.Enabled || len(created.Events) != 2 {
+		t.Errorf("expected an enabled subscriber with a generated secret, got %+v", created)
+	}
+
+	rr = do(http.MethodGet, "/admin/webhooks", "")
+	if strings.Contains(rr.Body.String(), created.Secret) {
+		t.Error("the secret should only be returned when the subscriber is registered")
+	}
+
+	path := fmt.Sprintf("/admin/webhooks/%d", created.ID)
+	db.Exec(`UPDATE webhook_subscribers SET enabled = 0, consecutive_failures = 10 WHERE id = ?`, created.ID)
+	rr = do(http.MethodPatch, path, `{"enabled": true}`)
+	var updated WebhookSubscriber
+	if err := json.NewDecoder(rr.Body).Decode(&updated); err != nil || !updated.Enabled || updated.ConsecutiveFailures != 0 {
+		t.Errorf("expected the subscriber re-enabled with its failures cleared, got %+v (%v)", updated, err)
+	}
+
+	if rr := do(http.MethodGet, path+"/deliveries", ""); rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != "[]" {
+		t.Errorf("expected an empty delivery log, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := do(http.MethodDelete, path, ""); rr.Code != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", rr.Code)
+	}
+	if rr := do(http.MethodGet, path, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 after deleting, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,141 @@
+package fswebhook
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const xlsxNamespace = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+
+// xlsxWriter streams an Excel workbook of plain sheets. The sheets are named up front so the
+// workbook parts can be written first; rows then go straight into the zip as they are added,
+// one sheet after another, without holding the workbook in memory.
+type xlsxWriter struct {
+	zw     *zip.Writer
+	sheets []string
+	next   int       // index of the next sheet to start
+	sheet  io.Writer // sheet being written, nil before the first
+	err    error
+}
+
+// newXLSXWriter starts a workbook with the given sheets.
+func newXLSXWriter(w io.Writer, sheets ...string) *xlsxWriter {
+	x := &xlsxWriter{zw: zip.NewWriter(w), sheets: sheets}
+
+	var types, workbook, rels strings.Builder
+	types.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+`)
+	workbook.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="` + xlsxNamespace + `" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	rels.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i, name := range sheets {
+		n := i + 1
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`+"\n", n)
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(name), n, n)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+	}
+	types.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets></workbook>`)
+	rels.WriteString(`</Relationships>`)
+
+	for _, part := range []struct{ name, content string }{
+		{"[Content_Types].xml", types.String()},
+		{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", rels.String()},
+	} {
+		x.writePart(part.name, part.content)
+	}
+	return x
+}
+
+func (x *xlsxWriter) writePart(name, content string) {
+	if x.err != nil {
+		return
+	}
+	var f io.Writer
+	if f, x.err = x.zw.Create(name); x.err == nil {
+		_, x.err = io.WriteString(f, content)
+	}
+}
+
+func (x *xlsxWriter) write(s string) {
+	if x.err == nil {
+		_, x.err = io.WriteString(x.sheet, s)
+	}
+}
+
+// NextSheet finishes the current sheet and starts the next one named up front.
+func (x *xlsxWriter) NextSheet() error {
+	if x.next >= len(x.sheets) {
+		return fmt.Errorf("workbook only has %d sheets", len(x.sheets))
+	}
+	if x.sheet != nil {
+		x.write(`</sheetData></worksheet>`)
+	}
+	if x.err != nil {
+		return x.err
+	}
+	x.next++
+	x.sheet, x.err = x.zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", x.next))
+	x.write(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" + `<worksheet xmlns="` + xlsxNamespace + `"><sheetData>`)
+	return x.err
+}
+
+// WriteRow appends a row to the current sheet. Numbers become numeric cells and anything
+// else text.
+func (x *xlsxWriter) WriteRow(cells ...any) error {
+	if x.sheet == nil {
+		return fmt.Errorf("no sheet started")
+	}
+	var b strings.Builder
+	b.WriteString("<row>")
+	for _, cell := range cells {
+		var number string
+		switch v := cell.(type) {
+		case int:
+			number = strconv.Itoa(v)
+		case int64:
+			number = strconv.FormatInt(v, 10)
+		case float64:
+			number = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			fmt.Fprintf(&b, `<c t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, xmlEscape(fmt.Sprint(v)))
+			continue
+		}
+		fmt.Fprintf(&b, `<c><v>%s</v></c>`, number)
+	}
+	b.WriteString("</row>")
+	x.write(b.String())
+	return x.err
+}
+
+// Close finishes the workbook, writing any sheets that were never started empty.
+func (x *xlsxWriter) Close() error {
+	for x.next < len(x.sheets) && x.err == nil {
+		x.NextSheet()
+	}
+	if x.sheet != nil {
+		x.write(`</sheetData></worksheet>`)
+	}
+	if x.err != nil {
+		return x.err
+	}
+	return x.zw.Close()
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
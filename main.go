@@ -1,83 +1,139 @@
 package main
 
 import (
-	"crypto/tls"
+	"context"
 	"flag"
 	"fmt"
-	"log"
-	"net/http"
+	"io"
+	"log/slog"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"fshubhook/fswebhook"
-
-	"github.com/gorilla/handlers"
-	"golang.org/x/crypto/acme/autocert"
 )
 
-func groupFlightsHandler(w http.ResponseWriter, r *http.Request) {
-	if strings.Contains(r.UserAgent(), "Mobi") {
-		http.ServeFile(w, r, "static/group-flights-mobile.html")
-		return
-	}
-	http.ServeFile(w, r, "static/group-flights-desktop.html")
+// runFunc runs a command once the configuration is loaded and the database is open. args are
+// the positional arguments left after the flags.
+type runFunc func(ctx context.Context, cfg fswebhook.Config, args []string) error
+
+// command is one of the fshubhook subcommands. Every command takes the server's
+// configuration flags besides its own.
+type command struct {
+	name    string
+	args    string // positional arguments, for the usage line
+	summary string
+	// setup registers the command's own flags and returns the function running it.
+	setup func(fs *flag.FlagSet) runFunc
+	// keepSchema opens the database without migrating it, for commands that inspect or
+	// control migrations themselves.
+	keepSchema bool
 }
 
-func main() {
-	// Define a command-line flag to enable the webhook.
-	webhookEnabled := flag.Bool("webhook", false, "Enable the flight completed webhook")
-	hostname := flag.String("hostname", "", "Hostname for TLS certificate")
-	flag.Parse()
+var commands = []command{
+	{name: "serve", summary: "Serve the website, API and webhook (the default)", setup: serveCommand},
+	{name: "migrate", summary: "Bring the database schema up to date", setup: migrateCommand, keepSchema: true},
+	{name: "sync", summary: "Import new flights from the FSHub API, as updatedb.py does", setup: syncCommand},
+	{name: "backfill", summary: "Recompute group flights, event attendance and achievements", setup: backfillCommand},
+	{name: "replay", args: "[file...]", summary: "Ingest saved flight completed webhook payloads", setup: replayCommand},
+	{name: "report", summary: "Print the leaderboards for a period", setup: reportCommand},
+	{name: "export", summary: "Write flights as CSV or XLSX", setup: exportCommand},
+	{name: "import", args: "[file...]", summary: "Import flights from FSHub API JSON, webhook events or CSV", setup: importCommand},
+	{name: "doctor", summary: "Check the configuration, database and certificate cache", setup: doctorCommand, keepSchema: true},
+}
 
-	fswebhook.InitDB()
+// fatal logs an error that prevents the command from running and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
 
-	http.Handle("/", http.FileServer(http.Dir("./static")))
-	http.HandleFunc("/group-flights.html", groupFlightsHandler)
-	http.HandleFunc("/flights", fswebhook.FlightsHandler)
-	http.HandleFunc("/group-flight", fswebhook.GroupFlightHandler)
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [command] [flags] [args]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun %s <command> -h for the flags of a command.\n", os.Args[0])
+}
 
-	// Only register the webhook handler if the flag is set.
-	if *webhookEnabled {
-		http.HandleFunc("/webhook/flight-completed", fswebhook.FlightCompletedHandler)
-		fmt.Println("Flight completed webhook is enabled.")
+func main() {
+	// Without a command the binary serves, as it did before it had commands.
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		usage()
+		return
+	}
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == name {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
 	}
 
-	// Wrap the default ServeMux with the logging middleware.
-	loggedRouter := handlers.LoggingHandler(os.Stdout, http.DefaultServeMux)
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s [flags] %s\n\n%s.\n\nFlags:\n", os.Args[0], cmd.name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
+	}
+	run := cmd.setup(fs)
+	cfg, err := fswebhook.LoadConfig(fs, args)
 
-	if *hostname != "" {
-		certManager := autocert.Manager{
-			Prompt:     autocert.AcceptTOS,
-			HostPolicy: autocert.HostWhitelist(*hostname),
-			Cache:      autocert.DirCache("/etc/certs"),
-		}
+	// The server logs to stdout for docker; other commands keep stdout for their output.
+	var logOutput io.Writer = os.Stderr
+	if name == "serve" {
+		logOutput = os.Stdout
+	}
+	fswebhook.SetupLogging(logOutput, cfg.LogLevel)
+	if err != nil {
+		fatal("Invalid configuration", "err", err)
+	}
+	if err := cfg.Apply(); err != nil {
+		fatal("Error applying configuration", "err", err)
+	}
 
-		server := &http.Server{
-			Addr:    ":443",
-			Handler: loggedRouter,
-			TLSConfig: &tls.Config{
-				GetCertificate: certManager.GetCertificate,
-				MinVersion:     tls.VersionTLS11,
-			},
+	if err := fswebhook.OpenDB(); err != nil {
+		fatal("Error opening database", "database", cfg.Database, "err", err)
+	}
+	slog.Debug("Connected to the database", "database", cfg.Database)
+	if !cmd.keepSchema {
+		if _, err := fswebhook.MigrateDB(); err != nil {
+			fatal("Error migrating database", "database", cfg.Database, "err", err)
 		}
+	}
 
-		go func() {
-			fmt.Println("Server starting on port 443 for https...")
-			if err := server.ListenAndServeTLS("", ""); err != nil {
-				log.Fatalf("Error starting HTTPS server: %s", err)
-			}
-		}()
+	// Stop on SIGINT or on the SIGTERM sent by docker stop. A second signal kills the process
+	// straight away.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
 
-		// Serve HTTP, which will handle ACME challenges and serve content.
-		fmt.Println("Server starting on port 80 for http...")
-		// The HTTPHandler wraps the main router. It will handle ACME challenges
-		// and pass other requests to the loggedRouter.
-		log.Fatal(http.ListenAndServe(":80", certManager.HTTPHandler(loggedRouter)))
+	err = run(ctx, cfg, fs.Args())
+	if closeErr := fswebhook.CloseDB(); closeErr != nil {
+		slog.Error("Error closing database", "err", closeErr)
+		if err == nil {
+			os.Exit(1)
+		}
+	}
+	if err != nil {
+		fatal("Error running "+name, "err", err)
+	}
+}
 
-	} else {
-		fmt.Println("Server starting on port 8080...")
-		if err := http.ListenAndServe("0.0.0.0:8080", loggedRouter); err != nil {
-			log.Fatalf("Error starting server: %s", err)
+// loadAchievements loads the achievement rules, leaving achievements off if there are none.
+func loadAchievements(cfg fswebhook.Config) error {
+	if err := fswebhook.LoadAchievementRules(cfg.Achievements); err != nil {
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("loading achievement rules: %w", err)
 		}
+		slog.Info("No achievement rules found, achievements are disabled", "file", cfg.Achievements)
 	}
-}
\ No newline at end of file
+	return nil
+}
@@ -1,12 +1,14 @@
 #!/bin/bash
 # This script runs the container
 
-sudo docker rm -f fshub-server
+# Give the server time to finish in-flight requests before it is killed.
+sudo docker stop --time 30 fshub-server
+sudo docker rm fshub-server
 
 sudo docker run --env-file ./.env -d \
 --log-opt max-size=100m \
 --log-opt max-file=10 \
 -p 80:80 -p 443:443 \
 --name fshub-server -v "/opt/certs:/etc/certs" \
--v "$(pwd)/fshub.db:/root/fshub.db" fshub-tools --webhook --hostname justjohn12345.com \
+-v "$(pwd)/fshub.db:/root/fshub.db" fshub-tools serve --webhook --hostname justjohn12345.com \
 --restart unless-stopped
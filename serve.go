@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"fshubhook/fswebhook"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func groupFlightsHandler(w http.ResponseWriter, r *http.Request) {
+	if strings.Contains(r.UserAgent(), "Mobi") {
+		http.ServeFile(w, r, "static/group-flights-mobile.html")
+		return
+	}
+	http.ServeFile(w, r, "static/group-flights-desktop.html")
+}
+
+// runServe serves the website, API and webhook until ctx is cancelled, then shuts down
+// gracefully.
+func runServe(ctx context.Context, cfg fswebhook.Config) error {
+	if err := fswebhook.LoadMetrics(context.Background()); err != nil {
+		slog.Error("Error loading metrics", "err", err)
+	}
+
+	if seeded, err := fswebhook.SeedGroupFlightLeaders(context.Background(), cfg.GroupFlights.Leaders); err != nil {
+		return fmt.Errorf("registering group flight leaders: %w", err)
+	} else if seeded {
+		slog.Info("Registered the configured group flight leaders", "pilot_ids", cfg.GroupFlights.Leaders)
+	}
+	if err := loadAchievements(cfg); err != nil {
+		return err
+	}
+	if err := fswebhook.ResumeNotificationIDs(context.Background()); err != nil {
+		return fmt.Errorf("resuming notification IDs: %w", err)
+	}
+
+	// Subscribe before the jobs start so their first notifications are not missed.
+	var notifiers background
+	notifyCtx, cancelNotify := context.WithCancel(context.Background())
+	defer cancelNotify()
+	if url := cfg.DiscordWebhookURL; url != "" {
+		notifications, unsubscribe := fswebhook.SubscribeDurable(100)
+		notifiers.Go(unsubscribe, func() { fswebhook.NewDiscordNotifier(url).Run(notifyCtx, notifications) })
+		slog.Info("Discord notifications are enabled")
+	}
+	webhookNotifications, unsubscribeWebhooks := fswebhook.SubscribeDurable(100)
+	notifiers.Go(unsubscribeWebhooks, func() { fswebhook.NewWebhookDispatcher().Run(notifyCtx, webhookNotifications) })
+
+	// Live feed clients are disconnected as soon as shutdown starts, or they would hold it up.
+	streamNotifications, unsubscribeStream := fswebhook.Subscribe(100)
+	streamCtx, stopStreams := context.WithCancel(context.Background())
+	defer stopStreams()
+	stream := fswebhook.NewStreamBroker()
+	notifiers.Go(unsubscribeStream, func() { stream.Run(streamCtx, streamNotifications) })
+
+	// Also catch group flights among flights imported by sync or updatedb.py.
+	var jobs background
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	for _, job := range []struct {
+		name     string
+		interval time.Duration
+		fn       func(context.Context) error
+	}{
+		{"group-flight-detector", 5 * time.Minute, fswebhook.GroupFlightDetectorJob},
+		{"event-attendance", 5 * time.Minute, fswebhook.EventAttendanceJob},
+		{"weekly-digest", time.Hour, fswebhook.WeeklyDigestJob},
+	} {
+		jobs.Go(stopJobs, func() { fswebhook.RunPeriodic(jobsCtx, job.name, job.interval, job.fn) })
+	}
+
+	http.Handle("/", http.FileServer(http.Dir("./static")))
+	http.Handle("/metrics", promhttp.Handler())
+	http.HandleFunc("/healthz", fswebhook.HealthzHandler)
+	http.HandleFunc("/readyz", fswebhook.ReadyzHandler)
+	http.HandleFunc("/group-flights.html", groupFlightsHandler)
+	http.HandleFunc("/flights", fswebhook.FlightsHandler)
+	http.HandleFunc("/group-flight", fswebhook.GroupFlightHandler)
+	http.HandleFunc("/group-flights", fswebhook.GroupFlightsHandler)
+	http.HandleFunc("/group-flights/leaderboard", fswebhook.FormationLeaderboardHandler)
+	http.HandleFunc("/group-flights/{id}", fswebhook.GroupFlightDetailHandler)
+	http.HandleFunc("/aircraft", fswebhook.AircraftHandler)
+	http.HandleFunc("/aircraft/{icao}", fswebhook.AircraftTypeHandler)
+	http.HandleFunc("/routes", fswebhook.RoutesHandler)
+	http.HandleFunc("/routes/new", fswebhook.NewRoutesHandler)
+	http.HandleFunc("/efficiency", fswebhook.EfficiencyHandler)
+	http.HandleFunc("/export/flights.csv", fswebhook.FlightsCSVHandler)
+	http.HandleFunc("/export/flights.xlsx", fswebhook.FlightsXLSXHandler)
+	http.HandleFunc("/export/report.xlsx", fswebhook.ReportXLSXHandler)
+	http.HandleFunc("/achievements", fswebhook.AchievementRulesHandler)
+	http.HandleFunc("/pilots/{id}/achievements", fswebhook.PilotAchievementsHandler)
+	http.HandleFunc("/pilots/{id}/activity", fswebhook.PilotActivityHandler)
+	http.HandleFunc("/pilots/{id}/flights.atom", fswebhook.PilotFlightsFeedHandler)
+	http.HandleFunc("/feeds/flights.atom", fswebhook.FlightsFeedHandler)
+	http.HandleFunc("/feeds/weekly.atom", fswebhook.WeeklyFeedHandler)
+	http.HandleFunc("/feeds/group-flights.atom", fswebhook.GroupFlightsFeedHandler)
+	http.HandleFunc("/admin/group-leaders", fswebhook.GroupLeadersAdminHandler)
+	http.HandleFunc("/admin/group-leaders/{id}", fswebhook.GroupLeaderAdminHandler)
+	http.HandleFunc("/events", fswebhook.EventsHandler)
+	http.Handle("/events/stream", stream)
+	http.HandleFunc("/events/{id}", fswebhook.EventHandler)
+	http.HandleFunc("/events/{id}/rsvp", fswebhook.EventRSVPHandler)
+	http.HandleFunc("/admin/events", fswebhook.EventsAdminHandler)
+	http.HandleFunc("/admin/events/{id}", fswebhook.EventAdminHandler)
+	http.HandleFunc("/admin/pilots/{id}/token", fswebhook.PilotTokenAdminHandler)
+	http.HandleFunc("/admin/webhooks", fswebhook.WebhooksAdminHandler)
+	http.HandleFunc("/admin/webhooks/{id}", fswebhook.WebhookAdminHandler)
+	http.HandleFunc("/admin/webhooks/{id}/deliveries", fswebhook.WebhookDeliveriesAdminHandler)
+	http.HandleFunc("/admin/rejections", fswebhook.IngestRejectionsAdminHandler)
+
+	// Only register the webhook handler if the flag is set.
+	if cfg.Webhook {
+		http.HandleFunc("/webhook/flight-completed", fswebhook.FlightCompletedHandler)
+		slog.Info("Flight completed webhook is enabled")
+	}
+
+	// Wrap the default ServeMux with the logging middleware.
+	loggedRouter := fswebhook.RequestLogger(fswebhook.InstrumentHandler(http.DefaultServeMux))
+
+	var servers []*http.Server
+	if cfg.TLS.Hostname != "" {
+		certManager := autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.TLS.Hostname),
+			Cache:      autocert.DirCache(fswebhook.CertCacheDir),
+		}
+
+		servers = append(servers, &http.Server{
+			Addr:    cfg.TLS.HTTPSAddr,
+			Handler: loggedRouter,
+			TLSConfig: &tls.Config{
+				GetCertificate: certManager.GetCertificate,
+				MinVersion:     tls.VersionTLS11,
+			},
+		})
+
+		// Serve HTTP, which will handle ACME challenges and serve content.
+		// The HTTPHandler wraps the main router. It will handle ACME challenges
+		// and pass other requests to the loggedRouter.
+		servers = append(servers, &http.Server{Addr: cfg.TLS.HTTPAddr, Handler: certManager.HTTPHandler(loggedRouter)})
+
+	} else {
+		servers = append(servers, &http.Server{Addr: cfg.Listen, Handler: loggedRouter})
+	}
+
+	serveErrors := make(chan error, len(servers))
+	for _, server := range servers {
+		server.ErrorLog = slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn)
+		server.RegisterOnShutdown(stopStreams)
+		go func() {
+			var err error
+			if server.TLSConfig != nil {
+				slog.Info("Server starting for https", "addr", server.Addr)
+				err = server.ListenAndServeTLS("", "")
+			} else {
+				slog.Info("Server starting for http", "addr", server.Addr)
+				err = server.ListenAndServe()
+			}
+			if !errors.Is(err, http.ErrServerClosed) {
+				serveErrors <- fmt.Errorf("serving on %s: %w", server.Addr, err)
+			}
+		}()
+	}
+
+	var serveErr error
+	select {
+	case <-ctx.Done():
+		slog.Info("Shutting down")
+	case serveErr = <-serveErrors:
+	}
+
+	// Stop taking requests and let the ones in flight, such as webhook writes, finish. Then stop
+	// the jobs and deliver the notifications already published. The database is closed last,
+	// once this returns.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := server.Shutdown(shutdownCtx); err != nil {
+				slog.Error("Error shutting down server", "addr", server.Addr, "err", err)
+				server.Close()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if !jobs.Stop(shutdownCtx) {
+		slog.Warn("Timed out waiting for background jobs to finish")
+	}
+	if !notifiers.Stop(shutdownCtx) {
+		slog.Warn("Timed out delivering notifications, abandoning the rest")
+		cancelNotify()
+		notifiers.Stop(context.Background())
+	}
+	slog.Info("Server stopped")
+	return serveErr
+}
+
+// background tracks goroutines that run until told to stop.
+type background struct {
+	wg    sync.WaitGroup
+	stops []func()
+}
+
+// Go runs fn in a goroutine that returns once stop has been called.
+func (b *background) Go(stop func(), fn func()) {
+	b.stops = append(b.stops, stop)
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		fn()
+	}()
+}
+
+// Stop tells every goroutine to stop and waits for them until ctx is done, reporting
+// whether they all returned.
+func (b *background) Stop(ctx context.Context) bool {
+	for _, stop := range b.stops {
+		stop()
+	}
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -6,7 +6,7 @@ import sqlite3
 from datetime import datetime, timedelta, timezone
 
 API_BASE_URL = "https://fshub.io/api/v3"
-DB_FILE = "fshub.db"
+DB_FILE = os.environ.get("FSHUB_DATABASE", "fshub.db")
 
 def get_db_connection():
     """Establishes a connection to the SQLite database."""
@@ -164,7 +164,7 @@ if __name__ == "__main__":
         auth_token = get_auth_token()
         print("Successfully retrieved API token.")
         
-        airline_id = "6076"
+        airline_id = os.environ.get("FSHUB_AIRLINE_ID", "6076")
         if airline_id:
             # 1. Establish DB connection
             conn = get_db_connection()